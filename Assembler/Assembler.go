@@ -0,0 +1,381 @@
+// Package Assembler assembles the subset of the Ophis assembler syntax used
+// by the test programs: the .org, .advance, .alias, .byte, .word,
+// .outfile, .include, .scope, .macro and .invoke directives.
+package Assembler
+
+import (
+	"emu6502/ComputeUnit/CPU"
+	"emu6502/ComputeUnit/CPU/AddressMode"
+	"emu6502/Disassembler"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxPasses limits the layout passes. Every pass places the labels with
+// the sizes the previous pass found, until no label moves.
+const maxPasses = 16
+
+// opcodeTable maps mnemonics and addressing modes to their opcode
+var opcodeTable = make(map[string]map[AddressMode.AddressMode]uint8)
+
+func init() {
+	for opcode := range CPU.Instructions {
+		instruction := &CPU.Instructions[opcode]
+		if !instruction.Valid() {
+			continue
+		}
+		if opcodeTable[instruction.Mnemonic] == nil {
+			opcodeTable[instruction.Mnemonic] = make(map[AddressMode.AddressMode]uint8)
+		}
+		opcodeTable[instruction.Mnemonic][instruction.Mode] = uint8(opcode)
+	}
+}
+
+// Label is a label of the program, as written to the mapping file
+type Label struct {
+	Name    string
+	Address uint16
+	File    string
+	Line    int
+}
+
+// Program is an assembled program
+type Program struct {
+	// Origin is the address of the first byte of Data
+	Origin uint16
+	Data   []uint8
+	// Outfile is the file named by .outfile, empty if there was none
+	Outfile string
+	Labels  []Label
+	// Listing holds the lines of the listing file
+	Listing []string
+}
+
+// assembler places and encodes the statements of a program
+type assembler struct {
+	statements []*statement
+	// final is set for the encoding, when every symbol must be known
+	final bool
+}
+
+// Assemble assembles a source file and the files it includes
+func Assemble(path string) (*Program, error) {
+	root := newScope(nil)
+	p := &parser{root: root, current: root, macros: make(map[string]*macro)}
+	if err := p.parseFile(path); err != nil {
+		return nil, err
+	}
+	if p.current != root {
+		return nil, fmt.Errorf("%s: .scope without .scend", filepath.Base(path))
+	}
+
+	a := &assembler{statements: p.statements}
+	if err := a.layout(); err != nil {
+		return nil, err
+	}
+	program, err := a.encode()
+	if err != nil {
+		return nil, err
+	}
+	program.Outfile = p.outfile
+	return program, nil
+}
+
+// lookup returns the value of a symbol seen from the scope. Local names
+// are searched from the innermost scope outwards.
+func (a *assembler) lookup(s *scope, name string) (int, error) {
+	if !strings.HasPrefix(name, "_") {
+		for s.parent != nil {
+			s = s.parent
+		}
+	}
+	for ; s != nil; s = s.parent {
+		found, ok := s.symbols[name]
+		if !ok {
+			continue
+		}
+		if found.alias == nil {
+			if !found.placed {
+				return 0, fmt.Errorf("%w %s", errUndefined, name)
+			}
+			return found.address, nil
+		}
+		if found.resolving {
+			return 0, fmt.Errorf("alias %s refers to itself", name)
+		}
+		found.resolving = true
+		value, err := found.alias.eval(a)
+		found.resolving = false
+		return value, err
+	}
+	return 0, fmt.Errorf("unknown symbol %s", name)
+}
+
+// evaluate returns the value of an expression. Until the encoding, values
+// that depend on labels not placed yet are reported as unknown.
+func (a *assembler) evaluate(e *expression) (value int, known bool, err error) {
+	value, err = e.eval(a)
+	if errors.Is(err, errUndefined) && !a.final {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", e.text, err)
+	}
+	return value, true, nil
+}
+
+// layout places the statements. Operands that aren't known yet are assumed
+// to need two bytes, so the program only shrinks from pass to pass.
+func (a *assembler) layout() error {
+	for pass := 0; pass < maxPasses; pass++ {
+		moved := false
+		pc := 0
+		for _, s := range a.statements {
+			s.address = pc
+			switch s.kind {
+			case labelStatement:
+				if !s.label.placed || s.label.address != pc {
+					s.label.placed, s.label.address, moved = true, pc, true
+				}
+			case instructionStatement:
+				if err := a.chooseMode(s); err != nil {
+					return fmt.Errorf("%s: %w", s.source, err)
+				}
+				s.size = int(s.mode.Length())
+			case byteStatement:
+				s.size = len(s.values)
+			case wordStatement:
+				s.size = 2 * len(s.values)
+			case orgStatement, advanceStatement:
+				target, known, err := a.evaluate(s.values[0])
+				if err == nil && !known {
+					err = fmt.Errorf("%s isn't known yet", s.values[0].text)
+				}
+				if err != nil {
+					return fmt.Errorf("%s: %w", s.source, err)
+				}
+				if s.kind == advanceStatement && target < pc {
+					return fmt.Errorf("%s: cannot advance back from $%04X to $%04X", s.source, pc, target)
+				}
+				s.size = 0
+				if s.kind == advanceStatement {
+					s.size = target - pc
+				}
+				pc = target
+				continue
+			}
+			pc += s.size
+			if pc > 0x10000 {
+				return fmt.Errorf("%s: the program exceeds $FFFF", s.source)
+			}
+		}
+		if !moved {
+			return nil
+		}
+	}
+	return fmt.Errorf("the layout doesn't settle after %d passes", maxPasses)
+}
+
+// chooseMode picks the addressing mode of an instruction. Zero page modes
+// are used if the operand is known to fit into one byte.
+func (a *assembler) chooseMode(s *statement) error {
+	s.mode = s.modes[0]
+	if len(s.modes) == 1 || s.modes[0] == AddressMode.Implied || s.modes[0] == AddressMode.Relative {
+		return nil
+	}
+	value, known, err := a.evaluate(s.values[0])
+	if err != nil {
+		return err
+	}
+	if (!known || value < 0 || value > 0xFF) && len(s.modes) > 1 {
+		s.mode = s.modes[1]
+	}
+	return nil
+}
+
+// encode writes the bytes of the placed statements, together with the
+// listing and the labels
+func (a *assembler) encode() (*Program, error) {
+	a.final = true
+	program := &Program{}
+	started := false
+	for _, s := range a.statements {
+		if s.kind == labelStatement {
+			program.Labels = append(program.Labels, Label{s.label.name, uint16(s.address), filepath.Base(s.source.file), s.source.line})
+			program.Listing = append(program.Listing, "; "+s.label.name)
+			continue
+		}
+		if s.size == 0 {
+			continue
+		}
+		if !started {
+			program.Origin, started = uint16(s.address), true
+		}
+
+		start := len(program.Data)
+		var err error
+		switch s.kind {
+		case instructionStatement:
+			program.Data, err = a.encodeInstruction(program.Data, s)
+		case byteStatement:
+			program.Data, err = a.encodeValues(program.Data, s, 1)
+		case wordStatement:
+			program.Data, err = a.encodeValues(program.Data, s, 2)
+		case advanceStatement:
+			program.Data, err = a.encodeAdvance(program.Data, s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.source, err)
+		}
+		program.Listing = append(program.Listing, listingLines(s, program.Data[start:])...)
+	}
+	return program, nil
+}
+
+func (a *assembler) encodeInstruction(data []uint8, s *statement) ([]uint8, error) {
+	data = append(data, opcodeTable[s.mnemonic][s.mode])
+	if len(s.values) == 0 {
+		return data, nil
+	}
+	value, _, err := a.evaluate(s.values[0])
+	if err != nil {
+		return nil, err
+	}
+	switch s.mode {
+	case AddressMode.Relative:
+		offset := value - (s.address + 2)
+		if offset < -128 || offset > 127 {
+			return nil, fmt.Errorf("branch to $%04X is out of range", value)
+		}
+		return append(data, uint8(offset)), nil
+	case AddressMode.Absolut, AddressMode.AbsolutX, AddressMode.AbsolutY, AddressMode.Indirect:
+		return appendValue(data, value, 2)
+	default:
+		return appendValue(data, value, 1)
+	}
+}
+
+func (a *assembler) encodeValues(data []uint8, s *statement, size int) ([]uint8, error) {
+	for _, e := range s.values {
+		value, _, err := a.evaluate(e)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = appendValue(data, value, size); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (a *assembler) encodeAdvance(data []uint8, s *statement) ([]uint8, error) {
+	fill := 0
+	if len(s.values) > 1 {
+		var err error
+		if fill, _, err = a.evaluate(s.values[1]); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; i < s.size; i++ {
+		var err error
+		if data, err = appendValue(data, fill, 1); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// appendValue appends a byte or a little endian word. Negative bytes are
+// stored in two's complement.
+func appendValue(data []uint8, value int, size int) ([]uint8, error) {
+	if size == 1 {
+		if value < -128 || value > 0xFF {
+			return nil, fmt.Errorf("$%X doesn't fit into a byte", value)
+		}
+		return append(data, uint8(value)), nil
+	}
+	if value < 0 || value > 0xFFFF {
+		return nil, fmt.Errorf("$%X doesn't fit into a word", value)
+	}
+	return append(data, uint8(value), uint8(value>>8)), nil
+}
+
+// listingLines formats the bytes of a statement. Data is listed with three
+// bytes per line, the padding of .advance isn't listed.
+func listingLines(s *statement, data []uint8) []string {
+	switch s.kind {
+	case instructionStatement:
+		line := Disassembler.Decode(func(address uint16) uint8 {
+			return data[address-uint16(s.address)]
+		}, uint16(s.address))
+		return []string{" " + line.String()}
+	case byteStatement, wordStatement:
+		size := 1
+		if s.kind == wordStatement {
+			size = 2
+		}
+		perLine := 3 / size * size
+		var lines []string
+		for offset := 0; offset < len(data); offset += perLine {
+			end := offset + perLine
+			if end > len(data) {
+				end = len(data)
+			}
+			chunk := data[offset:end]
+			hexBytes := make([]string, len(chunk))
+			values := make([]string, 0, len(chunk)/size)
+			for i, b := range chunk {
+				hexBytes[i] = fmt.Sprintf("%02X", b)
+				if size == 1 {
+					values = append(values, fmt.Sprintf("$%02X", b))
+				} else if i%2 == 1 {
+					values = append(values, fmt.Sprintf("$%04X", CPU.CombineLowHigh(chunk[i-1], b)))
+				}
+			}
+			directive := ".byte "
+			if size == 2 {
+				directive = ".word "
+			}
+			lines = append(lines, fmt.Sprintf(" %04X  %-9s %s%s", s.address+offset, strings.Join(hexBytes, " "), directive, strings.Join(values, ", ")))
+		}
+		return lines
+	default:
+		return nil
+	}
+}
+
+// WriteListing writes the listing. Like the Ophis listing every line of
+// code starts with " %04X", which Debugger.LoadListing looks for.
+func (p *Program) WriteListing(w io.Writer) error {
+	for _, line := range p.Listing {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteMapping writes the labels sorted by address, like
+// "$4047 | start | helloWorld.oph:9"
+func (p *Program) WriteMapping(w io.Writer) error {
+	labels := append([]Label(nil), p.Labels...)
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].Address < labels[j].Address
+	})
+	width := 0
+	for _, label := range labels {
+		if len(label.Name) > width {
+			width = len(label.Name)
+		}
+	}
+	for _, label := range labels {
+		if _, err := fmt.Fprintf(w, "$%04X | %-*s | %s:%d\n", label.Address, width, label.Name, label.File, label.Line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package Assembler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// assembleSource writes the files into a temporary directory and
+// assembles the first one
+func assembleSource(t *testing.T, files ...string) (*Program, error) {
+	t.Helper()
+	dir := t.TempDir()
+	for i, content := range files {
+		name := "main.oph"
+		if i > 0 {
+			name = "include.oph"
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return Assemble(filepath.Join(dir, "main.oph"))
+}
+
+func TestAssemble(t *testing.T) {
+	program, err := assembleSource(t, `
+.org $0300
+.alias zp $10
+.alias later end
+.include "include.oph"
+start:  lda #<later
+        ldy zp, x
+        lda zp+$100
+        sta (zp), y
+        jmp (vector)
+        lsr
+        asl a
+        bne start
+.scope
+_local: .invoke twice $AB
+        beq _local
+.scend
+.scope
+_local: .byte "Hi", 'a, -1
+.scend
+vector: .word start, [end - start] * 2
+end:
+.advance $0330, $EA
+`, `
+; the macro uses the caller's alias zp
+.macro twice
+        lda #_1
+        sta zp
+        sta zp
+.macend
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint8{
+		0xA9, 0x20,
+		0xB4, 0x10,
+		0xAD, 0x10, 0x01,
+		0x91, 0x10,
+		0x6C, 0x1C, 0x03,
+		0x4A,
+		0x0A,
+		0xD0, 0xF0,
+		0xA9, 0xAB, 0x85, 0x10, 0x85, 0x10,
+		0xF0, 0xF8,
+		0x48, 0x69, 0x61, 0xFF,
+		0x00, 0x03, 0x40, 0x00,
+	}
+	expected = append(expected, bytes.Repeat([]uint8{0xEA}, 16)...)
+	if program.Origin != 0x0300 {
+		t.Errorf("origin: got $%04X", program.Origin)
+	}
+	if !bytes.Equal(program.Data, expected) {
+		t.Errorf("data:\ngot      % X\nexpected % X", program.Data, expected)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	program, err := assembleSource(t, `
+.org $4020
+.outfile "test.rom"
+start:  ldx #0
+_loop:  inx
+        bne _loop
+data:   .byte 1, 2, 3, 4
+        .word start
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.Outfile != "test.rom" {
+		t.Errorf("outfile: got %q", program.Outfile)
+	}
+
+	var listing, mapping strings.Builder
+	if err := program.WriteListing(&listing); err != nil {
+		t.Fatal(err)
+	}
+	expected := "; start\n" +
+		" 4020  A2 00     LDX #$00\n" +
+		"; _loop\n" +
+		" 4022  E8        INX\n" +
+		" 4023  D0 FD     BNE $4022\n" +
+		"; data\n" +
+		" 4025  01 02 03  .byte $01, $02, $03\n" +
+		" 4028  04        .byte $04\n" +
+		" 4029  20 40     .word $4020\n"
+	if listing.String() != expected {
+		t.Errorf("listing: got\n%s\nexpected\n%s", listing.String(), expected)
+	}
+
+	if err := program.WriteMapping(&mapping); err != nil {
+		t.Fatal(err)
+	}
+	expected = "$4020 | start | main.oph:4\n" +
+		"$4022 | _loop | main.oph:5\n" +
+		"$4025 | data  | main.oph:7\n"
+	if mapping.String() != expected {
+		t.Errorf("mapping: got\n%s\nexpected\n%s", mapping.String(), expected)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"lda missing", "main.oph:1: missing: unknown symbol missing"},
+		{"foo #1", "main.oph:1: unknown instruction FOO"},
+		{"ldx $10, x", "main.oph:1: LDX doesn't support the operand \"$10, x\""},
+		{"a:\na:", "main.oph:2: a already defined at main.oph:1"},
+		{".org $10\nlda #$100", "main.oph:2: $100 doesn't fit into a byte"},
+		{"start: .advance $100\nbne start", "main.oph:2: branch to $0000 is out of range"},
+		{".org $10\n.advance $8", "main.oph:2: cannot advance back from $0010 to $0008"},
+		{".alias c d\n.alias d c\nlda c", "main.oph:3: c: alias c refers to itself"},
+		{".invoke missing", "main.oph:1: unknown macro missing"},
+		{".macro m\n.invoke m\n.macend\n.invoke m", "macros nested more than 64 times"},
+		{".scope", "main.oph: .scope without .scend"},
+		{".scope\n_x: nop\n.scend\njmp _x", "main.oph:4: _x: unknown symbol _x"},
+	}
+	for _, test := range tests {
+		_, err := assembleSource(t, test.source)
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%q: got %v, expected %q", test.source, err, test.expected)
+		}
+	}
+}
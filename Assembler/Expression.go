@@ -0,0 +1,246 @@
+package Assembler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// errUndefined is returned while a symbol has no value yet. Labels
+// defined further down are only known after the first layout pass.
+var errUndefined = errors.New("undefined symbol")
+
+// evaluator computes the value of an expression. Symbols are looked up in
+// the scope the expression was written in.
+type evaluator func(a *assembler) (int, error)
+
+// expression is a parsed operand
+type expression struct {
+	text string
+	eval evaluator
+}
+
+// operators lists the binary operators by increasing precedence
+var operators = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"+", "-"},
+	{"*", "/"},
+}
+
+// expressionParser is a precedence climbing parser. Like Ophis, it uses
+// brackets for grouping since parentheses denote indirect addressing.
+type expressionParser struct {
+	text     string
+	position int
+	scope    *scope
+}
+
+// parseExpression parses the whole text as one expression
+func parseExpression(text string, s *scope) (*expression, error) {
+	p := &expressionParser{text: text, scope: s}
+	eval, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.position < len(p.text) {
+		return nil, fmt.Errorf("unexpected %q in expression %q", p.text[p.position:], text)
+	}
+	return &expression{text: text, eval: eval}, nil
+}
+
+func (p *expressionParser) skipSpace() {
+	for p.position < len(p.text) && unicode.IsSpace(rune(p.text[p.position])) {
+		p.position++
+	}
+}
+
+// peek returns the next non space character, 0 at the end
+func (p *expressionParser) peek() byte {
+	p.skipSpace()
+	if p.position >= len(p.text) {
+		return 0
+	}
+	return p.text[p.position]
+}
+
+func (p *expressionParser) parseBinary(precedence int) (evaluator, error) {
+	if precedence == len(operators) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(precedence + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator := string(p.peek())
+		if !contains(operators[precedence], operator) {
+			return left, nil
+		}
+		p.position++
+		right, err := p.parseBinary(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binary(operator, left, right)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, element := range list {
+		if element == s {
+			return true
+		}
+	}
+	return false
+}
+
+func binary(operator string, left evaluator, right evaluator) evaluator {
+	return func(a *assembler) (int, error) {
+		l, err := left(a)
+		if err != nil {
+			return 0, err
+		}
+		r, err := right(a)
+		if err != nil {
+			return 0, err
+		}
+		switch operator {
+		case "|":
+			return l | r, nil
+		case "^":
+			return l ^ r, nil
+		case "&":
+			return l & r, nil
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		default:
+			if r == 0 {
+				return 0, errors.New("division by zero")
+			}
+			return l / r, nil
+		}
+	}
+}
+
+// parseUnary parses the negation and the < and > operators that select
+// the low and the high byte
+func (p *expressionParser) parseUnary() (evaluator, error) {
+	operator := p.peek()
+	if operator != '-' && operator != '<' && operator != '>' {
+		return p.parsePrimary()
+	}
+	p.position++
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return func(a *assembler) (int, error) {
+		value, err := operand(a)
+		switch operator {
+		case '-':
+			return -value, err
+		case '<':
+			return value & 0xFF, err
+		default:
+			return value >> 8 & 0xFF, err
+		}
+	}, nil
+}
+
+func (p *expressionParser) parsePrimary() (evaluator, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("missing operand in expression %q", p.text)
+	case c == '[':
+		p.position++
+		inner, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ']' {
+			return nil, fmt.Errorf("missing ] in expression %q", p.text)
+		}
+		p.position++
+		return inner, nil
+	case c == '\'':
+		// A character constant is a quote followed by the character
+		if p.position+1 >= len(p.text) {
+			return nil, fmt.Errorf("missing character after ' in %q", p.text)
+		}
+		value := int(p.text[p.position+1])
+		p.position += 2
+		return constant(value), nil
+	case c == '$' || c == '%' || c >= '0' && c <= '9':
+		start := p.position
+		p.position++
+		for p.position < len(p.text) && isNameCharacter(p.text[p.position]) {
+			p.position++
+		}
+		value, err := parseNumber(p.text[start:p.position])
+		if err != nil {
+			return nil, err
+		}
+		return constant(value), nil
+	case isNameCharacter(c):
+		start := p.position
+		for p.position < len(p.text) && isNameCharacter(p.text[p.position]) {
+			p.position++
+		}
+		name := p.text[start:p.position]
+		s := p.scope
+		return func(a *assembler) (int, error) {
+			return a.lookup(s, name)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q in expression %q", c, p.text)
+	}
+}
+
+func constant(value int) evaluator {
+	return func(a *assembler) (int, error) {
+		return value, nil
+	}
+}
+
+// parseNumber parses "$FF", "%1010" or a decimal number
+func parseNumber(text string) (int, error) {
+	base, digits := 10, text
+	switch {
+	case strings.HasPrefix(text, "$"):
+		base, digits = 16, text[1:]
+	case strings.HasPrefix(text, "%"):
+		base, digits = 2, text[1:]
+	}
+	value, err := strconv.ParseUint(digits, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", text)
+	}
+	return int(value), nil
+}
+
+func isNameCharacter(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// isName checks that the text is a valid label or alias name
+func isName(text string) bool {
+	if text == "" || text[0] >= '0' && text[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(text); i++ {
+		if !isNameCharacter(text[i]) {
+			return false
+		}
+	}
+	return true
+}
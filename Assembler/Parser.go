@@ -0,0 +1,462 @@
+package Assembler
+
+import (
+	"bufio"
+	"emu6502/ComputeUnit/CPU/AddressMode"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxInvokeDepth limits nested macro invocations, so a macro invoking
+// itself fails instead of running out of memory
+const maxInvokeDepth = 64
+
+// source is the position of a statement, used in errors and the mapping
+type source struct {
+	file string
+	line int
+}
+
+func (s source) String() string {
+	return fmt.Sprintf("%s:%d", filepath.Base(s.file), s.line)
+}
+
+// scope holds the symbols of a .scope block or a macro invocation. The
+// root scope holds the global symbols.
+type scope struct {
+	parent  *scope
+	symbols map[string]*symbol
+}
+
+func newScope(parent *scope) *scope {
+	return &scope{parent: parent, symbols: make(map[string]*symbol)}
+}
+
+// symbol is a label or an alias
+type symbol struct {
+	name   string
+	source source
+	// alias is nil for labels
+	alias *expression
+	// address is set when a label has been placed by the layout
+	address int
+	placed  bool
+	// resolving detects aliases that refer to themselves
+	resolving bool
+}
+
+type statementKind int
+
+const (
+	labelStatement statementKind = iota
+	instructionStatement
+	byteStatement
+	wordStatement
+	orgStatement
+	advanceStatement
+)
+
+// statement is a line of the program after the macros have been expanded
+type statement struct {
+	kind   statementKind
+	source source
+	label  *symbol
+	// mnemonic and modes describe an instruction. modes holds the
+	// addressing modes the operand syntax allows, the layout picks one.
+	mnemonic string
+	modes    []AddressMode.AddressMode
+	mode     AddressMode.AddressMode
+	// values are the operands of instructions and directives. Strings of
+	// a .byte directive are stored as one value per character.
+	values []*expression
+
+	address int
+	size    int
+}
+
+// macro is the body of a .macro block
+type macro struct {
+	source source
+	lines  []sourceLine
+}
+
+type sourceLine struct {
+	source source
+	text   string
+}
+
+// parser reads the source files into statements
+type parser struct {
+	root       *scope
+	current    *scope
+	statements []*statement
+	macros     map[string]*macro
+	outfile    string
+	depth      int
+}
+
+// parseFile reads a file and the files it includes
+func (p *parser) parseFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var lines []sourceLine
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		lines = append(lines, sourceLine{source{path, number}, scanner.Text()})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return p.parseLines(lines)
+}
+
+// parseLines parses lines of a file or a macro body. Macro definitions are
+// collected until their .macend.
+func (p *parser) parseLines(lines []sourceLine) error {
+	var defining *macro
+	var name string
+	for _, line := range lines {
+		text := strings.TrimSpace(stripComment(line.text))
+		directive, _ := splitWord(text)
+		if defining != nil {
+			if strings.EqualFold(directive, ".macend") {
+				p.macros[name] = defining
+				defining = nil
+			} else {
+				defining.lines = append(defining.lines, line)
+			}
+			continue
+		}
+		if strings.EqualFold(directive, ".macro") {
+			_, name = splitWord(text)
+			if !isName(name) {
+				return fmt.Errorf("%s: invalid macro name %q", line.source, name)
+			}
+			if _, exists := p.macros[name]; exists {
+				return fmt.Errorf("%s: macro %s already defined", line.source, name)
+			}
+			defining = &macro{source: line.source}
+			continue
+		}
+		if err := p.parseLine(line.source, text); err != nil {
+			return fmt.Errorf("%s: %w", line.source, err)
+		}
+	}
+	if defining != nil {
+		return fmt.Errorf("%s: macro %s misses .macend", defining.source, name)
+	}
+	return nil
+}
+
+// parseLine parses one line without its comment. Labels may precede a
+// statement on the same line.
+func (p *parser) parseLine(position source, text string) error {
+	for {
+		colon := strings.IndexByte(text, ':')
+		if colon < 0 || !isName(text[:colon]) {
+			break
+		}
+		label := &symbol{name: text[:colon], source: position}
+		if err := p.define(label); err != nil {
+			return err
+		}
+		p.add(&statement{kind: labelStatement, source: position, label: label})
+		text = strings.TrimSpace(text[colon+1:])
+	}
+	if text == "" {
+		return nil
+	}
+
+	word, rest := splitWord(text)
+	if strings.HasPrefix(word, ".") {
+		return p.parseDirective(position, strings.ToLower(word), rest)
+	}
+	return p.parseInstruction(position, strings.ToUpper(word), rest)
+}
+
+func (p *parser) add(s *statement) {
+	p.statements = append(p.statements, s)
+}
+
+// define adds a symbol. Names starting with an underscore are local to the
+// current scope, the others are global.
+func (p *parser) define(s *symbol) error {
+	target := p.root
+	if strings.HasPrefix(s.name, "_") {
+		target = p.current
+	}
+	if existing, ok := target.symbols[s.name]; ok {
+		return fmt.Errorf("%s already defined at %s", s.name, existing.source)
+	}
+	target.symbols[s.name] = s
+	return nil
+}
+
+func (p *parser) parseDirective(position source, directive string, arguments string) error {
+	switch directive {
+	case ".org", ".advance":
+		values, err := p.parseValues(arguments)
+		if err != nil {
+			return err
+		}
+		if len(values) < 1 || directive == ".org" && len(values) > 1 || len(values) > 2 {
+			return fmt.Errorf("usage: .org address or .advance address[, fill]")
+		}
+		kind := orgStatement
+		if directive == ".advance" {
+			kind = advanceStatement
+		}
+		p.add(&statement{kind: kind, source: position, values: values})
+	case ".alias":
+		name, text := splitWord(arguments)
+		if !isName(name) || text == "" {
+			return fmt.Errorf("usage: .alias name value")
+		}
+		value, err := parseExpression(text, p.current)
+		if err != nil {
+			return err
+		}
+		return p.define(&symbol{name: name, source: position, alias: value})
+	case ".byte":
+		values, err := p.parseValues(arguments)
+		if err != nil {
+			return err
+		}
+		p.add(&statement{kind: byteStatement, source: position, values: values})
+	case ".word":
+		values, err := p.parseValues(arguments)
+		if err != nil {
+			return err
+		}
+		p.add(&statement{kind: wordStatement, source: position, values: values})
+	case ".outfile":
+		name, err := unquote(arguments)
+		if err != nil {
+			return err
+		}
+		p.outfile = name
+	case ".include":
+		name, err := unquote(arguments)
+		if err != nil {
+			return err
+		}
+		return p.parseFile(filepath.Join(filepath.Dir(position.file), name))
+	case ".scope":
+		p.current = newScope(p.current)
+	case ".scend":
+		if p.current == p.root {
+			return fmt.Errorf(".scend without .scope")
+		}
+		p.current = p.current.parent
+	case ".invoke":
+		return p.invoke(position, arguments)
+	case ".macend":
+		return fmt.Errorf(".macend without .macro")
+	default:
+		return fmt.Errorf("unknown directive %s", directive)
+	}
+	return nil
+}
+
+// invoke expands a macro in a scope of its own. The arguments are defined
+// as the aliases _1, _2 and so on and refer to the caller's scope.
+func (p *parser) invoke(position source, arguments string) error {
+	name, rest := splitWord(arguments)
+	m, ok := p.macros[name]
+	if !ok {
+		return fmt.Errorf("unknown macro %s", name)
+	}
+	if p.depth == maxInvokeDepth {
+		return fmt.Errorf("macros nested more than %d times", maxInvokeDepth)
+	}
+	values, err := p.parseValues(rest)
+	if err != nil {
+		return err
+	}
+
+	caller := p.current
+	p.current = newScope(caller)
+	for i, value := range values {
+		p.current.symbols[fmt.Sprintf("_%d", i+1)] = &symbol{name: fmt.Sprintf("_%d", i+1), source: position, alias: value}
+	}
+	p.depth++
+	err = p.parseLines(m.lines)
+	p.depth--
+	if err == nil && p.current.parent != caller {
+		err = fmt.Errorf("macro %s leaves a .scope open", name)
+	}
+	p.current = caller
+	if err != nil {
+		return fmt.Errorf("in macro %s: %w", name, err)
+	}
+	return nil
+}
+
+// parseValues parses a comma separated list of expressions. A string
+// becomes one value per character.
+func (p *parser) parseValues(text string) ([]*expression, error) {
+	var values []*expression
+	for _, argument := range splitArguments(text) {
+		if strings.HasPrefix(argument, "\"") {
+			characters, err := unquote(argument)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < len(characters); i++ {
+				values = append(values, &expression{text: argument, eval: constant(int(characters[i]))})
+			}
+			continue
+		}
+		value, err := parseExpression(argument, p.current)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// parseInstruction finds the addressing modes that match the syntax of the
+// operand. Whether a zero page mode can be used is decided by the layout.
+func (p *parser) parseInstruction(position source, mnemonic string, operand string) error {
+	opcodes, ok := opcodeTable[mnemonic]
+	if !ok {
+		return fmt.Errorf("unknown instruction %s", mnemonic)
+	}
+
+	var modes []AddressMode.AddressMode
+	text := operand
+	switch {
+	case operand == "":
+		modes = []AddressMode.AddressMode{AddressMode.Implied, AddressMode.Accumulator}
+	case strings.EqualFold(operand, "a"):
+		modes = []AddressMode.AddressMode{AddressMode.Accumulator}
+	case strings.HasPrefix(operand, "#"):
+		modes, text = []AddressMode.AddressMode{AddressMode.Immediate}, operand[1:]
+	case strings.HasPrefix(operand, "(") && strings.HasSuffix(operand, ")"):
+		inner := operand[1 : len(operand)-1]
+		if base, index := splitIndex(inner); index == "x" {
+			modes, text = []AddressMode.AddressMode{AddressMode.IndirectX}, base
+		} else {
+			modes, text = []AddressMode.AddressMode{AddressMode.Indirect}, inner
+		}
+	default:
+		base, index := splitIndex(operand)
+		switch {
+		case index == "y" && strings.HasPrefix(base, "(") && strings.HasSuffix(base, ")"):
+			modes, text = []AddressMode.AddressMode{AddressMode.IndirectY}, base[1:len(base)-1]
+		case index == "x":
+			modes, text = []AddressMode.AddressMode{AddressMode.ZeroPageX, AddressMode.AbsolutX}, base
+		case index == "y":
+			modes, text = []AddressMode.AddressMode{AddressMode.ZeroPageY, AddressMode.AbsolutY}, base
+		default:
+			modes = []AddressMode.AddressMode{AddressMode.Relative, AddressMode.ZeroPage, AddressMode.Absolut}
+		}
+	}
+
+	var supported []AddressMode.AddressMode
+	for _, mode := range modes {
+		if _, ok := opcodes[mode]; ok {
+			supported = append(supported, mode)
+		}
+	}
+	if len(supported) == 0 {
+		return fmt.Errorf("%s doesn't support the operand %q", mnemonic, operand)
+	}
+
+	s := &statement{kind: instructionStatement, source: position, mnemonic: mnemonic, modes: supported}
+	if supported[0] != AddressMode.Implied && supported[0] != AddressMode.Accumulator {
+		value, err := parseExpression(text, p.current)
+		if err != nil {
+			return err
+		}
+		s.values = []*expression{value}
+	}
+	p.add(s)
+	return nil
+}
+
+// splitIndex splits "base, x" into the base and the lower case index
+// register. The index is empty if there is none.
+func splitIndex(operand string) (string, string) {
+	comma := strings.LastIndexByte(operand, ',')
+	if comma < 0 {
+		return operand, ""
+	}
+	index := strings.ToLower(strings.TrimSpace(operand[comma+1:]))
+	if index != "x" && index != "y" {
+		return operand, ""
+	}
+	return strings.TrimSpace(operand[:comma]), index
+}
+
+// splitWord splits the text at the first space
+func splitWord(text string) (string, string) {
+	if i := strings.IndexFunc(text, isSpace); i >= 0 {
+		return text[:i], strings.TrimSpace(text[i:])
+	}
+	return text, ""
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t'
+}
+
+// stripComment removes a comment starting with a semicolon that isn't part
+// of a string or a character constant
+func stripComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '"':
+			quoted = !quoted
+		case line[i] == '\'' && !quoted:
+			i++
+		case line[i] == ';' && !quoted:
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// splitArguments splits the text at commas outside of strings, character
+// constants and brackets
+func splitArguments(text string) []string {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	var arguments []string
+	quoted, depth, start := false, 0, 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '\'':
+			i++
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			arguments = append(arguments, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	return append(arguments, strings.TrimSpace(text[start:]))
+}
+
+// unquote returns the text of a string in double quotes
+func unquote(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if len(text) < 2 || text[0] != '"' || text[len(text)-1] != '"' {
+		return "", fmt.Errorf("expected a string in double quotes, got %q", text)
+	}
+	return text[1 : len(text)-1], nil
+}
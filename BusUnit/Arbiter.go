@@ -0,0 +1,18 @@
+package BusUnit
+
+import (
+	"sync"
+)
+
+// EnableArbitration makes the CPUs take turns on the bus, so only one
+// access to a shared device happens at a time. It has to be called
+// before the compute units are created.
+func (bus *BusUnit) EnableArbitration() {
+	bus.arbiter = &sync.Mutex{}
+}
+
+// Arbiter returns the lock every access to a device of the bus has to
+// hold, nil if only one CPU uses the bus
+func (bus *BusUnit) Arbiter() sync.Locker {
+	return bus.arbiter
+}
@@ -1,43 +1,70 @@
 package BusUnit
 
 import (
+	"emu6502/Logger"
 	"sync"
 )
 
 type BusUnit struct {
-	ROM *ROM
-	RAM *RAM
-	GPU *GPU
+	// Devices contains all devices attached to the bus
+	Devices *Registry
+
+	// channelDevices are devices running in their own goroutine
+	channelDevices []*ChannelDevice
+
+	// arbiter serialises the accesses of several CPUs, see EnableArbitration
+	arbiter sync.Locker
 
 	wg *sync.WaitGroup
 }
 
 func NewBusUnit() *BusUnit {
-	wg := &sync.WaitGroup{}
 	return &BusUnit{
-		ROM: NewROM(wg),
-		RAM: NewRAM(wg),
-		GPU: NewGPU(wg),
-		wg:  wg,
+		Devices: NewRegistry(),
+		wg:      &sync.WaitGroup{},
+	}
+}
+
+// Attach adds a device to the bus and returns its id
+func (bus *BusUnit) Attach(name string, device Device) uint8 {
+	Logger.Infof("Attaching device %s", name)
+	return bus.Devices.Register(name, device)
+}
+
+// NewChannelDevice wraps a device so it runs in its own goroutine.
+// The goroutine is started and stopped together with the BusUnit.
+func (bus *BusUnit) NewChannelDevice(device Device) *ChannelDevice {
+	channelDevice := NewChannelDevice(device, bus.wg)
+	bus.channelDevices = append(bus.channelDevices, channelDevice)
+	return channelDevice
+}
+
+// ConnectIRQ connects the IRQ line of the CPU with the given id to all
+// devices that can raise interrupts
+func (bus *BusUnit) ConnectIRQ(cpu uint8, irq func(asserted bool)) {
+	for _, device := range bus.Devices.Devices() {
+		if source, ok := device.(IRQSource); ok {
+			source.ConnectIRQ(cpu, irq)
+		}
 	}
 }
 
-func (bus *BusUnit) Reset(romFilename string) {
-	bus.ROM.Reset(romFilename)
-	bus.RAM.Reset()
-	bus.GPU.Reset()
+func (bus *BusUnit) Reset() {
+	for _, device := range bus.Devices.Devices() {
+		device.Reset()
+	}
 }
 
 func (bus *BusUnit) Run() {
-	go bus.ROM.Run()
-	go bus.RAM.Run()
-	go bus.GPU.Run()
+	for _, device := range bus.channelDevices {
+		go device.Run()
+	}
 }
 
 func (bus *BusUnit) Halt() {
-	bus.ROM.Halt()
-	bus.RAM.Halt()
-	bus.GPU.Halt()
+	for _, device := range bus.channelDevices {
+		device.Halt()
+	}
 
 	bus.wg.Wait()
 }
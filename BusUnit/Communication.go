@@ -1,9 +1,9 @@
 package BusUnit
 
-type Connection struct {
-	AddressBus *chan AddressBus
-	DataBus    *chan DataBus
-}
+import (
+	"emu6502/Logger"
+	"sync"
+)
 
 type AddressBus struct {
 	// The Read/Write Byte indicates if the CPU wants to read from or write to memory
@@ -16,3 +16,64 @@ type DataBus struct {
 	// actual contents
 	Data uint8
 }
+
+// ChannelDevice runs a device in its own goroutine. Every access is
+// handed over through the AddressBus and DataBus channels, so the device
+// is only ever touched by its own goroutine.
+// This is much slower than calling a device directly and only meant for
+// devices that need to do work on their own.
+type ChannelDevice struct {
+	device Device
+
+	AddressBus chan AddressBus
+	DataBus    chan DataBus
+
+	halt *sync.WaitGroup
+}
+
+// NewChannelDevice wraps the device, Run has to be called before the
+// device can be accessed
+func NewChannelDevice(device Device, wg *sync.WaitGroup) *ChannelDevice {
+	wg.Add(1)
+	return &ChannelDevice{
+		device:     device,
+		AddressBus: make(chan AddressBus),
+		DataBus:    make(chan DataBus),
+		halt:       wg,
+	}
+}
+
+// Run serves the accesses to the device until Halt is called
+func (d *ChannelDevice) Run() {
+	for command := range d.AddressBus {
+		if command.Rw == 'W' {
+			d.device.Write(command.Data, (<-d.DataBus).Data)
+		} else if command.Rw == 'R' {
+			d.DataBus <- DataBus{Data: d.device.Read(command.Data)}
+		} else {
+			Logger.Errorf("Invalid bus command %c", command.Rw)
+		}
+	}
+	d.halt.Done()
+}
+
+func (d *ChannelDevice) Halt() {
+	close(d.AddressBus)
+	close(d.DataBus)
+}
+
+func (d *ChannelDevice) Read(address uint32) uint8 {
+	d.AddressBus <- AddressBus{Rw: 'R', Data: address}
+	return (<-d.DataBus).Data
+}
+
+func (d *ChannelDevice) Write(address uint32, data uint8) {
+	d.AddressBus <- AddressBus{Rw: 'W', Data: address}
+	d.DataBus <- DataBus{Data: data}
+}
+
+// Reset resets the wrapped device. It must not be called while the
+// device is running.
+func (d *ChannelDevice) Reset() {
+	d.device.Reset()
+}
@@ -0,0 +1,17 @@
+package BusUnit
+
+// Device is a component on the bus, like memory or an I/O chip.
+// The MMU translates virtual addresses and calls the device directly
+// with the physical address inside the device.
+type Device interface {
+	Read(address uint32) uint8
+	Write(address uint32, data uint8)
+	Reset()
+}
+
+// Memory is implemented by devices that just store bytes, like RAM and
+// ROM. Unlike Read on an I/O device, Peek never has side effects, so
+// debuggers can save and restore the contents at any time.
+type Memory interface {
+	Peek(address uint32) uint8
+}
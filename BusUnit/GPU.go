@@ -3,56 +3,37 @@ package BusUnit
 import (
 	"emu6502/Logger"
 	"fmt"
-	"sync"
+	"io"
+	"os"
 )
 
 type GPU struct {
-	AddressBus chan AddressBus
-	DataBus    chan DataBus
-	halt       *sync.WaitGroup
+	output io.Writer
 }
 
-func NewGPU(wg *sync.WaitGroup) *GPU {
-	wg.Add(1)
-	return &GPU{
-		AddressBus: make(chan AddressBus),
-		DataBus:    make(chan DataBus),
-		halt:       wg,
-	}
-}
-
-func (g *GPU) Reset() {
-	Logger.Infof("GPU Reset")
+func NewGPU() *GPU {
+	return &GPU{output: os.Stdout}
 }
 
-func (g *GPU) Run() {
-	Logger.Infof("GPU Run")
-	for command := range g.AddressBus {
-		if command.Rw == 'W' {
-			g.handleMemoryWrite(command.Data, (<-g.DataBus).Data)
-		} else if command.Rw == 'R' {
-			g.DataBus <- DataBus{Data: g.handleMemoryRead(command.Data)}
-		}
-	}
-	g.halt.Done()
+// SetOutput redirects the characters printed by the GPU
+func (g *GPU) SetOutput(output io.Writer) {
+	g.output = output
 }
 
-func (g *GPU) Halt() {
-	Logger.Infof("GPU Halt")
-	close(g.AddressBus)
-	close(g.DataBus)
+func (g *GPU) Reset() {
+	Logger.Infof("GPU Reset")
 }
 
-func (g *GPU) handleMemoryWrite(location uint32, data uint8) {
+func (g *GPU) Write(location uint32, data uint8) {
 	switch location {
 	case 0x00:
-		fmt.Printf("%c", data)
+		fmt.Fprintf(g.output, "%c", data)
 	default:
 		Logger.Warnf("GPU Memory Write: %x %x", location, data)
 	}
 }
 
-func (g *GPU) handleMemoryRead(location uint32) uint8 {
+func (g *GPU) Read(location uint32) uint8 {
 	Logger.Warnf("GPU Memory Read: %d", location)
 	return 0
 }
@@ -0,0 +1,35 @@
+package BusUnit
+
+import (
+	"emu6502/Logger"
+	"os"
+)
+
+// Sized is implemented by devices with a fixed amount of storage
+type Sized interface {
+	Size() uint32
+}
+
+// readImage reads a memory image from a file
+func readImage(filename string) []byte {
+	_, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		Logger.Fatalf("Please add a '%s' file", filename)
+	}
+
+	bytes, err := os.ReadFile(filename)
+	if err != nil {
+		Logger.Fatalf("Cannot read '%s'", filename)
+	}
+	return bytes
+}
+
+// copyImage copies the image into the storage at the given offset
+func copyImage(storage []uint8, image []byte, offset uint32, filename string) {
+	if uint64(offset)+uint64(len(image)) > uint64(len(storage)) {
+		Logger.Warnf("Image '%s' doesn't fit at offset 0x%X, it will be truncated", filename, offset)
+	}
+	if offset < uint32(len(storage)) {
+		copy(storage[offset:], image)
+	}
+}
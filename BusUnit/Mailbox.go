@@ -0,0 +1,197 @@
+package BusUnit
+
+import (
+	"emu6502/Logger"
+	"sync"
+)
+
+// Layout of the mailbox device.
+// Every CPU has a block of registers starting at MailboxBlock + id*4.
+// Any CPU can write to the mailbox of another CPU and ring its doorbell,
+// the owner reads its own mailbox and acknowledges the doorbell.
+const (
+	// MailboxLocks is the first of the test-and-set registers. Reading a
+	// lock returns its old value and sets it, writing releases it.
+	MailboxLocks = 0x00
+	MailboxBlock = 0x10
+
+	// MailboxData pushes a byte into the FIFO on write, and pops one on read
+	MailboxData = 0x00
+	// MailboxStatus is the number of bytes in the FIFO
+	MailboxStatus = 0x01
+	// MailboxDoorbell raises the IRQ of the owner on write
+	MailboxDoorbell = 0x02
+	// MailboxAck releases the IRQ on write, reading it tells if the doorbell rang
+	MailboxAck = 0x03
+
+	mailboxLocks     = MailboxBlock - MailboxLocks
+	mailboxBlockSize = 4
+	mailboxDepth     = 16
+)
+
+// IRQSource is implemented by devices that can raise interrupts
+type IRQSource interface {
+	// ConnectIRQ connects the IRQ line of the CPU with the given id
+	ConnectIRQ(cpu uint8, irq func(asserted bool))
+}
+
+type mailbox struct {
+	fifo []uint8
+	rang bool
+	irq  func(asserted bool)
+}
+
+// irqChange is a change of an IRQ line. It is recorded while the mutex
+// is held and delivered after it was released, as driving the line may
+// wait for the CPU.
+type irqChange struct {
+	irq      func(asserted bool)
+	asserted bool
+}
+
+// deliver drives the IRQ line, if it is connected
+func (change irqChange) deliver() {
+	if change.irq != nil {
+		change.irq(change.asserted)
+	}
+}
+
+// Mailbox lets CPUs send bytes to each other, interrupt each other and
+// synchronise through test-and-set locks
+type Mailbox struct {
+	// mutex makes the accesses atomic even without bus arbitration
+	mutex     sync.Mutex
+	locks     [mailboxLocks]bool
+	mailboxes []mailbox
+}
+
+// NewMailbox creates a mailbox device for the given number of CPUs
+func NewMailbox(cpus int) *Mailbox {
+	return &Mailbox{
+		mailboxes: make([]mailbox, cpus),
+	}
+}
+
+// ConnectIRQ connects the IRQ line of the CPU with the given id
+func (m *Mailbox) ConnectIRQ(cpu uint8, irq func(asserted bool)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if int(cpu) < len(m.mailboxes) {
+		m.mailboxes[cpu].irq = irq
+	}
+}
+
+func (m *Mailbox) Reset() {
+	Logger.Infof("Mailbox Reset")
+	m.mutex.Lock()
+	m.locks = [mailboxLocks]bool{}
+	changes := make([]irqChange, 0, len(m.mailboxes))
+	for i := range m.mailboxes {
+		m.mailboxes[i].fifo = m.mailboxes[i].fifo[:0]
+		changes = append(changes, m.acknowledge(&m.mailboxes[i]))
+	}
+	m.mutex.Unlock()
+
+	for _, change := range changes {
+		change.deliver()
+	}
+}
+
+func (m *Mailbox) Size() uint32 {
+	return MailboxBlock + uint32(len(m.mailboxes))*mailboxBlockSize
+}
+
+func (m *Mailbox) Read(location uint32) uint8 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if location < MailboxBlock {
+		old := m.locks[location]
+		m.locks[location] = true
+		if old {
+			return 1
+		}
+		return 0
+	}
+
+	box := m.mailbox(location)
+	if box == nil {
+		Logger.Warnf("Mailbox Read: %x", location)
+		return 0
+	}
+	switch (location - MailboxBlock) % mailboxBlockSize {
+	case MailboxData:
+		if len(box.fifo) == 0 {
+			return 0
+		}
+		data := box.fifo[0]
+		box.fifo = box.fifo[1:]
+		return data
+	case MailboxStatus:
+		return uint8(len(box.fifo))
+	case MailboxAck:
+		if box.rang {
+			return 1
+		}
+		return 0
+	default:
+		return 0
+	}
+}
+
+func (m *Mailbox) Write(location uint32, data uint8) {
+	m.write(location, data).deliver()
+}
+
+// write performs the write under the mutex and returns the change of the
+// IRQ line it caused
+func (m *Mailbox) write(location uint32, data uint8) irqChange {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if location < MailboxBlock {
+		m.locks[location] = false
+		return irqChange{}
+	}
+
+	box := m.mailbox(location)
+	if box == nil {
+		Logger.Warnf("Mailbox Write: %x %x", location, data)
+		return irqChange{}
+	}
+	switch (location - MailboxBlock) % mailboxBlockSize {
+	case MailboxData:
+		if len(box.fifo) >= mailboxDepth {
+			Logger.Warnf("Mailbox %d is full, dropping %x", (location-MailboxBlock)/mailboxBlockSize, data)
+			return irqChange{}
+		}
+		box.fifo = append(box.fifo, data)
+	case MailboxDoorbell:
+		if !box.rang {
+			box.rang = true
+			return irqChange{irq: box.irq, asserted: true}
+		}
+	case MailboxAck:
+		return m.acknowledge(box)
+	}
+	return irqChange{}
+}
+
+// mailbox returns the mailbox the location belongs to, nil if there is none
+func (m *Mailbox) mailbox(location uint32) *mailbox {
+	index := (location - MailboxBlock) / mailboxBlockSize
+	if int(index) >= len(m.mailboxes) {
+		return nil
+	}
+	return &m.mailboxes[index]
+}
+
+// acknowledge clears the doorbell of the mailbox and returns the release
+// of its IRQ if the doorbell rang
+func (m *Mailbox) acknowledge(box *mailbox) irqChange {
+	if !box.rang {
+		return irqChange{}
+	}
+	box.rang = false
+	return irqChange{irq: box.irq, asserted: false}
+}
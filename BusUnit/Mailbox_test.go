@@ -0,0 +1,100 @@
+package BusUnit
+
+import (
+	"emu6502/Logger"
+	"testing"
+)
+
+// block returns the location of a register of the mailbox of the CPU
+func block(cpu uint32, register uint32) uint32 {
+	return MailboxBlock + cpu*mailboxBlockSize + register
+}
+
+func TestMailboxFIFO(t *testing.T) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	m := NewMailbox(2)
+	for i := 0; i < mailboxDepth+2; i++ {
+		m.Write(block(1, MailboxData), uint8(i))
+	}
+	if status := m.Read(block(1, MailboxStatus)); status != mailboxDepth {
+		t.Errorf("status of a full mailbox: got %d, expected %d", status, mailboxDepth)
+	}
+	if status := m.Read(block(0, MailboxStatus)); status != 0 {
+		t.Errorf("status of the other mailbox: got %d, expected 0", status)
+	}
+	// Bytes come out in the order they were written, the overflow is dropped
+	for i := 0; i < mailboxDepth; i++ {
+		if data := m.Read(block(1, MailboxData)); data != uint8(i) {
+			t.Fatalf("byte %d: got %d", i, data)
+		}
+	}
+	if data, status := m.Read(block(1, MailboxData)), m.Read(block(1, MailboxStatus)); data != 0 || status != 0 {
+		t.Errorf("empty mailbox: got data %d status %d, expected 0", data, status)
+	}
+
+	m.Write(block(0, MailboxData), 0x42)
+	m.Reset()
+	if status := m.Read(block(0, MailboxStatus)); status != 0 {
+		t.Errorf("status after the reset: got %d, expected 0", status)
+	}
+}
+
+func TestMailboxDoorbell(t *testing.T) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	m := NewMailbox(2)
+	var levels []bool
+	m.ConnectIRQ(1, func(asserted bool) {
+		// The mutex is released before the line is driven
+		_ = m.Read(block(1, MailboxStatus))
+		levels = append(levels, asserted)
+	})
+
+	m.Write(block(1, MailboxDoorbell), 0)
+	m.Write(block(1, MailboxDoorbell), 0)
+	if rang := m.Read(block(1, MailboxAck)); rang != 1 {
+		t.Errorf("the doorbell didn't ring")
+	}
+	if rang := m.Read(block(0, MailboxAck)); rang != 0 {
+		t.Errorf("the doorbell of the other CPU rang")
+	}
+	m.Write(block(1, MailboxAck), 0)
+	m.Write(block(1, MailboxAck), 0)
+	if rang := m.Read(block(1, MailboxAck)); rang != 0 {
+		t.Errorf("the doorbell still rings after the acknowledge")
+	}
+	m.Write(block(1, MailboxDoorbell), 0)
+	m.Reset()
+
+	// Ringing twice or acknowledging twice only changes the line once
+	expected := []bool{true, false, true, false}
+	if len(levels) != len(expected) {
+		t.Fatalf("IRQ levels: got %v, expected %v", levels, expected)
+	}
+	for i := range expected {
+		if levels[i] != expected[i] {
+			t.Fatalf("IRQ levels: got %v, expected %v", levels, expected)
+		}
+	}
+}
+
+func TestMailboxLocks(t *testing.T) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	m := NewMailbox(1)
+	if old := m.Read(MailboxLocks + 3); old != 0 {
+		t.Errorf("first test-and-set: got %d, expected 0", old)
+	}
+	if old := m.Read(MailboxLocks + 3); old != 1 {
+		t.Errorf("second test-and-set: got %d, expected 1", old)
+	}
+	if old := m.Read(MailboxLocks + 4); old != 0 {
+		t.Errorf("other lock: got %d, expected 0", old)
+	}
+	m.Write(MailboxLocks+3, 0)
+	if old := m.Read(MailboxLocks + 3); old != 0 {
+		t.Errorf("test-and-set after the release: got %d, expected 0", old)
+	}
+	m.Reset()
+	if old := m.Read(MailboxLocks + 4); old != 0 {
+		t.Errorf("test-and-set after the reset: got %d, expected 0", old)
+	}
+}
@@ -2,65 +2,60 @@ package BusUnit
 
 import (
 	"emu6502/Logger"
-	"sync"
 )
 
-const ramSize uint32 = 0xFFFF
+const DefaultRAMSize uint32 = 0xFFFF
 
 type RAM struct {
 	// Actual Memory
-	ram [ramSize]uint8
+	ram []uint8
 
-	AddressBus chan AddressBus
-	DataBus    chan DataBus
-
-	halt *sync.WaitGroup
+	// image is copied into the memory on every reset
+	image         []byte
+	imageOffset   uint32
+	imageFilename string
 }
 
 // NewRAM is the constructor for a new Memory
-func NewRAM(wg *sync.WaitGroup) *RAM {
-	wg.Add(1)
+func NewRAM(size uint32) *RAM {
 	return &RAM{
-		ram:        [ramSize]uint8{},
-		AddressBus: make(chan AddressBus),
-		DataBus:    make(chan DataBus),
-		halt:       wg,
+		ram: make([]uint8, size),
 	}
 }
 
+// LoadImage loads the contents of the file at the given offset,
+// after every reset
+func (m *RAM) LoadImage(filename string, offset uint32) {
+	Logger.Infof("Loading RAM image from %s", filename)
+	m.image = readImage(filename)
+	m.imageOffset = offset
+	m.imageFilename = filename
+}
+
 // Reset resets the Memory to its initial state
 func (m *RAM) Reset() {
 	Logger.Infof("RAM Reset")
 	for i := range m.ram {
 		m.ram[i] = 0
 	}
-}
-
-// Run starts with execution of the Memory
-func (m *RAM) Run() {
-	Logger.Infof("RAM Run")
-
-	for command := range m.AddressBus {
-		if command.Rw == 'W' {
-			m.handleMemoryWrite(command.Data, (<-m.DataBus).Data)
-		} else if command.Rw == 'R' {
-			m.DataBus <- DataBus{Data: m.handleMemoryRead(command.Data)}
-		}
+	if m.image != nil {
+		copyImage(m.ram, m.image, m.imageOffset, m.imageFilename)
 	}
-
-	m.halt.Done()
 }
 
-func (m *RAM) Halt() {
-	Logger.Infof("RAM Halt")
-	close(m.AddressBus)
-	close(m.DataBus)
+func (m *RAM) Size() uint32 {
+	return uint32(len(m.ram))
 }
 
-func (m *RAM) handleMemoryWrite(location uint32, data uint8) {
+func (m *RAM) Write(location uint32, data uint8) {
 	m.ram[location] = data
 }
 
-func (m *RAM) handleMemoryRead(location uint32) uint8 {
+func (m *RAM) Read(location uint32) uint8 {
+	return m.ram[location]
+}
+
+// Peek reads like Read, see Memory
+func (m *RAM) Peek(location uint32) uint8 {
 	return m.ram[location]
 }
@@ -2,72 +2,46 @@ package BusUnit
 
 import (
 	logger "emu6502/Logger"
-	"os"
-	"sync"
 )
 
-const romSize uint32 = 0xBFE0
+const DefaultROMSize uint32 = 0xBFE0
 
 type ROM struct {
 	// Actual Memory
-	rom [romSize]uint8
-
-	AddressBus chan AddressBus
-	DataBus    chan DataBus
-
-	halt *sync.WaitGroup
+	rom []uint8
 }
 
 // NewROM is the constructor for a new Memory
-func NewROM(wg *sync.WaitGroup) *ROM {
-	wg.Add(1)
+func NewROM(size uint32) *ROM {
 	return &ROM{
-		rom:        [romSize]uint8{},
-		AddressBus: make(chan AddressBus),
-		DataBus:    make(chan DataBus),
-		halt:       wg,
+		rom: make([]uint8, size),
 	}
 }
 
-func (m *ROM) Reset(filename string) {
+// Load copies the contents of the file into the ROM at the given offset
+func (m *ROM) Load(filename string, offset uint32) {
 	logger.Infof("Loading ROM from %s", filename)
-	_, err := os.Stat(filename)
-	if os.IsNotExist(err) {
-		logger.Fatalf("Please add a '%s' file", filename)
-	}
-
-	bytes, err := os.ReadFile(filename)
-	if err != nil {
-		logger.Fatalf("Cannot read '%s'", filename)
-	}
+	copyImage(m.rom, readImage(filename), offset, filename)
+}
 
+// Reset keeps the contents of the ROM
+func (m *ROM) Reset() {
 	logger.Infof("ROM Reset")
-	copy(m.rom[:], bytes)
 }
 
-// Run starts with execution of the Memory
-func (m *ROM) Run() {
-	logger.Infof("ROM Run")
-	for command := range m.AddressBus {
-		if command.Rw == 'W' {
-			m.handleMemoryWrite(command.Data, (<-m.DataBus).Data)
-		} else if command.Rw == 'R' {
-			m.DataBus <- DataBus{Data: m.handleMemoryRead(command.Data)}
-		}
-	}
-	m.halt.Done()
+func (m *ROM) Size() uint32 {
+	return uint32(len(m.rom))
 }
 
-func (m *ROM) Halt() {
-	logger.Infof("ROM Halt")
-	close(m.AddressBus)
-	close(m.DataBus)
+func (m *ROM) Write(location uint32, data uint8) {
+	logger.Errorf("ROM Write of %X to %X not possible", data, location)
 }
 
-func (m *ROM) handleMemoryWrite(location uint32, data uint8) {
-	logger.Errorf("ROM Write of %X to %X not possible", data, location)
+func (m *ROM) Read(location uint32) uint8 {
+	return m.rom[location]
 }
 
-func (m *ROM) handleMemoryRead(location uint32) uint8 {
+// Peek reads like Read, see Memory
+func (m *ROM) Peek(location uint32) uint8 {
 	return m.rom[location]
 }
@@ -0,0 +1,68 @@
+package BusUnit
+
+import (
+	"emu6502/Logger"
+)
+
+// Registry gives devices a name and an id. The id is the index into the
+// device list, so looking up a device by id is a plain slice access.
+type Registry struct {
+	devices []Device
+	names   []string
+	ids     map[string]uint8
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		ids: make(map[string]uint8),
+	}
+}
+
+// Register adds a device under the given name and returns its id.
+// Ids are handed out in the order the devices are registered.
+func (r *Registry) Register(name string, device Device) uint8 {
+	if _, exists := r.ids[name]; exists {
+		Logger.Fatalf("Device %s is already registered", name)
+	}
+	if len(r.devices) > 0xFF {
+		Logger.Fatalf("Cannot register %s, too many devices", name)
+	}
+
+	id := uint8(len(r.devices))
+	r.devices = append(r.devices, device)
+	r.names = append(r.names, name)
+	r.ids[name] = id
+	return id
+}
+
+// Id returns the id of the device with the given name
+func (r *Registry) Id(name string) (uint8, bool) {
+	id, ok := r.ids[name]
+	return id, ok
+}
+
+// Device returns the device with the given id or nil if there is none
+func (r *Registry) Device(id uint8) Device {
+	if int(id) >= len(r.devices) {
+		return nil
+	}
+	return r.devices[id]
+}
+
+// Name returns the name of the device with the given id
+func (r *Registry) Name(id uint8) string {
+	if int(id) >= len(r.names) {
+		return ""
+	}
+	return r.names[id]
+}
+
+// Len returns the number of registered devices
+func (r *Registry) Len() int {
+	return len(r.devices)
+}
+
+// Devices returns all devices indexed by their id
+func (r *Registry) Devices() []Device {
+	return r.devices
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"emu6502/Assembler"
+	"emu6502/Debugger"
+	"emu6502/Debugger/DAP"
+	"emu6502/Disassembler"
+	"emu6502/Logger"
+	"emu6502/Tracer"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// command is run instead of the emulator if its name is the first
+// argument after the flags
+type command struct {
+	usage string
+	run   func(args []string)
+}
+
+var commands = map[string]command{
+	"asm":    {"assemble an Ophis source file, see asm -h", runAsm},
+	"dap":    {"serve the Debug Adapter Protocol on stdin and stdout", runDAP},
+	"disasm": {"disassemble a ROM file, see disasm -h", runDisasm},
+	"trace":  {"print a binary trace file as text", runTrace},
+}
+
+// usage prints the flags and the commands
+func usage() {
+	output := flag.CommandLine.Output()
+	fmt.Fprintf(output, "Usage: %s [flags] [command [arguments]]\n\nCommands:\n", os.Args[0])
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(output, "  %-8s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintf(output, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// runDAP serves the Debug Adapter Protocol on stdin and stdout. The ROM
+// is chosen by the launch request of the client.
+func runDAP(args []string) {
+	if err := DAP.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+		Logger.Fatalf("DAP: %s", err)
+	}
+}
+
+// runTrace prints a binary trace as text. Operand values aren't part of a
+// binary trace, so they are left out.
+func runTrace(args []string) {
+	if len(args) != 1 {
+		Logger.Fatalf("Usage: trace <file>")
+	}
+	file, err := os.Open(args[0])
+	if err != nil {
+		Logger.Fatalf("Cannot open the trace: %s", err)
+	}
+	defer file.Close()
+	reader, err := Tracer.NewReader(file)
+	if err != nil {
+		Logger.Fatalf("%s: %s", args[0], err)
+	}
+	var symbols *Debugger.Symbols
+	if traceSymbols && *Logger.DebugMappingFile != "" {
+		symbols = Debugger.NewSymbols(Logger.LoadSymbols(*Logger.DebugMappingFile))
+	}
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			Logger.Fatalf("%s: %s", args[0], err)
+		}
+		fmt.Println(record.Text(nil, symbols))
+	}
+}
+
+// runDisasm disassembles a ROM file to stdout
+func runDisasm(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s disasm [flags] <rom file>\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	originPtr := flags.String("origin", fmt.Sprintf("$%04X", Disassembler.DefaultOrigin), "`Address` the first byte of the ROM is mapped at")
+	rangePtr := flags.String("range", "", "Addresses to disassemble, like $4047-$4069 or start:16, the whole ROM if empty")
+	tracePtr := flags.Bool("trace", false, "Follow the code from the reset, NMI and IRQ vectors and print the rest as data")
+	mappingPtr := flags.String("mapping", *Logger.DebugMappingFile, "Path to the mapping `file` with the labels")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	origin, err := Debugger.ParseNumber(*originPtr)
+	if err != nil {
+		Logger.Fatalf("Invalid origin: %s", err)
+	}
+	image, err := Disassembler.LoadImage(flags.Arg(0), origin)
+	if err != nil {
+		Logger.Fatalf("Cannot load the ROM: %s", err)
+	}
+	var symbols *Debugger.Symbols
+	if *mappingPtr != "" {
+		symbols = Debugger.NewSymbols(Logger.LoadSymbols(*mappingPtr))
+	}
+	labels := symbols.Labels()
+
+	start, end := image.Origin, image.End()
+	if *rangePtr != "" {
+		if start, end, err = symbols.ParseRange(*rangePtr); err != nil {
+			Logger.Fatalf("Invalid range: %s", err)
+		}
+	}
+
+	var code *Disassembler.Code
+	if *tracePtr {
+		vectors := image.Vectors()
+		if len(vectors) == 0 {
+			Logger.Fatalf("The ROM doesn't contain the vectors, it ends at $%04X", image.End())
+		}
+		var entries []uint16
+		for _, entry := range vectors {
+			entries = append(entries, entry)
+		}
+		code = Disassembler.Trace(image, entries)
+		labels = Disassembler.TraceLabels(image, code, labels)
+	}
+
+	output := bufio.NewWriter(os.Stdout)
+	if err := Disassembler.Print(output, image, start, end, code, labels); err != nil {
+		Logger.Fatalf("Cannot write the disassembly: %s", err)
+	}
+	if err := output.Flush(); err != nil {
+		Logger.Fatalf("Cannot write the disassembly: %s", err)
+	}
+}
+
+// runAsm assembles a source file into a ROM and optionally a listing and a
+// mapping file
+func runAsm(args []string) {
+	flags := flag.NewFlagSet("asm", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s asm [flags] <source file>\n\nFlags:\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	outputPtr := flags.String("o", "", "Path to the ROM `file`, defaults to the .outfile of the source or its name with .rom")
+	listingPtr := flags.String("l", "", "Path to the listing `file` to write")
+	mappingPtr := flags.String("m", "", "Path to the mapping `file` to write")
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	source := flags.Arg(0)
+	program, err := Assembler.Assemble(source)
+	if err != nil {
+		Logger.Fatalf("Cannot assemble %s: %s", source, err)
+	}
+
+	output := *outputPtr
+	if output == "" {
+		output = program.Outfile
+	}
+	if output == "" {
+		output = strings.TrimSuffix(source, filepath.Ext(source)) + ".rom"
+	}
+	if err := os.WriteFile(output, program.Data, 0644); err != nil {
+		Logger.Fatalf("Cannot write the ROM: %s", err)
+	}
+	if *listingPtr != "" {
+		writeFile(*listingPtr, program.WriteListing)
+	}
+	if *mappingPtr != "" {
+		writeFile(*mappingPtr, program.WriteMapping)
+	}
+}
+
+// writeFile creates a file and fills it with write
+func writeFile(path string, write func(w io.Writer) error) {
+	file, err := os.Create(path)
+	if err != nil {
+		Logger.Fatalf("Cannot create %s: %s", path, err)
+	}
+	output := bufio.NewWriter(file)
+	if err := write(output); err != nil {
+		Logger.Fatalf("Cannot write %s: %s", path, err)
+	}
+	if err := output.Flush(); err != nil {
+		Logger.Fatalf("Cannot write %s: %s", path, err)
+	}
+	if err := file.Close(); err != nil {
+		Logger.Fatalf("Cannot write %s: %s", path, err)
+	}
+}
@@ -1,109 +1,100 @@
 package AddressMode
 
-type AddressMode struct {
-	SelectedMode string
-}
-
-func Accumulator() AddressMode {
-	return AddressMode{"A"}
-}
-
-func IsAccumulator(mode AddressMode) bool {
-	return mode.SelectedMode == "A"
-}
-
-func Absolut() AddressMode {
-	return AddressMode{"abs"}
-}
-
-func IsAbsolut(mode AddressMode) bool {
-	return mode.SelectedMode == "abs"
-}
-
-func AbsolutX() AddressMode {
-	return AddressMode{"abs,X"}
-}
-
-func IsAbsolutX(mode AddressMode) bool {
-	return mode.SelectedMode == "abs,X"
-}
-
-func AbsolutY() AddressMode {
-	return AddressMode{"abs,Y"}
-}
-
-func IsAbsolutY(mode AddressMode) bool {
-	return mode.SelectedMode == "abs,Y"
-}
-
-func Immediate() AddressMode {
-	return AddressMode{"#"}
-}
-
-func IsImmediate(mode AddressMode) bool {
-	return mode.SelectedMode == "#"
-}
-
-func Implied() AddressMode {
-	return AddressMode{"impl"}
-}
-
-func IsImplied(mode AddressMode) bool {
-	return mode.SelectedMode == "impl"
-}
-
-func Indirect() AddressMode {
-	return AddressMode{"ind"}
-}
-
-func IsIndirect(mode AddressMode) bool {
-	return mode.SelectedMode == "ind"
-}
-
-func IndirectX() AddressMode {
-	return AddressMode{"ind,X"}
-}
-
-func IsIndirectX(mode AddressMode) bool {
-	return mode.SelectedMode == "ind,X"
-}
-
-func IndirectY() AddressMode {
-	return AddressMode{"ind,Y"}
-}
-
-func IsIndirectY(mode AddressMode) bool {
-	return mode.SelectedMode == "ind,Y"
-}
-
-func Relative() AddressMode {
-	return AddressMode{"rel"}
-}
-
-func IsRelative(mode AddressMode) bool {
-	return mode.SelectedMode == "rel"
-}
-
-func ZeroPage() AddressMode {
-	return AddressMode{"zpg"}
-}
-
-func IsZeroPage(mode AddressMode) bool {
-	return mode.SelectedMode == "zpg"
-}
-
-func ZeroPageX() AddressMode {
-	return AddressMode{"zpg,X"}
-}
-
-func IsZeroPageX(mode AddressMode) bool {
-	return mode.SelectedMode == "zpg,X"
-}
-
-func ZeroPageY() AddressMode {
-	return AddressMode{"zpg,Y"}
-}
-
-func IsZeroPageY(mode AddressMode) bool {
-	return mode.SelectedMode == "zpg,Y"
+import "fmt"
+
+// AddressMode selects how an instruction finds its operand
+type AddressMode uint8
+
+const (
+	Implied AddressMode = iota
+	Accumulator
+	Immediate
+	ZeroPage
+	ZeroPageX
+	ZeroPageY
+	Absolut
+	AbsolutX
+	AbsolutY
+	Indirect
+	IndirectX
+	IndirectY
+	Relative
+)
+
+// String returns the short name of the addressing mode
+func (mode AddressMode) String() string {
+	switch mode {
+	case Implied:
+		return "impl"
+	case Accumulator:
+		return "A"
+	case Immediate:
+		return "#"
+	case ZeroPage:
+		return "zpg"
+	case ZeroPageX:
+		return "zpg,X"
+	case ZeroPageY:
+		return "zpg,Y"
+	case Absolut:
+		return "abs"
+	case AbsolutX:
+		return "abs,X"
+	case AbsolutY:
+		return "abs,Y"
+	case Indirect:
+		return "ind"
+	case IndirectX:
+		return "ind,X"
+	case IndirectY:
+		return "ind,Y"
+	case Relative:
+		return "rel"
+	default:
+		return fmt.Sprintf("AddressMode(%d)", uint8(mode))
+	}
+}
+
+// Length returns the number of bytes of an instruction using this mode,
+// including the opcode
+func (mode AddressMode) Length() uint8 {
+	switch mode {
+	case Implied, Accumulator:
+		return 1
+	case Absolut, AbsolutX, AbsolutY, Indirect:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// Format formats an operand in assembler syntax.
+// For relative addressing the operand is the branch target.
+func (mode AddressMode) Format(operand uint16) string {
+	switch mode {
+	case Accumulator:
+		return "A"
+	case Immediate:
+		return fmt.Sprintf("#$%02X", operand)
+	case ZeroPage:
+		return fmt.Sprintf("$%02X", operand)
+	case ZeroPageX:
+		return fmt.Sprintf("$%02X,X", operand)
+	case ZeroPageY:
+		return fmt.Sprintf("$%02X,Y", operand)
+	case Absolut, Relative:
+		return fmt.Sprintf("$%04X", operand)
+	case AbsolutX:
+		return fmt.Sprintf("$%04X,X", operand)
+	case AbsolutY:
+		return fmt.Sprintf("$%04X,Y", operand)
+	case Indirect:
+		return fmt.Sprintf("($%04X)", operand)
+	case IndirectX:
+		return fmt.Sprintf("($%02X,X)", operand)
+	case IndirectY:
+		return fmt.Sprintf("($%02X),Y", operand)
+	default:
+		return ""
+	}
 }
@@ -1,18 +1,38 @@
 package CPU
 
 import (
-	"emu6502/ComputeUnit/CPU/AddressMode"
 	"emu6502/ComputeUnit/MMU"
 	"emu6502/Logger"
 	"fmt"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const NMIVector = 0xFFFA
 const ResetVector = 0xFFFC
+const IRQVector = 0xFFFE
 const PerfLogging = false
 
+// breakFlag is bit 4 of the processor status. It only exists on the
+// stack, to tell a BRK apart from a hardware interrupt.
+const breakFlag = 0b00010000
+
+// Variant selects which member of the 6502 family is emulated
+type Variant int
+
+const (
+	// VariantNMOS is the original NMOS 6502
+	VariantNMOS Variant = iota
+	// Variant2A03 is the Ricoh 2A03 used in the NES. It has no decimal mode,
+	// the decimal flag can be set but has no effect on ADC and SBC.
+	Variant2A03
+)
+
+// InstructionHook is called at every instruction boundary, after pending
+// interrupts have been entered and before the next instruction executes
+type InstructionHook func(c *CPU)
+
 type CPU struct {
 	// Program Counter
 	pc uint16
@@ -31,29 +51,47 @@ type CPU struct {
 		zero       bool // Zero Flag
 		intDisable bool // Interrupt Disable
 		decimal    bool // Decimal Mode
-		brk        bool // Break Command
 		overflow   bool // Overflow Flag
 		negative   bool // Negative Flag
 	}
 
 	mmu *MMU.MMU
 
-	nmi   chan bool
-	irq   chan bool
-	clock chan bool
+	variant Variant
+
+	clock clock
 
-	shouldHalt bool
+	// The interrupt lines are driven from other goroutines, so they are
+	// accessed atomically. nmiLine is the level of the NMI line,
+	// nmiPending latches the edge until it is serviced.
+	nmiLine    uint32
+	nmiPending uint32
+	// irqAsserted counts the devices currently pulling the IRQ line low
+	irqAsserted int32
+
+	// hooks are called before every instruction
+	hooks []InstructionHook
+	// brkTrap replaces the BRK interrupt sequence if set
+	brkTrap InstructionHook
+
+	// cycles counts the executed cycles, see Cycles
+	cycles uint64
+	// pageCrossed is set if the indexed address of the current instruction
+	// crossed a page boundary
+	pageCrossed bool
+	// extraCycles collects the penalties of the current instruction
+	extraCycles uint8
+
+	// shouldHalt is set from other goroutines, so it is accessed atomically
+	shouldHalt uint32
 	halt       *sync.WaitGroup
 }
 
 // NewCPU is the constructor for a new CPU
 func NewCPU(mmu *MMU.MMU, wg *sync.WaitGroup) *CPU {
 	return &CPU{
-		mmu:   mmu,
-		nmi:   make(chan bool, 8),
-		irq:   make(chan bool, 8),
-		clock: make(chan bool),
-		halt:  wg,
+		mmu:  mmu,
+		halt: wg,
 	}
 }
 
@@ -61,9 +99,7 @@ func NewCPU(mmu *MMU.MMU, wg *sync.WaitGroup) *CPU {
 func (c *CPU) Reset() {
 	// Stack pointer points to the top of the stack, 0x01FF
 	c.sp = 0xff
-	// Set PC to 0xFFFB so the JMP instruction reads from 0xFFFC and 0xFFFD
-	c.pc = ResetVector - 1
-	c.JMP(AddressMode.Absolut())
+	c.pc = c.GetWordAt(ResetVector)
 	Logger.Infof("CPU Reset")
 	Logger.Debugf(c.ToString())
 }
@@ -75,7 +111,7 @@ func (c *CPU) Run() {
 	if PerfLogging {
 		var amountInstructions int64 = 0
 		tt := time.Now()
-		for !c.shouldHalt {
+		for !c.Halted() {
 			Logger.Debugf("CPU Clock Tick")
 			amountInstructions++
 			if amountInstructions == 1000000 {
@@ -87,334 +123,115 @@ func (c *CPU) Run() {
 				amountInstructions = 0
 				tt = tn
 			}
-			c.executeInstruction()
+			c.Step()
 		}
 	} else {
-		for !c.shouldHalt {
-			if c.ps.brk {
-				Logger.Debugf(c.ToString())
-				Logger.LogDebugInstruction(c.pc)
-				cmd := ""
-				_, _ = fmt.Scanln(&cmd)
-				if strings.Contains(cmd, "c") {
-					c.ps.brk = false
-					Logger.ActiveLogLevel = Logger.LogLevelInfo
-				}
-			}
+		for !c.Halted() {
 			Logger.Debugf("CPU Clock Tick")
-			c.executeInstruction()
+			c.Step()
 		}
 	}
 	c.halt.Done()
 }
 
+// Step executes exactly one instruction, or enters an interrupt handler
+// and executes its first instruction. It is used by Run and by schedulers
+// that interleave several CPUs on one goroutine.
+func (c *CPU) Step() {
+	c.serviceInterrupts()
+	for _, hook := range c.hooks {
+		hook(c)
+	}
+	c.executeInstruction()
+	c.throttle()
+}
+
+// AddInstructionHook registers a hook that is called before every instruction
+func (c *CPU) AddInstructionHook(hook InstructionHook) {
+	c.hooks = append(c.hooks, hook)
+}
+
+// SetBRKTrap makes BRK call trap instead of raising a software interrupt.
+// This is used to let BRK drop into a debugger. Pass nil to restore the
+// normal behaviour.
+func (c *CPU) SetBRKTrap(trap InstructionHook) {
+	c.brkTrap = trap
+}
+
+// SetNMI drives the NMI line. The CPU reacts to the edge from
+// deasserted to asserted, so a device has to release the line
+// before it can trigger another NMI. It never blocks, a halted CPU
+// just doesn't service the line.
+func (c *CPU) SetNMI(asserted bool) {
+	if !asserted {
+		atomic.StoreUint32(&c.nmiLine, 0)
+	} else if atomic.SwapUint32(&c.nmiLine, 1) == 0 {
+		atomic.StoreUint32(&c.nmiPending, 1)
+	}
+}
+
+// SetIRQ asserts or releases the IRQ line on behalf of one device.
+// The line is wired-OR: it stays active as long as any device
+// still asserts it. It never blocks, a halted CPU just doesn't
+// service the line.
+func (c *CPU) SetIRQ(asserted bool) {
+	if asserted {
+		atomic.AddInt32(&c.irqAsserted, 1)
+		return
+	}
+	for {
+		count := atomic.LoadInt32(&c.irqAsserted)
+		if count == 0 || atomic.CompareAndSwapInt32(&c.irqAsserted, count, count-1) {
+			return
+		}
+	}
+}
+
+// serviceInterrupts is called at every instruction boundary and enters
+// the NMI or IRQ handler if one of the lines requests it.
+// NMI has priority over IRQ and can't be masked.
+func (c *CPU) serviceInterrupts() {
+	// Loading first is cheaper than a swap at every instruction
+	if atomic.LoadUint32(&c.nmiPending) != 0 && atomic.CompareAndSwapUint32(&c.nmiPending, 1, 0) {
+		Logger.Debugf("CPU NMI")
+		c.Interrupt(NMIVector)
+		c.addCycles(interruptCycles)
+	} else if atomic.LoadInt32(&c.irqAsserted) > 0 && !c.ps.intDisable {
+		Logger.Debugf("CPU IRQ")
+		c.Interrupt(IRQVector)
+		c.addCycles(interruptCycles)
+	}
+}
+
 func (c *CPU) executeInstruction() {
-	// Normal Execution handling
-	opcode := c.GetByteAt(c.pc)
-	switch opcode {
-	case 0x69:
-		c.ADC(AddressMode.Immediate())
-	case 0x65:
-		c.ADC(AddressMode.ZeroPage())
-	case 0x75:
-		c.ADC(AddressMode.ZeroPageX())
-	case 0x6D:
-		c.ADC(AddressMode.Absolut())
-	case 0x7D:
-		c.ADC(AddressMode.AbsolutX())
-	case 0x79:
-		c.ADC(AddressMode.AbsolutY())
-	case 0x61:
-		c.ADC(AddressMode.IndirectX())
-	case 0x71:
-		c.ADC(AddressMode.IndirectY())
-	case 0x29:
-		c.AND(AddressMode.Immediate())
-	case 0x25:
-		c.AND(AddressMode.ZeroPage())
-	case 0x35:
-		c.AND(AddressMode.ZeroPageX())
-	case 0x2D:
-		c.AND(AddressMode.Absolut())
-	case 0x3D:
-		c.AND(AddressMode.AbsolutX())
-	case 0x39:
-		c.AND(AddressMode.AbsolutY())
-	case 0x21:
-		c.AND(AddressMode.IndirectX())
-	case 0x31:
-		c.AND(AddressMode.IndirectY())
-	case 0x0A:
-		c.ASL(AddressMode.Accumulator())
-	case 0x06:
-		c.ASL(AddressMode.ZeroPage())
-	case 0x16:
-		c.ASL(AddressMode.ZeroPage())
-	case 0x0E:
-		c.ASL(AddressMode.Absolut())
-	case 0x1E:
-		c.ASL(AddressMode.AbsolutX())
-	case 0x90:
-		c.BCC(AddressMode.Relative())
-	case 0xB0:
-		c.BCS(AddressMode.Relative())
-	case 0xF0:
-		c.BEQ(AddressMode.Relative())
-	case 0x24:
-		c.BIT(AddressMode.ZeroPage())
-	case 0x2C:
-		c.BIT(AddressMode.Absolut())
-	case 0x30:
-		c.BMI(AddressMode.Relative())
-	case 0xD0:
-		c.BNE(AddressMode.Relative())
-	case 0x10:
-		c.BPL(AddressMode.Relative())
-	case 0x00:
-		c.BRK(AddressMode.Implied())
-	case 0x50:
-		c.BVC(AddressMode.Relative())
-	case 0x70:
-		c.BVS(AddressMode.Relative())
-	case 0x18:
-		c.CLC(AddressMode.Implied())
-	case 0xD8:
-		c.CLD(AddressMode.Implied())
-	case 0x58:
-		c.CLI(AddressMode.Implied())
-	case 0xB8:
-		c.CLV(AddressMode.Implied())
-	case 0xC9:
-		c.CMP(AddressMode.Immediate())
-	case 0xC5:
-		c.CMP(AddressMode.ZeroPage())
-	case 0xD5:
-		c.CMP(AddressMode.ZeroPageX())
-	case 0xCD:
-		c.CMP(AddressMode.Absolut())
-	case 0xDD:
-		c.CMP(AddressMode.AbsolutX())
-	case 0xD9:
-		c.CMP(AddressMode.AbsolutY())
-	case 0xC1:
-		c.CMP(AddressMode.IndirectX())
-	case 0xD1:
-		c.CMP(AddressMode.IndirectY())
-	case 0xE0:
-		c.CPX(AddressMode.Immediate())
-	case 0xE4:
-		c.CPX(AddressMode.ZeroPage())
-	case 0xEC:
-		c.CPX(AddressMode.Absolut())
-	case 0xC0:
-		c.CPY(AddressMode.Immediate())
-	case 0xC4:
-		c.CPY(AddressMode.ZeroPage())
-	case 0xCC:
-		c.CPY(AddressMode.Absolut())
-	case 0xC6:
-		c.DEC(AddressMode.ZeroPage())
-	case 0xD6:
-		c.DEC(AddressMode.ZeroPageX())
-	case 0xCE:
-		c.DEC(AddressMode.Absolut())
-	case 0xDE:
-		c.DEC(AddressMode.AbsolutX())
-	case 0xCA:
-		c.DEX(AddressMode.Implied())
-	case 0x88:
-		c.DEY(AddressMode.Implied())
-	case 0x49:
-		c.EOR(AddressMode.Immediate())
-	case 0x45:
-		c.EOR(AddressMode.ZeroPage())
-	case 0x55:
-		c.EOR(AddressMode.ZeroPageX())
-	case 0x4D:
-		c.EOR(AddressMode.Absolut())
-	case 0x5D:
-		c.EOR(AddressMode.AbsolutX())
-	case 0x59:
-		c.EOR(AddressMode.AbsolutY())
-	case 0x41:
-		c.EOR(AddressMode.IndirectX())
-	case 0x51:
-		c.EOR(AddressMode.IndirectY())
-	case 0xE6:
-		c.INC(AddressMode.ZeroPage())
-	case 0xF6:
-		c.INC(AddressMode.ZeroPageX())
-	case 0xEE:
-		c.INC(AddressMode.Absolut())
-	case 0xFE:
-		c.INC(AddressMode.AbsolutX())
-	case 0xE8:
-		c.INX(AddressMode.Implied())
-	case 0xC8:
-		c.INY(AddressMode.Implied())
-	case 0x4C:
-		c.JMP(AddressMode.Absolut())
-	case 0x6C:
-		c.JMP(AddressMode.Indirect())
-	case 0x20:
-		c.JSR(AddressMode.Absolut())
-	case 0xA9:
-		c.LDA(AddressMode.Immediate())
-	case 0xA5:
-		c.LDA(AddressMode.ZeroPage())
-	case 0xB5:
-		c.LDA(AddressMode.ZeroPageX())
-	case 0xAD:
-		c.LDA(AddressMode.Absolut())
-	case 0xBD:
-		c.LDA(AddressMode.AbsolutX())
-	case 0xB9:
-		c.LDA(AddressMode.AbsolutY())
-	case 0xA1:
-		c.LDA(AddressMode.IndirectX())
-	case 0xB1:
-		c.LDA(AddressMode.IndirectY())
-	case 0xA2:
-		c.LDX(AddressMode.Immediate())
-	case 0xA6:
-		c.LDX(AddressMode.ZeroPage())
-	case 0xB6:
-		c.LDX(AddressMode.ZeroPageY())
-	case 0xAE:
-		c.LDX(AddressMode.Absolut())
-	case 0xBE:
-		c.LDX(AddressMode.AbsolutY())
-	case 0xA0:
-		c.LDY(AddressMode.Immediate())
-	case 0xA4:
-		c.LDY(AddressMode.ZeroPage())
-	case 0xB4:
-		c.LDY(AddressMode.ZeroPageX())
-	case 0xAC:
-		c.LDY(AddressMode.Absolut())
-	case 0xBC:
-		c.LDY(AddressMode.AbsolutX())
-	case 0x4A:
-		c.LSR(AddressMode.Accumulator())
-	case 0x46:
-		c.LSR(AddressMode.ZeroPage())
-	case 0x56:
-		c.LSR(AddressMode.ZeroPageX())
-	case 0x4E:
-		c.LSR(AddressMode.Absolut())
-	case 0x5E:
-		c.LSR(AddressMode.AbsolutX())
-	case 0xEA:
-		c.NOP(AddressMode.Implied())
-	case 0x09:
-		c.ORA(AddressMode.Immediate())
-	case 0x05:
-		c.ORA(AddressMode.ZeroPage())
-	case 0x15:
-		c.ORA(AddressMode.ZeroPageX())
-	case 0x0D:
-		c.ORA(AddressMode.Absolut())
-	case 0x1D:
-		c.ORA(AddressMode.AbsolutX())
-	case 0x19:
-		c.ORA(AddressMode.AbsolutY())
-	case 0x01:
-		c.ORA(AddressMode.IndirectX())
-	case 0x11:
-		c.ORA(AddressMode.IndirectY())
-	case 0x48:
-		c.PHA(AddressMode.Implied())
-	case 0x08:
-		c.PHP(AddressMode.Implied())
-	case 0x68:
-		c.PLA(AddressMode.Implied())
-	case 0x28:
-		c.PLP(AddressMode.Implied())
-	case 0x2A:
-		c.ROL(AddressMode.Accumulator())
-	case 0x26:
-		c.ROL(AddressMode.ZeroPage())
-	case 0x36:
-		c.ROL(AddressMode.ZeroPageX())
-	case 0x2E:
-		c.ROL(AddressMode.Absolut())
-	case 0x3E:
-		c.ROL(AddressMode.AbsolutX())
-	case 0x6A:
-		c.ROR(AddressMode.Accumulator())
-	case 0x66:
-		c.ROR(AddressMode.ZeroPage())
-	case 0x76:
-		c.ROR(AddressMode.ZeroPageX())
-	case 0x6E:
-		c.ROR(AddressMode.Absolut())
-	case 0x7E:
-		c.ROR(AddressMode.AbsolutX())
-	case 0x40:
-		c.RTI(AddressMode.Implied())
-	case 0x60:
-		c.RTS(AddressMode.Implied())
-	case 0xE9:
-		c.SBC(AddressMode.Immediate())
-	case 0xE5:
-		c.SBC(AddressMode.ZeroPage())
-	case 0xF5:
-		c.SBC(AddressMode.ZeroPageX())
-	case 0xED:
-		c.SBC(AddressMode.Absolut())
-	case 0xFD:
-		c.SBC(AddressMode.AbsolutX())
-	case 0xF9:
-		c.SBC(AddressMode.AbsolutY())
-	case 0xE1:
-		c.SBC(AddressMode.IndirectX())
-	case 0xF1:
-		c.SBC(AddressMode.IndirectY())
-	case 0x38:
-		c.SEC(AddressMode.Implied())
-	case 0xF8:
-		c.SED(AddressMode.Implied())
-	case 0x78:
-		c.SEI(AddressMode.Implied())
-	case 0x85:
-		c.STA(AddressMode.ZeroPage())
-	case 0x95:
-		c.STA(AddressMode.ZeroPageX())
-	case 0x8D:
-		c.STA(AddressMode.Absolut())
-	case 0x9D:
-		c.STA(AddressMode.AbsolutX())
-	case 0x99:
-		c.STA(AddressMode.AbsolutY())
-	case 0x81:
-		c.STA(AddressMode.IndirectX())
-	case 0x91:
-		c.STA(AddressMode.IndirectY())
-	case 0x86:
-		c.STX(AddressMode.ZeroPage())
-	case 0x96:
-		c.STX(AddressMode.ZeroPageY())
-	case 0x8E:
-		c.STX(AddressMode.Absolut())
-	case 0x84:
-		c.STY(AddressMode.ZeroPage())
-	case 0x94:
-		c.STY(AddressMode.ZeroPageX())
-	case 0x8C:
-		c.STY(AddressMode.Absolut())
-	case 0xAA:
-		c.TAX(AddressMode.Implied())
-	case 0xA8:
-		c.TAY(AddressMode.Implied())
-	case 0xBA:
-		c.TSX(AddressMode.Implied())
-	case 0x8A:
-		c.TXA(AddressMode.Implied())
-	case 0x9A:
-		c.TXS(AddressMode.Implied())
-	case 0x98:
-		c.TYA(AddressMode.Implied())
+	opcode, ok := c.fetchByteAt(c.pc)
+	if !ok {
+		// The MMU raised a fault, which is handled before the next instruction
+		c.addCycles(1)
+		return
+	}
+	instruction := &Instructions[opcode]
+	if !instruction.Valid() {
+		Logger.Errorf("Illegal opcode 0x%02X at 0x%04X", opcode, c.pc)
+		c.pc++
+		c.addCycles(2)
+		return
 	}
+
+	c.pageCrossed = false
+	c.extraCycles = 0
+	address := c.resolveAddress(instruction.Mode)
+	if Logger.ActiveLogLevel == Logger.LogLevelDebug {
+		Logger.Debugf("%s %s", instruction.Mnemonic, instruction.Mode)
+	}
+
+	c.pc += uint16(instruction.Bytes)
+	instruction.execute(c, instruction.Mode, address)
+
+	if c.pageCrossed && instruction.PageCrossPenalty {
+		c.extraCycles++
+	}
+	c.addCycles(instruction.Cycles + c.extraCycles)
 }
 
 func (c *CPU) GetPS() uint8 {
@@ -422,7 +239,8 @@ func (c *CPU) GetPS() uint8 {
 	ps[0] = c.ps.negative
 	ps[1] = c.ps.overflow
 	ps[2] = true
-	ps[3] = c.ps.brk
+	// Bit 4 (break) is not a real flag, see breakFlag
+	ps[3] = false
 	ps[4] = c.ps.decimal
 	ps[5] = c.ps.intDisable
 	ps[6] = c.ps.zero
@@ -434,21 +252,38 @@ func (c *CPU) SetPS(newPS uint8) {
 	var ps = ConvertUint8ToBits(newPS)
 	c.ps.negative = ps[0]
 	c.ps.overflow = ps[1]
-	// Bit 3 is hardwired to 1.
-	c.ps.brk = ps[3]
+	// Bit 5 is hardwired to 1, bit 4 is ignored
 	c.ps.decimal = ps[4]
 	c.ps.intDisable = ps[5]
 	c.ps.zero = ps[6]
 	c.ps.carry = ps[7]
 }
 
+// SetVariant selects the emulated member of the 6502 family
+func (c *CPU) SetVariant(variant Variant) {
+	c.variant = variant
+}
+
+// PC returns the current program counter
+func (c *CPU) PC() uint16 {
+	return c.pc
+}
+
 func (c *CPU) ToString() string {
 	return fmt.Sprintf("PC: 0x%04x; SP: 0x%02x; A: 0x%02x; X: 0x%02x; Y: 0x%02x; NV-BDIZC: %08b", c.pc, c.sp, c.a, c.x, c.y, c.GetPS())
 }
 
+// Stop stops the execution of the CPU after the current instruction
+func (c *CPU) Stop() {
+	atomic.StoreUint32(&c.shouldHalt, 1)
+}
+
+// Halted reports whether the CPU has been stopped or halted
+func (c *CPU) Halted() bool {
+	return atomic.LoadUint32(&c.shouldHalt) != 0
+}
+
 func (c *CPU) Halt() {
 	Logger.Infof("CPU Halt")
-	c.shouldHalt = true
-	close(c.nmi)
-	close(c.irq)
+	atomic.StoreUint32(&c.shouldHalt, 1)
 }
@@ -0,0 +1,321 @@
+package CPU_test
+
+import (
+	"emu6502/ComputeUnit"
+	"emu6502/ComputeUnit/CPU"
+	"emu6502/Logger"
+	"emu6502/Machine"
+	"emu6502/Scheduler"
+	"io"
+	"testing"
+	"time"
+)
+
+// helloIRQ is the target of the IRQ vector of hello.rom
+const helloIRQ = 0x4069
+
+// Bits of the processor status
+const (
+	flagC = 0b00000001
+	flagZ = 0b00000010
+	flagI = 0b00000100
+	flagD = 0b00001000
+)
+
+// testCPU is the CPU of a compute unit running hello.rom on the default
+// machine
+type testCPU struct {
+	*CPU.CPU
+	scheduler *Scheduler.Scheduler
+}
+
+// newTestCPU boots the default machine with hello.rom. The GPU output is
+// discarded.
+func newTestCPU(tb testing.TB) *testCPU {
+	tb.Helper()
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	bus, mappings, err := Machine.Boot("../../hello.rom", io.Discard)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	cu := ComputeUnit.NewComputeUnit(bus, mappings, 0)
+	cu.Reset()
+	scheduler, err := Scheduler.NewScheduler([]*ComputeUnit.ComputeUnit{cu}, Scheduler.DefaultConfig())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &testCPU{CPU: cu.CPU(), scheduler: scheduler}
+}
+
+// Step executes one instruction in a round of the scheduler
+func (c *testCPU) Step() {
+	c.scheduler.Step()
+}
+
+func (c *testCPU) sp() uint8 {
+	return c.Registers().SP
+}
+
+func (c *testCPU) flag(flag uint8) bool {
+	return c.GetPS()&flag != 0
+}
+
+func (c *testCPU) setFlag(flag uint8, set bool) {
+	if set {
+		c.SetPS(c.GetPS() | flag)
+	} else {
+		c.SetPS(c.GetPS() &^ flag)
+	}
+}
+
+// load writes a program into the PrivRAM and points the PC at it
+func (c *testCPU) load(address uint16, program ...uint8) {
+	for i, b := range program {
+		c.SetByteAt(address+uint16(i), b)
+	}
+	registers := c.Registers()
+	registers.PC = address
+	c.SetRegisters(registers)
+}
+
+func TestVectors(t *testing.T) {
+	c := newTestCPU(t)
+	if vector := c.GetWordAt(CPU.IRQVector); vector != helloIRQ {
+		t.Fatalf("IRQ vector: got $%04X, expected $%04X", vector, helloIRQ)
+	}
+
+	// BRK
+	c.load(0x0300, 0x00, 0xFF)
+	c.Step()
+	if c.PC() != helloIRQ {
+		t.Errorf("BRK: PC $%04X, expected $%04X", c.PC(), helloIRQ)
+	}
+
+	// IRQ, the handler's first instruction is a NOP
+	c = newTestCPU(t)
+	c.load(0x0300, 0xEA)
+	c.SetIRQ(true)
+	c.Step()
+	if c.PC() != helloIRQ+1 {
+		t.Errorf("IRQ: PC $%04X, expected $%04X", c.PC(), helloIRQ+1)
+	}
+}
+
+func TestSetIRQAfterHalt(t *testing.T) {
+	c := newTestCPU(t)
+	c.Halt()
+	// Devices may still drive the lines of a halted CPU
+	for i := 0; i < 16; i++ {
+		c.SetIRQ(true)
+		c.SetNMI(true)
+	}
+}
+
+func TestInterruptLinesDontBlock(t *testing.T) {
+	c := newTestCPU(t)
+	c.load(0x0300, 0xEA)
+	// More changes than the CPU could have buffered before an instruction
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 64; i++ {
+			c.SetIRQ(true)
+		}
+		for i := 0; i < 63; i++ {
+			c.SetIRQ(false)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("driving the IRQ line blocked")
+	}
+	// One device still asserts the line
+	c.Step()
+	if c.PC() != helloIRQ+1 {
+		t.Errorf("IRQ: PC $%04X, expected $%04X", c.PC(), helloIRQ+1)
+	}
+}
+
+func TestInterruptPriority(t *testing.T) {
+	tests := []struct {
+		name       string
+		intDisable bool
+		irq, nmi   bool
+		pc         uint16
+		sp         uint8
+	}{
+		{"none", false, false, false, 0x0301, 0xFF},
+		{"IRQ", false, true, false, helloIRQ + 1, 0xFC},
+		{"masked IRQ", true, true, false, 0x0301, 0xFF},
+		{"NMI", false, false, true, helloIRQ + 1, 0xFC},
+		{"NMI with I set", true, false, true, helloIRQ + 1, 0xFC},
+		{"NMI and IRQ", false, true, true, helloIRQ + 1, 0xFC},
+	}
+	for _, test := range tests {
+		c := newTestCPU(t)
+		c.load(0x0300, 0xEA)
+		c.setFlag(flagI, test.intDisable)
+		if test.irq {
+			c.SetIRQ(true)
+		}
+		if test.nmi {
+			c.SetNMI(true)
+		}
+		c.Step()
+		if c.PC() != test.pc || c.sp() != test.sp {
+			t.Errorf("%s: PC $%04X SP $%02X, expected PC $%04X SP $%02X", test.name, c.PC(), c.sp(), test.pc, test.sp)
+		}
+		// Entering a handler masks the IRQ. Had the IRQ been taken first,
+		// the NMI would still be pending and push a second frame now.
+		c.Step()
+		if test.sp == 0xFC && c.sp() != 0xFC {
+			t.Errorf("%s: SP $%02X after the handler's second instruction, expected $FC", test.name, c.sp())
+		}
+	}
+
+	// The IRQ is taken once CLI cleared the mask
+	c := newTestCPU(t)
+	c.load(0x0300, 0x58, 0xEA) // CLI, NOP
+	c.setFlag(flagI, true)
+	c.SetIRQ(true)
+	c.Step()
+	if c.PC() != 0x0301 {
+		t.Errorf("masked IRQ: PC $%04X, expected $0301", c.PC())
+	}
+	c.Step()
+	if c.PC() != helloIRQ+1 {
+		t.Errorf("IRQ after CLI: PC $%04X, expected $%04X", c.PC(), helloIRQ+1)
+	}
+}
+
+func TestStackLayout(t *testing.T) {
+	const flags = 0b11001011 // N, V, D, Z and C, but neither U nor B
+	tests := []struct {
+		name  string
+		enter func(c *testCPU)
+		pc    uint16
+		p     uint8
+	}{
+		// BRK skips its signature byte and pushes B and U
+		{"BRK", func(c *testCPU) { c.Step() }, 0x0302, flags | 0b00110000},
+		// Hardware interrupts push U without B
+		{"IRQ", func(c *testCPU) { c.Interrupt(CPU.IRQVector) }, 0x0300, flags | 0b00100000},
+		{"NMI", func(c *testCPU) { c.Interrupt(CPU.NMIVector) }, 0x0300, flags | 0b00100000},
+	}
+	for _, test := range tests {
+		c := newTestCPU(t)
+		c.load(0x0300, 0x00, 0xFF)
+		c.SetPS(flags)
+		test.enter(c)
+		if c.sp() != 0xFC {
+			t.Fatalf("%s: SP $%02X, expected $FC", test.name, c.sp())
+		}
+		p, low, high := c.GetByteAt(0x01FD), c.GetByteAt(0x01FE), c.GetByteAt(0x01FF)
+		if pc := CPU.CombineLowHigh(low, high); pc != test.pc || p != test.p {
+			t.Errorf("%s: pushed PC $%04X P %08b, expected PC $%04X P %08b", test.name, pc, p, test.pc, test.p)
+		}
+		if !c.flag(flagI) {
+			t.Errorf("%s: I is clear in the handler", test.name)
+		}
+
+		// RTI restores everything but B, and doesn't increment the PC
+		c.load(0x0400, 0x40)
+		c.Step()
+		if c.PC() != test.pc || c.sp() != 0xFF || c.GetPS() != flags|0b00100000 {
+			t.Errorf("%s: after RTI PC $%04X SP $%02X P %08b", test.name, c.PC(), c.sp(), c.GetPS())
+		}
+	}
+}
+
+func TestCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		address uint16
+		program []uint8
+		x       uint8
+		zero    bool
+		cycles  uint64
+	}{
+		{"LDA abs,X", 0x0300, []uint8{0xBD, 0x00, 0x03}, 0x10, false, 4},
+		{"LDA abs,X page cross", 0x0300, []uint8{0xBD, 0xF8, 0x03}, 0x10, false, 5},
+		{"STA abs,X page cross", 0x0300, []uint8{0x9D, 0xF8, 0x03}, 0x10, false, 5},
+		{"LDA (zp),Y page cross", 0x0300, []uint8{0xB1, 0x80}, 0, false, 6},
+		{"BNE not taken", 0x0300, []uint8{0xD0, 0x10}, 0, true, 2},
+		{"BNE taken", 0x0300, []uint8{0xD0, 0x10}, 0, false, 3},
+		{"BNE taken page cross", 0x03F0, []uint8{0xD0, 0x10}, 0, false, 4},
+		{"BNE backwards page cross", 0x0300, []uint8{0xD0, 0xF0}, 0, false, 4},
+	}
+	for _, test := range tests {
+		c := newTestCPU(t)
+		// ($80),Y points at $03F8 + Y = $0407
+		c.SetByteAt(0x80, 0xF8)
+		c.SetByteAt(0x81, 0x03)
+		c.load(test.address, test.program...)
+		registers := c.Registers()
+		registers.X, registers.Y = test.x, 0x0F
+		c.SetRegisters(registers)
+		c.setFlag(flagZ, test.zero)
+		before := c.Cycles()
+		c.Step()
+		if cycles := c.Cycles() - before; cycles != test.cycles {
+			t.Errorf("%s: %d cycles, expected %d", test.name, cycles, test.cycles)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		name     string
+		variant  CPU.Variant
+		opcode   uint8
+		a        uint8
+		operand  uint8
+		carry    bool
+		result   uint8
+		carryOut bool
+	}{
+		{"ADC 09+01", CPU.VariantNMOS, 0x69, 0x09, 0x01, false, 0x10, false},
+		{"ADC 58+46+1", CPU.VariantNMOS, 0x69, 0x58, 0x46, true, 0x05, true},
+		{"ADC 99+01", CPU.VariantNMOS, 0x69, 0x99, 0x01, false, 0x00, true},
+		{"SBC 46-12", CPU.VariantNMOS, 0xE9, 0x46, 0x12, true, 0x34, true},
+		{"SBC 40-13", CPU.VariantNMOS, 0xE9, 0x40, 0x13, true, 0x27, true},
+		{"SBC 32-02-1", CPU.VariantNMOS, 0xE9, 0x32, 0x02, false, 0x29, true},
+		{"SBC 12-21", CPU.VariantNMOS, 0xE9, 0x12, 0x21, true, 0x91, false},
+		// The 2A03 ignores the decimal flag
+		{"2A03 ADC 09+01", CPU.Variant2A03, 0x69, 0x09, 0x01, false, 0x0A, false},
+		{"2A03 ADC 58+46+1", CPU.Variant2A03, 0x69, 0x58, 0x46, true, 0x9F, false},
+		{"2A03 SBC 12-21", CPU.Variant2A03, 0xE9, 0x12, 0x21, true, 0xF1, false},
+	}
+	for _, test := range tests {
+		c := newTestCPU(t)
+		c.SetVariant(test.variant)
+		c.load(0x0300, test.opcode, test.operand)
+		registers := c.Registers()
+		registers.A = test.a
+		c.SetRegisters(registers)
+		c.setFlag(flagD, true)
+		c.setFlag(flagC, test.carry)
+		c.Step()
+		if a := c.Registers().A; a != test.result || c.flag(flagC) != test.carryOut {
+			t.Errorf("%s: got $%02X carry %v, expected $%02X carry %v", test.name, a, c.flag(flagC), test.result, test.carryOut)
+		}
+	}
+}
+
+// BenchmarkStep runs hello.rom, which ends in an endless loop, one
+// instruction per iteration
+func BenchmarkStep(b *testing.B) {
+	c := newTestCPU(b)
+	cycles := c.Cycles()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		c.Step()
+	}
+	b.StopTimer()
+	if seconds := time.Since(start).Seconds(); seconds > 0 {
+		b.ReportMetric(float64(c.Cycles()-cycles)/seconds, "cycles/s")
+	}
+}
@@ -0,0 +1,81 @@
+package CPU
+
+import (
+	"emu6502/Logger"
+	"time"
+)
+
+// throttleSlice is the amount of emulated time after which the CPU
+// compares its cycle counter against the wall clock
+const throttleSlice = time.Millisecond
+
+// maxClockLag is how far the CPU may fall behind the wall clock before
+// it stops trying to catch up
+const maxClockLag = 100 * time.Millisecond
+
+// clock paces the cycle counter against real time
+type clock struct {
+	// hz is the emulated clock speed, 0 runs unthrottled
+	hz uint64
+	// sliceCycles is the amount of cycles in one throttleSlice
+	sliceCycles uint64
+	// nextCheck is the cycle count at which the next slice ends
+	nextCheck uint64
+
+	// startTime and startCycles are the reference point of the pacing
+	startTime   time.Time
+	startCycles uint64
+}
+
+// SetClockSpeed sets the emulated clock speed in Hz.
+// A speed of 0 lets the CPU run as fast as possible.
+func (c *CPU) SetClockSpeed(hz uint64) {
+	c.clock = clock{hz: hz}
+	if hz == 0 {
+		Logger.Infof("CPU Clock unthrottled")
+		return
+	}
+	c.clock.sliceCycles = hz * uint64(throttleSlice) / uint64(time.Second)
+	if c.clock.sliceCycles == 0 {
+		c.clock.sliceCycles = 1
+	}
+	Logger.Infof("CPU Clock %d Hz", hz)
+}
+
+// throttle sleeps at the end of every slice until the wall clock has
+// caught up with the emulated time
+func (c *CPU) throttle() {
+	if c.clock.hz == 0 {
+		return
+	}
+	cycles := c.Cycles()
+	if cycles < c.clock.nextCheck {
+		return
+	}
+	c.clock.nextCheck = cycles + c.clock.sliceCycles
+
+	now := time.Now()
+	if c.clock.startTime.IsZero() {
+		c.clock.startTime = now
+		c.clock.startCycles = cycles
+		return
+	}
+
+	emulated := emulatedTime(cycles-c.clock.startCycles, c.clock.hz)
+	ahead := c.clock.startTime.Add(emulated).Sub(now)
+	if ahead > 0 {
+		time.Sleep(ahead)
+	} else if ahead < -maxClockLag {
+		// The host can't keep up, don't try to make up for the lost time
+		c.clock.startTime = now
+		c.clock.startCycles = cycles
+	}
+}
+
+// emulatedTime returns how long the cycles take at the clock speed. Whole
+// seconds are split off first, so the product can't overflow.
+func emulatedTime(cycles uint64, hz uint64) time.Duration {
+	seconds := cycles / hz
+	rest := cycles % hz * uint64(time.Second) / hz
+	return time.Duration(seconds)*time.Second + time.Duration(rest)
+}
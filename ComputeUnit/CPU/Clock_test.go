@@ -0,0 +1,25 @@
+package CPU
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEmulatedTime(t *testing.T) {
+	tests := []struct {
+		cycles, hz uint64
+		expected   time.Duration
+	}{
+		{0, 1000000, 0},
+		{1, 1000000, time.Microsecond},
+		{1500000, 1000000, 1500 * time.Millisecond},
+		{1, 3, 333333333},
+		// cycles * time.Second would overflow a uint64 here
+		{100000000000, 1000000, 100000 * time.Second},
+	}
+	for _, test := range tests {
+		if emulated := emulatedTime(test.cycles, test.hz); emulated != test.expected {
+			t.Errorf("%d cycles at %d Hz: got %s, expected %s", test.cycles, test.hz, emulated, test.expected)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package CPU
+
+import "sync/atomic"
+
+// interruptCycles is the number of cycles the CPU needs to enter an
+// interrupt handler
+const interruptCycles = 7
+
+// Cycles returns the number of cycles the CPU executed since it was created.
+// It is safe to call from other goroutines.
+func (c *CPU) Cycles() uint64 {
+	return atomic.LoadUint64(&c.cycles)
+}
+
+// addCycles advances the cycle counter
+func (c *CPU) addCycles(amount uint8) {
+	atomic.AddUint64(&c.cycles, uint64(amount))
+}
+
+// indexed adds the index to the base address and remembers if a page
+// boundary was crossed
+func (c *CPU) indexed(base uint16, index uint8) uint16 {
+	address := base + uint16(index)
+	c.pageCrossed = base&0xFF00 != address&0xFF00
+	return address
+}
+
+// branchIf continues execution at the target if the condition is true.
+// A taken branch takes one extra cycle, two if the target is in another page.
+func (c *CPU) branchIf(condition bool, target uint16) {
+	if !condition {
+		return
+	}
+	c.extraCycles++
+	if c.pc&0xFF00 != target&0xFF00 {
+		c.extraCycles++
+	}
+	c.pc = target
+}
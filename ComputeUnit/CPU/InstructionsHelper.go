@@ -1,6 +1,7 @@
 package CPU
 
 import (
+	"emu6502/ComputeUnit/CPU/AddressMode"
 	"math/bits"
 	"unsafe"
 )
@@ -35,6 +36,58 @@ func SubtractWithCarry(number1 uint8, number2 uint8, carry bool) (result uint8,
 	return
 }
 
+// AddWithCarryDecimal adds two BCD numbers the way an NMOS 6502 does in decimal mode.
+// The zero flag reflects the binary sum, negative and overflow are taken from the
+// intermediate result after the low nibble has been adjusted.
+// http://www.6502.org/tutorials/decimal_mode.html#A
+func AddWithCarryDecimal(number1 uint8, number2 uint8, carry bool) (result uint8, negative bool, overflow bool, zero bool, newCarry bool) {
+	var c = 0
+	if carry {
+		c = 1
+	}
+
+	low := int(number1&0x0F) + int(number2&0x0F) + c
+	if low >= 0x0A {
+		low = ((low + 0x06) & 0x0F) + 0x10
+	}
+	sum := int(number1&0xF0) + int(number2&0xF0) + low
+
+	// N and V are calculated before the high nibble gets adjusted
+	signedSum := int(Uint8ToInt8(number1&0xF0)) + int(Uint8ToInt8(number2&0xF0)) + low
+	negative = sum&0x80 != 0
+	overflow = signedSum < -128 || signedSum > 127
+
+	if sum >= 0xA0 {
+		sum += 0x60
+	}
+
+	result = uint8(sum)
+	newCarry = sum >= 0x100
+	zero = number1+number2+uint8(c) == 0
+	return
+}
+
+// SubtractWithCarryDecimal subtracts two BCD numbers the way an NMOS 6502 does in
+// decimal mode. Only the result is decimal, the flags are the same as in binary mode.
+// http://www.6502.org/tutorials/decimal_mode.html#A
+func SubtractWithCarryDecimal(number1 uint8, number2 uint8, carry bool) (result uint8) {
+	var c = 0
+	if carry {
+		c = 1
+	}
+
+	low := int(number1&0x0F) - int(number2&0x0F) + c - 1
+	if low < 0 {
+		low = ((low - 0x06) & 0x0F) - 0x10
+	}
+	difference := int(number1&0xF0) - int(number2&0xF0) + low
+	if difference < 0 {
+		difference -= 0x60
+	}
+
+	return uint8(difference)
+}
+
 // RotateRight rotates 8 Bit and the carry bit right
 func RotateRight(accu uint8, carry bool) (uint8, bool) {
 	tmp := uint16(accu)
@@ -68,30 +121,29 @@ func (c *CPU) RotateLeft(value uint8) (result uint8) {
 	return result
 }
 
-// LogicalShiftRight performs a shift right into the Carry
-func LogicalShiftRight(accu uint8, carry bool) (uint8, bool) {
-	tmp := uint16(accu) << 1
-	if carry {
-		tmp += 1
-	}
-
-	carry = tmp&0x100 == 0x100
-	return uint8(tmp), carry
+// LogicalShiftRight shifts right, bit 0 is shifted into the carry
+func LogicalShiftRight(value uint8) (uint8, bool) {
+	return value >> 1, value&0b00000001 == 0b00000001
 }
 
-// LogicalShiftRight performs a shift right into the Carry
+// LogicalShiftRight shifts right, bit 0 is shifted into the carry
 func (c *CPU) LogicalShiftRight(value uint8) (result uint8) {
-	result, c.ps.carry = LogicalShiftRight(value, c.ps.carry)
+	result, c.ps.carry = LogicalShiftRight(value)
 	return result
 }
 
 // SubtractWithCarry subtracts two number with carry
 func (c *CPU) SubtractWithCarry(number1 uint8, number2 uint8) (result uint8) {
-	result, c.ps.overflow, c.ps.carry = SubtractWithCarry(number1, number2, c.ps.carry)
+	carry := c.ps.carry
+	result, c.ps.overflow, c.ps.carry = SubtractWithCarry(number1, number2, carry)
 
 	c.CheckNegativeAndSetFlag(result)
 	c.CheckZeroAndSetFlag(result)
 
+	if c.decimalModeActive() {
+		result = SubtractWithCarryDecimal(number1, number2, carry)
+	}
+
 	return result
 }
 
@@ -106,6 +158,11 @@ func (c *CPU) Compare(number1 uint8, number2 uint8) {
 
 // AddWithCarry adds two numbers with carry
 func (c *CPU) AddWithCarry(number1 uint8, number2 uint8) (result uint8) {
+	if c.decimalModeActive() {
+		result, c.ps.negative, c.ps.overflow, c.ps.zero, c.ps.carry = AddWithCarryDecimal(number1, number2, c.ps.carry)
+		return result
+	}
+
 	// Convert to 16-Bit variables
 	num1Word := uint16(number1)
 	num2Word := uint16(number2)
@@ -131,12 +188,33 @@ func (c *CPU) AddWithCarry(number1 uint8, number2 uint8) (result uint8) {
 	return result
 }
 
+// decimalModeActive checks if ADC and SBC have to calculate in BCD
+func (c *CPU) decimalModeActive() bool {
+	return c.ps.decimal && c.variant != Variant2A03
+}
+
 // ArithmeticShiftLeft performs an ASR and puts the shifted out bit into the carry flag
 func (c *CPU) ArithmeticShiftLeft(number uint8) uint8 {
 	c.ps.carry = number&0b10000000 > 0
 	return number << 1
 }
 
+// readModifyWrite applies the operation to the accumulator or to the byte
+// at the address, depending on the addressing mode, and sets the negative
+// and zero flag according to the result
+func (c *CPU) readModifyWrite(mode AddressMode.AddressMode, address uint16, operation func(value uint8) uint8) {
+	var result uint8
+	if mode == AddressMode.Accumulator {
+		c.a = operation(c.a)
+		result = c.a
+	} else {
+		result = operation(c.GetByteAt(address))
+		c.SetByteAt(address, result)
+	}
+	c.CheckNegativeAndSetFlag(result)
+	c.CheckZeroAndSetFlag(result)
+}
+
 // CheckZeroAndSetFlag checks if the number is zero and sets the flag accordingly
 func (c *CPU) CheckZeroAndSetFlag(number uint8) {
 	c.ps.zero = number == 0
@@ -196,3 +274,13 @@ func (c *CPU) PullWordFromStack() (data uint16) {
 	data = dataLow + dataHigh
 	return data
 }
+
+// Interrupt pushes the PC and the processor status with the break flag
+// cleared, disables further interrupts and continues at the address
+// stored in the given vector
+func (c *CPU) Interrupt(vector uint16) {
+	c.PushWordToStack(c.pc)
+	c.PushToStack(c.GetPS())
+	c.ps.intDisable = true
+	c.pc = c.GetWordAt(vector)
+}
@@ -1,28 +1,21 @@
 package CPU
 
+import "emu6502/ComputeUnit/MMU"
+
 // TODO: Those are just wrapper functions around mmu functions
 //       The CPU Instructions should be refactored to directly access
 //       the mmu.
 
-// GetNextByte returns the byte that is next in Memory according
-// to the PC.
-// Does NOT modify the PC
-func (c *CPU) GetNextByte() uint8 {
-	return c.mmu.GetByteAt(c.pc + 1)
-}
-
-// GetNextWord returns the word that is next in Memory according
-// to the PC
-// Does NOT modify the PC
-func (c *CPU) GetNextWord() uint16 {
-	return c.mmu.GetWordAt(c.pc + 1)
-}
-
 // GetByteAt returns the byte that is in Memory at the given address
 func (c *CPU) GetByteAt(address uint16) uint8 {
 	return c.mmu.GetByteAt(address)
 }
 
+// fetchByteAt reads an opcode, ok is false if the MMU refused the fetch
+func (c *CPU) fetchByteAt(address uint16) (data uint8, ok bool) {
+	return c.mmu.FetchByteAt(address)
+}
+
 // GetWordAt returns the word that is in Memory at the given address
 func (c *CPU) GetWordAt(address uint16) uint16 {
 	return c.mmu.GetWordAt(address)
@@ -38,6 +31,22 @@ func (c *CPU) SetWordAt(address uint16, data uint16) {
 	c.mmu.SetWordAt(address, data)
 }
 
+// PokeByteAt writes memory without permission checks, faults or the
+// access hook, see MMU.PokeByteAt
+func (c *CPU) PokeByteAt(address uint16, data uint8) {
+	c.mmu.PokeByteAt(address, data)
+}
+
+// StoredByteAt reads memory without side effects, see MMU.StoredByteAt
+func (c *CPU) StoredByteAt(address uint16) (uint8, bool) {
+	return c.mmu.StoredByteAt(address)
+}
+
+// SetAccessHook installs a hook that sees every data access of the CPU
+func (c *CPU) SetAccessHook(hook MMU.AccessHook) {
+	c.mmu.SetAccessHook(hook)
+}
+
 // CombineLowHigh combines a Low and a High byte into one Word
 func CombineLowHigh(low uint8, high uint8) (combined uint16) {
 	combined = uint16(high)<<8 + uint16(low)
@@ -0,0 +1,278 @@
+package CPU
+
+import (
+	"emu6502/ComputeUnit/CPU/AddressMode"
+)
+
+// Instruction is one entry of the opcode table
+type Instruction struct {
+	Mnemonic string
+	Mode     AddressMode.AddressMode
+	// Bytes is the length of the instruction including the opcode
+	Bytes uint8
+	// Cycles is the number of cycles without any penalties
+	Cycles uint8
+	// PageCrossPenalty is set if the instruction takes one cycle more
+	// when the indexed address lies in another page than the base address.
+	// Stores and read-modify-write instructions always take the longer path.
+	PageCrossPenalty bool
+
+	execute func(c *CPU, mode AddressMode.AddressMode, address uint16)
+}
+
+// Valid checks if the opcode is an official instruction
+func (i *Instruction) Valid() bool {
+	return i.execute != nil
+}
+
+// op creates a table entry
+func op(mnemonic string, mode AddressMode.AddressMode, cycles uint8, execute func(c *CPU, mode AddressMode.AddressMode, address uint16)) Instruction {
+	return Instruction{
+		Mnemonic: mnemonic,
+		Mode:     mode,
+		Bytes:    mode.Length(),
+		Cycles:   cycles,
+		execute:  execute,
+	}
+}
+
+// opP creates a table entry for an instruction with a page crossing penalty
+func opP(mnemonic string, mode AddressMode.AddressMode, cycles uint8, execute func(c *CPU, mode AddressMode.AddressMode, address uint16)) Instruction {
+	instruction := op(mnemonic, mode, cycles, execute)
+	instruction.PageCrossPenalty = true
+	return instruction
+}
+
+// Instructions is the opcode table with the timings of an NMOS 6502.
+// Entries of illegal opcodes are empty.
+var Instructions = [256]Instruction{
+	0x69: op("ADC", AddressMode.Immediate, 2, (*CPU).ADC),
+	0x65: op("ADC", AddressMode.ZeroPage, 3, (*CPU).ADC),
+	0x75: op("ADC", AddressMode.ZeroPageX, 4, (*CPU).ADC),
+	0x6D: op("ADC", AddressMode.Absolut, 4, (*CPU).ADC),
+	0x7D: opP("ADC", AddressMode.AbsolutX, 4, (*CPU).ADC),
+	0x79: opP("ADC", AddressMode.AbsolutY, 4, (*CPU).ADC),
+	0x61: op("ADC", AddressMode.IndirectX, 6, (*CPU).ADC),
+	0x71: opP("ADC", AddressMode.IndirectY, 5, (*CPU).ADC),
+
+	0x29: op("AND", AddressMode.Immediate, 2, (*CPU).AND),
+	0x25: op("AND", AddressMode.ZeroPage, 3, (*CPU).AND),
+	0x35: op("AND", AddressMode.ZeroPageX, 4, (*CPU).AND),
+	0x2D: op("AND", AddressMode.Absolut, 4, (*CPU).AND),
+	0x3D: opP("AND", AddressMode.AbsolutX, 4, (*CPU).AND),
+	0x39: opP("AND", AddressMode.AbsolutY, 4, (*CPU).AND),
+	0x21: op("AND", AddressMode.IndirectX, 6, (*CPU).AND),
+	0x31: opP("AND", AddressMode.IndirectY, 5, (*CPU).AND),
+
+	0x0A: op("ASL", AddressMode.Accumulator, 2, (*CPU).ASL),
+	0x06: op("ASL", AddressMode.ZeroPage, 5, (*CPU).ASL),
+	0x16: op("ASL", AddressMode.ZeroPageX, 6, (*CPU).ASL),
+	0x0E: op("ASL", AddressMode.Absolut, 6, (*CPU).ASL),
+	0x1E: op("ASL", AddressMode.AbsolutX, 7, (*CPU).ASL),
+
+	0x90: op("BCC", AddressMode.Relative, 2, (*CPU).BCC),
+	0xB0: op("BCS", AddressMode.Relative, 2, (*CPU).BCS),
+	0xF0: op("BEQ", AddressMode.Relative, 2, (*CPU).BEQ),
+
+	0x24: op("BIT", AddressMode.ZeroPage, 3, (*CPU).BIT),
+	0x2C: op("BIT", AddressMode.Absolut, 4, (*CPU).BIT),
+
+	0x30: op("BMI", AddressMode.Relative, 2, (*CPU).BMI),
+	0xD0: op("BNE", AddressMode.Relative, 2, (*CPU).BNE),
+	0x10: op("BPL", AddressMode.Relative, 2, (*CPU).BPL),
+
+	0x00: op("BRK", AddressMode.Implied, 7, (*CPU).BRK),
+
+	0x50: op("BVC", AddressMode.Relative, 2, (*CPU).BVC),
+	0x70: op("BVS", AddressMode.Relative, 2, (*CPU).BVS),
+
+	0x18: op("CLC", AddressMode.Implied, 2, (*CPU).CLC),
+	0xD8: op("CLD", AddressMode.Implied, 2, (*CPU).CLD),
+	0x58: op("CLI", AddressMode.Implied, 2, (*CPU).CLI),
+	0xB8: op("CLV", AddressMode.Implied, 2, (*CPU).CLV),
+
+	0xC9: op("CMP", AddressMode.Immediate, 2, (*CPU).CMP),
+	0xC5: op("CMP", AddressMode.ZeroPage, 3, (*CPU).CMP),
+	0xD5: op("CMP", AddressMode.ZeroPageX, 4, (*CPU).CMP),
+	0xCD: op("CMP", AddressMode.Absolut, 4, (*CPU).CMP),
+	0xDD: opP("CMP", AddressMode.AbsolutX, 4, (*CPU).CMP),
+	0xD9: opP("CMP", AddressMode.AbsolutY, 4, (*CPU).CMP),
+	0xC1: op("CMP", AddressMode.IndirectX, 6, (*CPU).CMP),
+	0xD1: opP("CMP", AddressMode.IndirectY, 5, (*CPU).CMP),
+
+	0xE0: op("CPX", AddressMode.Immediate, 2, (*CPU).CPX),
+	0xE4: op("CPX", AddressMode.ZeroPage, 3, (*CPU).CPX),
+	0xEC: op("CPX", AddressMode.Absolut, 4, (*CPU).CPX),
+
+	0xC0: op("CPY", AddressMode.Immediate, 2, (*CPU).CPY),
+	0xC4: op("CPY", AddressMode.ZeroPage, 3, (*CPU).CPY),
+	0xCC: op("CPY", AddressMode.Absolut, 4, (*CPU).CPY),
+
+	0xC6: op("DEC", AddressMode.ZeroPage, 5, (*CPU).DEC),
+	0xD6: op("DEC", AddressMode.ZeroPageX, 6, (*CPU).DEC),
+	0xCE: op("DEC", AddressMode.Absolut, 6, (*CPU).DEC),
+	0xDE: op("DEC", AddressMode.AbsolutX, 7, (*CPU).DEC),
+
+	0xCA: op("DEX", AddressMode.Implied, 2, (*CPU).DEX),
+	0x88: op("DEY", AddressMode.Implied, 2, (*CPU).DEY),
+
+	0x49: op("EOR", AddressMode.Immediate, 2, (*CPU).EOR),
+	0x45: op("EOR", AddressMode.ZeroPage, 3, (*CPU).EOR),
+	0x55: op("EOR", AddressMode.ZeroPageX, 4, (*CPU).EOR),
+	0x4D: op("EOR", AddressMode.Absolut, 4, (*CPU).EOR),
+	0x5D: opP("EOR", AddressMode.AbsolutX, 4, (*CPU).EOR),
+	0x59: opP("EOR", AddressMode.AbsolutY, 4, (*CPU).EOR),
+	0x41: op("EOR", AddressMode.IndirectX, 6, (*CPU).EOR),
+	0x51: opP("EOR", AddressMode.IndirectY, 5, (*CPU).EOR),
+
+	0xE6: op("INC", AddressMode.ZeroPage, 5, (*CPU).INC),
+	0xF6: op("INC", AddressMode.ZeroPageX, 6, (*CPU).INC),
+	0xEE: op("INC", AddressMode.Absolut, 6, (*CPU).INC),
+	0xFE: op("INC", AddressMode.AbsolutX, 7, (*CPU).INC),
+
+	0xE8: op("INX", AddressMode.Implied, 2, (*CPU).INX),
+	0xC8: op("INY", AddressMode.Implied, 2, (*CPU).INY),
+
+	0x4C: op("JMP", AddressMode.Absolut, 3, (*CPU).JMP),
+	0x6C: op("JMP", AddressMode.Indirect, 5, (*CPU).JMP),
+
+	0x20: op("JSR", AddressMode.Absolut, 6, (*CPU).JSR),
+
+	0xA9: op("LDA", AddressMode.Immediate, 2, (*CPU).LDA),
+	0xA5: op("LDA", AddressMode.ZeroPage, 3, (*CPU).LDA),
+	0xB5: op("LDA", AddressMode.ZeroPageX, 4, (*CPU).LDA),
+	0xAD: op("LDA", AddressMode.Absolut, 4, (*CPU).LDA),
+	0xBD: opP("LDA", AddressMode.AbsolutX, 4, (*CPU).LDA),
+	0xB9: opP("LDA", AddressMode.AbsolutY, 4, (*CPU).LDA),
+	0xA1: op("LDA", AddressMode.IndirectX, 6, (*CPU).LDA),
+	0xB1: opP("LDA", AddressMode.IndirectY, 5, (*CPU).LDA),
+
+	0xA2: op("LDX", AddressMode.Immediate, 2, (*CPU).LDX),
+	0xA6: op("LDX", AddressMode.ZeroPage, 3, (*CPU).LDX),
+	0xB6: op("LDX", AddressMode.ZeroPageY, 4, (*CPU).LDX),
+	0xAE: op("LDX", AddressMode.Absolut, 4, (*CPU).LDX),
+	0xBE: opP("LDX", AddressMode.AbsolutY, 4, (*CPU).LDX),
+
+	0xA0: op("LDY", AddressMode.Immediate, 2, (*CPU).LDY),
+	0xA4: op("LDY", AddressMode.ZeroPage, 3, (*CPU).LDY),
+	0xB4: op("LDY", AddressMode.ZeroPageX, 4, (*CPU).LDY),
+	0xAC: op("LDY", AddressMode.Absolut, 4, (*CPU).LDY),
+	0xBC: opP("LDY", AddressMode.AbsolutX, 4, (*CPU).LDY),
+
+	0x4A: op("LSR", AddressMode.Accumulator, 2, (*CPU).LSR),
+	0x46: op("LSR", AddressMode.ZeroPage, 5, (*CPU).LSR),
+	0x56: op("LSR", AddressMode.ZeroPageX, 6, (*CPU).LSR),
+	0x4E: op("LSR", AddressMode.Absolut, 6, (*CPU).LSR),
+	0x5E: op("LSR", AddressMode.AbsolutX, 7, (*CPU).LSR),
+
+	0xEA: op("NOP", AddressMode.Implied, 2, (*CPU).NOP),
+
+	0x09: op("ORA", AddressMode.Immediate, 2, (*CPU).ORA),
+	0x05: op("ORA", AddressMode.ZeroPage, 3, (*CPU).ORA),
+	0x15: op("ORA", AddressMode.ZeroPageX, 4, (*CPU).ORA),
+	0x0D: op("ORA", AddressMode.Absolut, 4, (*CPU).ORA),
+	0x1D: opP("ORA", AddressMode.AbsolutX, 4, (*CPU).ORA),
+	0x19: opP("ORA", AddressMode.AbsolutY, 4, (*CPU).ORA),
+	0x01: op("ORA", AddressMode.IndirectX, 6, (*CPU).ORA),
+	0x11: opP("ORA", AddressMode.IndirectY, 5, (*CPU).ORA),
+
+	0x48: op("PHA", AddressMode.Implied, 3, (*CPU).PHA),
+	0x08: op("PHP", AddressMode.Implied, 3, (*CPU).PHP),
+	0x68: op("PLA", AddressMode.Implied, 4, (*CPU).PLA),
+	0x28: op("PLP", AddressMode.Implied, 4, (*CPU).PLP),
+
+	0x2A: op("ROL", AddressMode.Accumulator, 2, (*CPU).ROL),
+	0x26: op("ROL", AddressMode.ZeroPage, 5, (*CPU).ROL),
+	0x36: op("ROL", AddressMode.ZeroPageX, 6, (*CPU).ROL),
+	0x2E: op("ROL", AddressMode.Absolut, 6, (*CPU).ROL),
+	0x3E: op("ROL", AddressMode.AbsolutX, 7, (*CPU).ROL),
+
+	0x6A: op("ROR", AddressMode.Accumulator, 2, (*CPU).ROR),
+	0x66: op("ROR", AddressMode.ZeroPage, 5, (*CPU).ROR),
+	0x76: op("ROR", AddressMode.ZeroPageX, 6, (*CPU).ROR),
+	0x6E: op("ROR", AddressMode.Absolut, 6, (*CPU).ROR),
+	0x7E: op("ROR", AddressMode.AbsolutX, 7, (*CPU).ROR),
+
+	0x40: op("RTI", AddressMode.Implied, 6, (*CPU).RTI),
+	0x60: op("RTS", AddressMode.Implied, 6, (*CPU).RTS),
+
+	0xE9: op("SBC", AddressMode.Immediate, 2, (*CPU).SBC),
+	0xE5: op("SBC", AddressMode.ZeroPage, 3, (*CPU).SBC),
+	0xF5: op("SBC", AddressMode.ZeroPageX, 4, (*CPU).SBC),
+	0xED: op("SBC", AddressMode.Absolut, 4, (*CPU).SBC),
+	0xFD: opP("SBC", AddressMode.AbsolutX, 4, (*CPU).SBC),
+	0xF9: opP("SBC", AddressMode.AbsolutY, 4, (*CPU).SBC),
+	0xE1: op("SBC", AddressMode.IndirectX, 6, (*CPU).SBC),
+	0xF1: opP("SBC", AddressMode.IndirectY, 5, (*CPU).SBC),
+
+	0x38: op("SEC", AddressMode.Implied, 2, (*CPU).SEC),
+	0xF8: op("SED", AddressMode.Implied, 2, (*CPU).SED),
+	0x78: op("SEI", AddressMode.Implied, 2, (*CPU).SEI),
+
+	0x85: op("STA", AddressMode.ZeroPage, 3, (*CPU).STA),
+	0x95: op("STA", AddressMode.ZeroPageX, 4, (*CPU).STA),
+	0x8D: op("STA", AddressMode.Absolut, 4, (*CPU).STA),
+	0x9D: op("STA", AddressMode.AbsolutX, 5, (*CPU).STA),
+	0x99: op("STA", AddressMode.AbsolutY, 5, (*CPU).STA),
+	0x81: op("STA", AddressMode.IndirectX, 6, (*CPU).STA),
+	0x91: op("STA", AddressMode.IndirectY, 6, (*CPU).STA),
+
+	0x86: op("STX", AddressMode.ZeroPage, 3, (*CPU).STX),
+	0x96: op("STX", AddressMode.ZeroPageY, 4, (*CPU).STX),
+	0x8E: op("STX", AddressMode.Absolut, 4, (*CPU).STX),
+
+	0x84: op("STY", AddressMode.ZeroPage, 3, (*CPU).STY),
+	0x94: op("STY", AddressMode.ZeroPageX, 4, (*CPU).STY),
+	0x8C: op("STY", AddressMode.Absolut, 4, (*CPU).STY),
+
+	0xAA: op("TAX", AddressMode.Implied, 2, (*CPU).TAX),
+	0xA8: op("TAY", AddressMode.Implied, 2, (*CPU).TAY),
+	0xBA: op("TSX", AddressMode.Implied, 2, (*CPU).TSX),
+	0x8A: op("TXA", AddressMode.Implied, 2, (*CPU).TXA),
+	0x9A: op("TXS", AddressMode.Implied, 2, (*CPU).TXS),
+	0x98: op("TYA", AddressMode.Implied, 2, (*CPU).TYA),
+}
+
+// resolveAddress calculates the effective address of the operand of the
+// instruction at the PC. Immediate operands resolve to the address of the
+// operand byte, relative operands to the branch target.
+func (c *CPU) resolveAddress(mode AddressMode.AddressMode) uint16 {
+	switch mode {
+	case AddressMode.Immediate:
+		return c.pc + 1
+	case AddressMode.ZeroPage:
+		return uint16(c.GetByteAt(c.pc + 1))
+	case AddressMode.ZeroPageX:
+		return uint16(c.GetByteAt(c.pc+1) + c.x)
+	case AddressMode.ZeroPageY:
+		return uint16(c.GetByteAt(c.pc+1) + c.y)
+	case AddressMode.Absolut:
+		return c.GetWordAt(c.pc + 1)
+	case AddressMode.AbsolutX:
+		return c.indexed(c.GetWordAt(c.pc+1), c.x)
+	case AddressMode.AbsolutY:
+		return c.indexed(c.GetWordAt(c.pc+1), c.y)
+	case AddressMode.Indirect:
+		// The NMOS 6502 doesn't carry into the high byte of the pointer,
+		// JMP ($10FF) reads the high byte of the target from $1000
+		pointer := c.GetWordAt(c.pc + 1)
+		low := c.GetByteAt(pointer)
+		high := c.GetByteAt(pointer&0xFF00 | uint16(uint8(pointer)+1))
+		return CombineLowHigh(low, high)
+	case AddressMode.IndirectX:
+		return c.getZeroPageWord(c.GetByteAt(c.pc+1) + c.x)
+	case AddressMode.IndirectY:
+		return c.indexed(c.getZeroPageWord(c.GetByteAt(c.pc+1)), c.y)
+	case AddressMode.Relative:
+		offset := Uint8ToInt8(c.GetByteAt(c.pc + 1))
+		return uint16(int32(c.pc) + 2 + int32(offset))
+	default:
+		return 0
+	}
+}
+
+// getZeroPageWord reads a pointer from the zero page, wrapping around
+// at the end of the page
+func (c *CPU) getZeroPageWord(address uint8) uint16 {
+	return CombineLowHigh(c.GetByteAt(uint16(address)), c.GetByteAt(uint16(address+1)))
+}
@@ -0,0 +1,57 @@
+package CPU
+
+import (
+	"fmt"
+)
+
+// Registers is a snapshot of the registers of the CPU, used by debuggers
+type Registers struct {
+	A  uint8
+	X  uint8
+	Y  uint8
+	SP uint8
+	PC uint16
+	// P is the processor status as returned by GetPS: bit 5 is set and
+	// the break flag is clear. PHP and BRK push it with the break flag set.
+	P uint8
+}
+
+// Registers returns a snapshot of the registers
+func (c *CPU) Registers() Registers {
+	return Registers{
+		A:  c.a,
+		X:  c.x,
+		Y:  c.y,
+		SP: c.sp,
+		PC: c.pc,
+		P:  c.GetPS(),
+	}
+}
+
+// SetRegisters overwrites all registers. It must only be called while
+// the CPU isn't executing an instruction, e.g. from an instruction hook.
+func (c *CPU) SetRegisters(registers Registers) {
+	c.a = registers.A
+	c.x = registers.X
+	c.y = registers.Y
+	c.sp = registers.SP
+	c.pc = registers.PC
+	c.SetPS(registers.P)
+}
+
+// FlagsString formats the processor status like "NV-BDIZC" with the
+// letters of cleared flags replaced by dots
+func FlagsString(p uint8) string {
+	const names = "NV-BDIZC"
+	flags := []byte(names)
+	for i := 0; i < 8; i++ {
+		if p&(0x80>>i) == 0 && names[i] != '-' {
+			flags[i] = '.'
+		}
+	}
+	return string(flags)
+}
+
+func (r Registers) String() string {
+	return fmt.Sprintf("PC: $%04X  A: $%02X  X: $%02X  Y: $%02X  SP: $%02X  P: $%02X %s", r.PC, r.A, r.X, r.Y, r.SP, r.P, FlagsString(r.P))
+}
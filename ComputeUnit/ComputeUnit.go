@@ -9,41 +9,100 @@ import (
 )
 
 type ComputeUnit struct {
+	id  uint8
 	cpu *CPU.CPU
 	mmu *MMU.MMU
 
 	wg *sync.WaitGroup
 }
 
-func NewComputeUnit(busUnit *BusUnit.BusUnit) *ComputeUnit {
+// NewComputeUnit creates a CPU with its own MMU, using the given mappings
+// to access the devices of the bus.
+// The id can be read by the CPU from the MMU registers.
+func NewComputeUnit(busUnit *BusUnit.BusUnit, mappings []*MMU.Mapping, id uint8) *ComputeUnit {
 	wg := sync.WaitGroup{}
-	mappings := MMU.DefaultMappings()
 
-	connections := make([]*BusUnit.Connection, 3)
-	connections[MMU.RamId] = &BusUnit.Connection{AddressBus: &busUnit.RAM.AddressBus, DataBus: &busUnit.RAM.DataBus}
-	connections[MMU.RomId] = &BusUnit.Connection{AddressBus: &busUnit.ROM.AddressBus, DataBus: &busUnit.ROM.DataBus}
-	connections[MMU.GpuId] = &BusUnit.Connection{AddressBus: &busUnit.GPU.AddressBus, DataBus: &busUnit.GPU.DataBus}
-	mmu := MMU.NewMMU(mappings, connections)
+	mmu := MMU.NewMMU(mappings, busUnit.Devices)
+	mmu.SetCPU(id, busUnit.Arbiter())
 	cpu := CPU.NewCPU(mmu, &wg)
-	wg.Add(1)
+	busUnit.ConnectIRQ(id, cpu.SetIRQ)
 
 	return &ComputeUnit{
+		id:  id,
 		cpu: cpu,
 		mmu: mmu,
 		wg:  &wg,
 	}
 }
 
+// Id returns the id of the compute unit
+func (cu *ComputeUnit) Id() uint8 {
+	return cu.id
+}
+
+// CPU returns the CPU of the compute unit
+func (cu *ComputeUnit) CPU() *CPU.CPU {
+	return cu.cpu
+}
+
 func (cu *ComputeUnit) Reset() {
 	Logger.Infof("ComputeUnit Reset")
+	cu.mmu.Reset()
 	cu.cpu.Reset()
 }
 
+// Run lets the CPU run freely in its own goroutine
 func (cu *ComputeUnit) Run() {
+	cu.wg.Add(1)
 	go cu.cpu.Run()
 }
 
+// Wait blocks until the CPU started by Run has stopped
+func (cu *ComputeUnit) Wait() {
+	cu.wg.Wait()
+}
+
+// Step executes one instruction on the calling goroutine
+func (cu *ComputeUnit) Step() {
+	cu.cpu.Step()
+}
+
+// Halted reports whether the CPU has stopped
+func (cu *ComputeUnit) Halted() bool {
+	return cu.cpu.Halted()
+}
+
 func (cu *ComputeUnit) Halt() {
 	cu.cpu.Halt()
 	cu.wg.Wait()
 }
+
+// SetIRQ asserts or releases the IRQ line of the CPU
+func (cu *ComputeUnit) SetIRQ(asserted bool) {
+	cu.cpu.SetIRQ(asserted)
+}
+
+// SetNMI drives the NMI line of the CPU
+func (cu *ComputeUnit) SetNMI(asserted bool) {
+	cu.cpu.SetNMI(asserted)
+}
+
+// Cycles returns the number of cycles the CPU has executed
+func (cu *ComputeUnit) Cycles() uint64 {
+	return cu.cpu.Cycles()
+}
+
+// SetClockSpeed sets the emulated clock speed in Hz, 0 runs unthrottled
+func (cu *ComputeUnit) SetClockSpeed(hz uint64) {
+	cu.cpu.SetClockSpeed(hz)
+}
+
+// SetVariant selects the emulated member of the 6502 family
+func (cu *ComputeUnit) SetVariant(variant CPU.Variant) {
+	cu.cpu.SetVariant(variant)
+}
+
+// SetFaultPolicy selects how MMU faults are delivered to the CPU
+func (cu *ComputeUnit) SetFaultPolicy(policy MMU.FaultPolicy) {
+	cu.mmu.SetFaultPolicy(policy, cu.cpu)
+}
@@ -0,0 +1,68 @@
+package MMU
+
+// pageSize is the granularity of the translation cache
+const pageSize = 0x100
+
+// page caches the mappings of one page of the address space. Most pages
+// are covered by a single mapping, or by none. Only pages that are
+// split between mappings need a table entry for every byte.
+type page struct {
+	mapping *Mapping
+	fine    *[pageSize]*Mapping
+}
+
+// translationCache maps every page of the address space to its mappings
+type translationCache [0x10000 / pageSize]page
+
+// newTranslationCache builds the cache for the given mappings
+func newTranslationCache(mappings []*Mapping) *translationCache {
+	cache := &translationCache{}
+	for number := range cache {
+		start := uint32(number) * pageSize
+		end := start + pageSize
+
+		var covering *Mapping
+		split := false
+		for _, mapping := range mappings {
+			mappingStart, mappingEnd := uint32(mapping.virtStart), uint32(mapping.virtStart)+uint32(mapping.size)
+			if mappingStart >= end || mappingEnd <= start {
+				continue
+			}
+			if mappingStart <= start && mappingEnd >= end {
+				covering = mapping
+			} else {
+				split = true
+			}
+		}
+
+		if !split {
+			cache[number].mapping = covering
+			continue
+		}
+		fine := &[pageSize]*Mapping{}
+		for offset := range fine {
+			fine[offset] = lookupLinear(mappings, uint16(start)+uint16(offset))
+		}
+		cache[number].fine = fine
+	}
+	return cache
+}
+
+// lookup returns the mapping that contains the address
+func (cache *translationCache) lookup(address uint16) *Mapping {
+	p := &cache[address/pageSize]
+	if p.fine != nil {
+		return p.fine[address%pageSize]
+	}
+	return p.mapping
+}
+
+// lookupLinear searches the mappings for the one that contains the address
+func lookupLinear(mappings []*Mapping, address uint16) *Mapping {
+	for _, mapping := range mappings {
+		if address >= mapping.virtStart && uint32(address) < uint32(mapping.virtStart)+uint32(mapping.size) {
+			return mapping
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package MMU
+
+import (
+	"emu6502/Logger"
+	"fmt"
+	"strings"
+)
+
+// Permission bits of a mapping
+const (
+	PermRead    = 0b001
+	PermWrite   = 0b010
+	PermExecute = 0b100
+	PermAll     = PermRead | PermWrite | PermExecute
+)
+
+// Reasons for an access fault, as latched in RegFaultReason
+const (
+	FaultNone     = 0x00
+	FaultUnmapped = 0x01
+	FaultRead     = 0x02
+	FaultWrite    = 0x03
+	FaultExecute  = 0x04
+)
+
+// FaultPolicy decides what happens when an access violates the mappings
+type FaultPolicy int
+
+const (
+	// FaultLog logs the fault and carries on, reads return 0 and writes are dropped
+	FaultLog FaultPolicy = iota
+	// FaultTrapIRQ latches the fault and asserts the IRQ line until it is acknowledged
+	FaultTrapIRQ
+	// FaultTrapNMI latches the fault and triggers an NMI
+	FaultTrapNMI
+	// FaultHalt latches the fault and stops the CPU
+	FaultHalt
+)
+
+// FaultTarget is the CPU that gets notified about faults
+type FaultTarget interface {
+	SetIRQ(asserted bool)
+	SetNMI(asserted bool)
+	Stop()
+}
+
+// ParsePermissions converts a string like "rwx" or "r-x" into permission bits
+func ParsePermissions(text string) (uint8, error) {
+	var permissions uint8
+	for _, char := range strings.ToLower(text) {
+		switch char {
+		case 'r':
+			permissions |= PermRead
+		case 'w':
+			permissions |= PermWrite
+		case 'x':
+			permissions |= PermExecute
+		case '-':
+		default:
+			return 0, fmt.Errorf("invalid permission %q", char)
+		}
+	}
+	return permissions, nil
+}
+
+// permissionsToString converts permission bits into a string like "r-x"
+func permissionsToString(permissions uint8) string {
+	result := []byte("---")
+	if permissions&PermRead != 0 {
+		result[0] = 'r'
+	}
+	if permissions&PermWrite != 0 {
+		result[1] = 'w'
+	}
+	if permissions&PermExecute != 0 {
+		result[2] = 'x'
+	}
+	return string(result)
+}
+
+// SetFaultPolicy selects how faults are delivered to the target
+func (m *MMU) SetFaultPolicy(policy FaultPolicy, target FaultTarget) {
+	m.faultPolicy = policy
+	m.faultTarget = target
+}
+
+// fault handles an access that violates the mappings. It returns true
+// if the access has to be aborted, false if the CPU should carry on.
+func (m *MMU) fault(address uint16, reason uint8) bool {
+	switch reason {
+	case FaultUnmapped:
+		Logger.Errorf("Access to unmapped memory: 0x%04X", address)
+	case FaultRead:
+		Logger.Errorf("Read from protected memory: 0x%04X", address)
+	case FaultWrite:
+		Logger.Errorf("Write to protected memory: 0x%04X", address)
+	case FaultExecute:
+		Logger.Errorf("Execution of protected memory: 0x%04X", address)
+	}
+
+	if m.faultPolicy == FaultLog || m.faultTarget == nil {
+		return false
+	}
+
+	// Only the first fault is latched until it is acknowledged
+	if m.faultReason != FaultNone {
+		return true
+	}
+	m.faultAddress = address
+	m.faultReason = reason
+
+	switch m.faultPolicy {
+	case FaultTrapIRQ:
+		m.faultTarget.SetIRQ(true)
+	case FaultTrapNMI:
+		m.faultTarget.SetNMI(true)
+	case FaultHalt:
+		Logger.Errorf("MMU: Halting CPU after fault at 0x%04X", address)
+		m.faultTarget.Stop()
+	}
+	return true
+}
+
+// acknowledgeFault clears the latched fault and releases the interrupt line
+func (m *MMU) acknowledgeFault() {
+	if m.faultReason == FaultNone {
+		return
+	}
+	m.faultReason = FaultNone
+
+	switch m.faultPolicy {
+	case FaultTrapIRQ:
+		m.faultTarget.SetIRQ(false)
+	case FaultTrapNMI:
+		m.faultTarget.SetNMI(false)
+	}
+}
@@ -0,0 +1,44 @@
+package MMU
+
+import "emu6502/BusUnit"
+
+// AccessHook is called for every data access of the CPU, after a byte was
+// read and before a byte is written. Opcode fetches are not reported.
+type AccessHook func(address uint16, data uint8, write bool)
+
+// SetAccessHook installs the hook, nil removes it
+func (m *MMU) SetAccessHook(hook AccessHook) {
+	m.accessHook = hook
+}
+
+// PokeByteAt writes a byte like SetByteAt, but without checking the
+// permissions, raising faults or calling the access hook
+func (m *MMU) PokeByteAt(address uint16, data uint8) {
+	mapping := m.lookup(address)
+	if mapping == nil {
+		return
+	}
+	m.write(mapping, mapping.physStart+uint32(address-mapping.virtStart), data)
+}
+
+// StoredByteAt reads a byte without any side effects. ok is false if the
+// address is unmapped or belongs to a device that isn't BusUnit.Memory,
+// like the GPU or the MMU registers.
+func (m *MMU) StoredByteAt(address uint16) (data uint8, ok bool) {
+	mapping := m.lookup(address)
+	if mapping == nil {
+		return 0, false
+	}
+	memory, ok := m.devices[mapping.backingStore].(BusUnit.Memory)
+	if !ok {
+		return 0, false
+	}
+	physicalAddress := mapping.physStart + uint32(address-mapping.virtStart)
+	if mapping.backingStore <= MmuId || m.arbiter == nil {
+		return memory.Peek(physicalAddress), true
+	}
+	m.arbiter.Lock()
+	data = memory.Peek(physicalAddress)
+	m.arbiter.Unlock()
+	return data, true
+}
@@ -5,149 +5,442 @@ import (
 	"emu6502/ComputeUnit/PrivRAM"
 	"emu6502/Logger"
 	"fmt"
+	"sync"
 )
 
+// Every MMU registers its own PrivRAM and register window before the
+// devices of the bus, so they always get these ids
 const (
-	RamId = iota
-	RomId
-	GpuId
+	PrivramId = iota
 	MmuId
-	PrivramId
 )
 
-const mappingSize = 2 + 4 + 2 + 1
+const (
+	PrivramName = "privram"
+	MmuName     = "mmu"
+)
+
+const mappingSize = 2 + 4 + 2 + 1 + 1
 
 type Mapping struct {
 	virtStart uint16
 	physStart uint32
 	size      uint16
 
+	// device is the name of the backing store, backingStore its id
+	device       string
 	backingStore uint8
-}
 
-func getByteFromMapping(mappings []*Mapping, addr uint32) uint8 {
-	// get number of mapping from addr and mapping size
-	mappingNum := addr / mappingSize
-	// get offset from addr
-	offset := addr % mappingSize
-
-	// get mapping
-	mapping := mappings[mappingNum]
+	// permissions is a combination of PermRead, PermWrite and PermExecute
+	permissions uint8
+}
 
+// getByte returns the byte at the given offset of the register layout of the mapping
+func (m *Mapping) getByte(offset uint32) uint8 {
 	switch offset {
 	case 0:
-		return uint8(mapping.virtStart)
+		return uint8(m.virtStart)
 	case 1:
-		return uint8(mapping.virtStart >> 8)
+		return uint8(m.virtStart >> 8)
 	case 2:
-		return uint8(mapping.physStart)
+		return uint8(m.physStart)
 	case 3:
-		return uint8(mapping.physStart >> 8)
+		return uint8(m.physStart >> 8)
 	case 4:
-		return uint8(mapping.physStart >> 16)
+		return uint8(m.physStart >> 16)
 	case 5:
-		return uint8(mapping.physStart >> 24)
+		return uint8(m.physStart >> 24)
 	case 6:
-		return uint8(mapping.size)
+		return uint8(m.size)
 	case 7:
-		return uint8(mapping.size >> 8)
+		return uint8(m.size >> 8)
 	case 8:
-		return mapping.backingStore
+		return m.backingStore
+	case 9:
+		return m.permissions
 	default:
-		Logger.Warnf("MMU: getByteFromMapping: invalid offset %d", offset)
+		Logger.Warnf("MMU: getByte: invalid offset %d", offset)
 		return 0
 	}
 }
 
+// setByte sets the byte at the given offset of the register layout of the mapping
+func (m *Mapping) setByte(offset uint32, data uint8) {
+	switch offset {
+	case 0:
+		m.virtStart = m.virtStart&0xFF00 | uint16(data)
+	case 1:
+		m.virtStart = m.virtStart&0x00FF | uint16(data)<<8
+	case 2, 3, 4, 5:
+		shift := (offset - 2) * 8
+		m.physStart = m.physStart&^(0xFF<<shift) | uint32(data)<<shift
+	case 6:
+		m.size = m.size&0xFF00 | uint16(data)
+	case 7:
+		m.size = m.size&0x00FF | uint16(data)<<8
+	case 8:
+		m.backingStore = data
+	case 9:
+		m.permissions = data & PermAll
+	default:
+		Logger.Warnf("MMU: setByte: invalid offset %d", offset)
+	}
+}
+
 func (m *Mapping) ToString() string {
-	return fmt.Sprintf("Mapping: virtStart: 0x%04x, physStart: 0x%04x, size: 0x%04x, backingStore: %d", m.virtStart, m.physStart, m.size, m.backingStore)
+	return fmt.Sprintf("Mapping: virtStart: 0x%04x, physStart: 0x%04x, size: 0x%04x, backingStore: %s (%d), permissions: %s", m.virtStart, m.physStart, m.size, m.device, m.backingStore, permissionsToString(m.permissions))
 }
 
-func NewMapping(virtStart uint16, physStart uint32, size uint16, backingStore uint8) *Mapping {
-	return &Mapping{virtStart, physStart, size, backingStore}
+// NewMapping maps size bytes starting at virtStart to the device with the given name
+func NewMapping(virtStart uint16, physStart uint32, size uint16, device string, permissions uint8) *Mapping {
+	return &Mapping{virtStart: virtStart, physStart: physStart, size: size, device: device, permissions: permissions}
 }
 
-func DefaultMappings() []*Mapping {
-	return []*Mapping{
-		NewMapping(0x0000, 0x0000, 0x2000, PrivramId),
-		NewMapping(0x2000, 0x0000, 0x1FE0, RamId),
-		NewMapping(0x3FE0, 0x0000, 0x0020, MmuId),
-		NewMapping(0x4000, 0x0000, 0x0020, GpuId),
-		NewMapping(0x4020, 0x0000, 0xBFDF, RomId),
-	}
+// MappingError describes why a set of mappings is invalid
+type MappingError struct {
+	// Index is the index of the invalid mapping
+	Index int
+	// Other is the index of the mapping it conflicts with, -1 if there is none
+	Other   int
+	Message string
+}
+
+func (e *MappingError) Error() string {
+	return e.Message
 }
 
 // verifyMapping checks that there are no overlay mappings
-func verifyMapping(mappings []*Mapping) {
+func verifyMapping(mappings []*Mapping) *MappingError {
 	for i := 0; i < len(mappings); i++ {
 		for j := i + 1; j < len(mappings); j++ {
-			if mappings[i].virtStart <= mappings[j].virtStart &&
-				mappings[i].virtStart+mappings[i].size > mappings[j].virtStart {
-				Logger.Fatalf("Overlapping mappings: \n%s\n%s", mappings[i].ToString(), mappings[j].ToString())
+			startI, endI := uint32(mappings[i].virtStart), uint32(mappings[i].virtStart)+uint32(mappings[i].size)
+			startJ, endJ := uint32(mappings[j].virtStart), uint32(mappings[j].virtStart)+uint32(mappings[j].size)
+			if startI < endJ && startJ < endI {
+				return &MappingError{
+					Index:   j,
+					Other:   i,
+					Message: fmt.Sprintf("Overlapping mappings: \n%s\n%s", mappings[i].ToString(), mappings[j].ToString()),
+				}
 			}
 		}
 	}
+	return nil
+}
+
+// ValidateMappings checks that the mappings don't overlap, only use the
+// given devices and that PrivRAM is mapped at the first block only,
+// covering the zero page and the stack.
+// nil deviceNames skips the check of the device names.
+func ValidateMappings(mappings []*Mapping, deviceNames []string) error {
+	if len(mappings) == 0 || mappings[0].device != PrivramName {
+		return &MappingError{Index: 0, Other: -1, Message: "PrivRAM must be the first mapping"}
+	}
+	// The zero page and the stack live in the PrivRAM
+	if mappings[0].virtStart != 0 || mappings[0].size < 0x200 {
+		return &MappingError{Index: 0, Other: -1, Message: "PrivRAM must cover the zero page and the stack"}
+	}
+
+	// check that privram is only mapped once
+	for i := 1; i < len(mappings); i++ {
+		if mappings[i].device == PrivramName {
+			return &MappingError{Index: i, Other: -1, Message: "PrivRAM must only be mapped at first block"}
+		}
+	}
+
+	for i, mapping := range mappings {
+		known := deviceNames == nil || mapping.device == PrivramName || mapping.device == MmuName
+		for _, name := range deviceNames {
+			known = known || name == mapping.device
+		}
+		if !known {
+			return &MappingError{Index: i, Other: -1, Message: fmt.Sprintf("Unknown backing store: %s", mapping.device)}
+		}
+	}
+
+	if err := verifyMapping(mappings); err != nil {
+		return err
+	}
+	return nil
 }
 
 type MMU struct {
-	connections []*BusUnit.Connection
-	privRAM     *PrivRAM.PrivRAM
-	mappings    []*Mapping
+	// id is the id of the CPU the MMU belongs to
+	id uint8
+	// arbiter is held during every access to a device of the bus,
+	// nil if the bus isn't shared
+	arbiter sync.Locker
+
+	registry  *BusUnit.Registry
+	devices   []BusUnit.Device
+	privRAM   *PrivRAM.PrivRAM
+	registers *registers
+
+	// contexts are the address spaces of the MMU, mappings is the active
+	// one. A context is replaced as a whole whenever a mapping changes.
+	// Every context starts with the same PrivRAM mapping.
+	contexts [][]*Mapping
+	active   int
+	mappings []*Mapping
+	// cache translates addresses of the active context, nil if it has
+	// to be rebuilt
+	cache *translationCache
+	// initialMappings are restored as the only context on reset
+	initialMappings []*Mapping
+
+	faultPolicy  FaultPolicy
+	faultTarget  FaultTarget
+	faultAddress uint16
+	faultReason  uint8
+
+	// accessHook is called for every data access, see SetAccessHook
+	accessHook AccessHook
 }
 
-func NewMMU(mappings []*Mapping, connections []*BusUnit.Connection) *MMU {
-	if mappings == nil {
-		mappings = DefaultMappings()
+// NewMMU creates a MMU that can access the devices of the bus.
+// The backing stores of the mappings are resolved by their names.
+func NewMMU(mappings []*Mapping, bus *BusUnit.Registry) *MMU {
+	// Several MMUs can be created from the same mappings
+	copied := make([]*Mapping, len(mappings))
+	for i, mapping := range mappings {
+		clone := *mapping
+		copied[i] = &clone
 	}
+	mappings = copied
 
-	verifyMapping(mappings)
+	deviceNames := make([]string, bus.Len())
+	for id := range deviceNames {
+		deviceNames[id] = bus.Name(uint8(id))
+	}
+	if err := ValidateMappings(mappings, deviceNames); err != nil {
+		Logger.Fatalf("%s", err)
+	}
 
-	if mappings[0].backingStore != PrivramId {
-		Logger.Fatalf("PrivRAM must be the first mapping")
+	m := &MMU{
+		registry: BusUnit.NewRegistry(),
+		privRAM:  PrivRAM.NewPrivRAM(mappings[0].size),
 	}
+	m.registers = &registers{mmu: m}
 
-	// check that privram is only mapped once
-	for i := 1; i < len(mappings); i++ {
-		if mappings[i].backingStore == PrivramId {
-			Logger.Fatalf("PrivRAM must only be mapped at first block")
+	m.registry.Register(PrivramName, m.privRAM)
+	m.registry.Register(MmuName, m.registers)
+	for id := 0; id < bus.Len(); id++ {
+		m.registry.Register(bus.Name(uint8(id)), bus.Device(uint8(id)))
+	}
+	m.devices = m.registry.Devices()
+
+	for _, mapping := range mappings {
+		mapping.backingStore, _ = m.registry.Id(mapping.device)
+		if err := m.checkSize(mapping); err != nil {
+			Logger.Fatalf("%s", err)
 		}
 	}
+	m.initialMappings = mappings
+	m.resetContexts()
+
+	return m
+}
+
+// SetCPU sets the id of the CPU the MMU belongs to and the lock that
+// arbitrates the accesses to the shared devices of the bus
+func (m *MMU) SetCPU(id uint8, arbiter sync.Locker) {
+	m.id = id
+	m.arbiter = arbiter
+}
+
+// read reads from the backing store of the mapping
+func (m *MMU) read(mapping *Mapping, physicalAddress uint32) uint8 {
+	// PrivRAM and the registers are private, everything else is shared
+	if mapping.backingStore <= MmuId || m.arbiter == nil {
+		return m.devices[mapping.backingStore].Read(physicalAddress)
+	}
+	m.arbiter.Lock()
+	data := m.devices[mapping.backingStore].Read(physicalAddress)
+	m.arbiter.Unlock()
+	return data
+}
+
+// write writes to the backing store of the mapping
+func (m *MMU) write(mapping *Mapping, physicalAddress uint32, data uint8) {
+	if mapping.backingStore <= MmuId || m.arbiter == nil {
+		m.devices[mapping.backingStore].Write(physicalAddress, data)
+		return
+	}
+	m.arbiter.Lock()
+	m.devices[mapping.backingStore].Write(physicalAddress, data)
+	m.arbiter.Unlock()
+}
+
+// Reset restores the mappings the MMU was created with and clears
+// the PrivRAM and the registers
+func (m *MMU) Reset() {
+	Logger.Infof("MMU Reset")
+	m.resetContexts()
+	m.privRAM.Reset()
+	m.registers.Reset()
+	m.acknowledgeFault()
+}
+
+// checkSize checks that the mapping doesn't exceed its backing store
+func (m *MMU) checkSize(mapping *Mapping) error {
+	device := m.registry.Device(mapping.backingStore)
+	if device == nil {
+		return fmt.Errorf("Unknown backing store: %d", mapping.backingStore)
+	}
+	if sized, ok := device.(BusUnit.Sized); ok && uint64(mapping.physStart)+uint64(mapping.size) > uint64(sized.Size()) {
+		return fmt.Errorf("Mapping exceeds the size of %s: %s", mapping.device, mapping.ToString())
+	}
+	return nil
+}
+
+// resetContexts makes the initial mappings the only context
+func (m *MMU) resetContexts() {
+	m.contexts = [][]*Mapping{m.initialMappings}
+	m.active = 0
+	m.setActiveMappings(m.initialMappings)
+}
+
+// Contexts returns the number of contexts
+func (m *MMU) Contexts() int {
+	return len(m.contexts)
+}
+
+// ActiveContext returns the index of the active context
+func (m *MMU) ActiveContext() int {
+	return m.active
+}
+
+// SwitchContext makes the context with the given index the active one.
+// All following accesses use its mappings.
+func (m *MMU) SwitchContext(context int) error {
+	if context < 0 || context >= len(m.contexts) {
+		return fmt.Errorf("Context %d doesn't exist", context)
+	}
+	m.active = context
+	m.setActiveMappings(m.contexts[context])
+	return nil
+}
+
+// CloneContext adds a copy of the given context and returns its index
+func (m *MMU) CloneContext(context int) (int, error) {
+	if context < 0 || context >= len(m.contexts) {
+		return 0, fmt.Errorf("Context %d doesn't exist", context)
+	}
+	if len(m.contexts) > 0xFF {
+		return 0, fmt.Errorf("Too many contexts")
+	}
+	// Mappings are never modified in place, so they can be shared
+	mappings := make([]*Mapping, len(m.contexts[context]))
+	copy(mappings, m.contexts[context])
+	m.contexts = append(m.contexts, mappings)
+	return len(m.contexts) - 1, nil
+}
+
+// replaceMapping replaces the mapping at the given index of the context,
+// an index one past the last mapping appends it. The mappings are only
+// changed if the result is valid.
+func (m *MMU) replaceMapping(context int, index int, mapping *Mapping) error {
+	if context < 0 || context >= len(m.contexts) {
+		return fmt.Errorf("Context %d doesn't exist", context)
+	}
+	current := m.contexts[context]
+	if index > len(current) {
+		return fmt.Errorf("Mapping %d doesn't exist", index)
+	}
+	if uint32(mapping.virtStart)+uint32(mapping.size) > 0x10000 {
+		return fmt.Errorf("Mapping exceeds the address space: %s", mapping.ToString())
+	}
+
+	mapping.device = m.registry.Name(mapping.backingStore)
+	if err := m.checkSize(mapping); err != nil {
+		return err
+	}
+
+	mappings := make([]*Mapping, len(current), len(current)+1)
+	copy(mappings, current)
+	if index == len(mappings) {
+		mappings = append(mappings, mapping)
+	} else {
+		mappings[index] = mapping
+	}
+
+	if err := ValidateMappings(mappings, nil); err != nil {
+		return err
+	}
+	if mappings[0].physStart != 0 || mappings[0].size != current[0].size {
+		return fmt.Errorf("PrivRAM cannot be moved or resized")
+	}
 
-	return &MMU{
-		connections: connections,
-		privRAM:     PrivRAM.NewPrivRAM(mappings[0].size),
-		mappings:    mappings,
+	m.contexts[context] = mappings
+	if context == m.active {
+		m.setActiveMappings(mappings)
 	}
+	return nil
+}
+
+// lookup returns the mapping that contains the address, nil if it is unmapped
+func (m *MMU) lookup(address uint16) *Mapping {
+	if m.cache == nil {
+		m.cache = newTranslationCache(m.mappings)
+	}
+	return m.cache.lookup(address)
+}
+
+// setActiveMappings replaces the mappings that are used for accesses
+// and invalidates the translation cache
+func (m *MMU) setActiveMappings(mappings []*Mapping) {
+	m.mappings = mappings
+	m.cache = nil
+}
+
+// access checks the permissions of the mapping that contains the address.
+// It returns the mapping, or nil if the access faulted.
+func (m *MMU) access(address uint16, permission uint8, reason uint8) *Mapping {
+	mapping := m.lookup(address)
+	if mapping == nil {
+		m.fault(address, FaultUnmapped)
+		return nil
+	}
+	if mapping.permissions&permission == 0 {
+		if m.fault(address, reason) {
+			return nil
+		}
+	}
+	return mapping
 }
 
 // GetByteAt returns the byte that is in Memory at the given address
 func (m *MMU) GetByteAt(address uint16) uint8 {
-	for _, mapping := range m.mappings {
-		if address >= mapping.virtStart && address < mapping.virtStart+mapping.size {
-			switch mapping.backingStore {
-			case PrivramId:
-				result := m.privRAM.Read(address)
-				return result
-			case RamId:
-				fallthrough
-			case RomId:
-				fallthrough
-			case GpuId:
-				physicalAddress := m.convertVirtualAddressIntoPhysicalAddress(address)
-				*m.connections[mapping.backingStore].AddressBus <- BusUnit.AddressBus{Rw: 'R', Data: physicalAddress}
-				result := (<-*m.connections[mapping.backingStore].DataBus).Data
-				return result
-			case MmuId:
-				physicalAddress := m.convertVirtualAddressIntoPhysicalAddress(address)
-				getByteFromMapping(m.mappings, physicalAddress)
-			default:
-				Logger.Fatalf("Unknown backing store: %d", mapping.backingStore)
-			}
-		}
+	mapping := m.access(address, PermRead, FaultRead)
+	if mapping == nil {
+		return 0
+	}
+	physicalAddress := mapping.physStart + uint32(address-mapping.virtStart)
+	data := m.read(mapping, physicalAddress)
+	if m.accessHook != nil {
+		m.accessHook(address, data, false)
 	}
+	return data
+}
 
-	Logger.Errorf("Read from unmapped memory: 0x%04X", address)
-	return 0
+// FetchByteAt reads an opcode from the given address. It checks the
+// execute permission instead of the read permission. ok is false if the
+// fetch faulted and the instruction must not be executed.
+func (m *MMU) FetchByteAt(address uint16) (data uint8, ok bool) {
+	mapping := m.lookup(address)
+	if mapping == nil || mapping.permissions&PermExecute == 0 {
+		reason := uint8(FaultExecute)
+		if mapping == nil {
+			reason = FaultUnmapped
+		}
+		if m.fault(address, reason) {
+			return 0, false
+		}
+		if mapping == nil {
+			return 0, true
+		}
+	}
+	physicalAddress := mapping.physStart + uint32(address-mapping.virtStart)
+	return m.read(mapping, physicalAddress), true
 }
 
 // GetWordAt reads a word from the given address
@@ -158,32 +451,15 @@ func (m *MMU) GetWordAt(address uint16) uint16 {
 
 // SetByteAt writes the given byte to the given address
 func (m *MMU) SetByteAt(address uint16, data uint8) {
-	for _, mapping := range m.mappings {
-		if address >= mapping.virtStart && address < mapping.virtStart+mapping.size {
-			switch mapping.backingStore {
-			case PrivramId:
-				m.privRAM.Write(address, data)
-				return
-			case RomId:
-				Logger.Errorf("Attempt to write to ROM: 0x%04X", address)
-				return
-			case RamId:
-				fallthrough
-			case GpuId:
-				physicalAddress := m.convertVirtualAddressIntoPhysicalAddress(address)
-				*m.connections[mapping.backingStore].AddressBus <- BusUnit.AddressBus{Rw: 'W', Data: physicalAddress}
-				*m.connections[mapping.backingStore].DataBus <- BusUnit.DataBus{Data: data}
-				return
-			case MmuId:
-				Logger.Errorf("Writing to MMU not implemented")
-				return
-			default:
-				Logger.Fatalf("Unknown backing store: %d", mapping.backingStore)
-			}
-		}
+	mapping := m.access(address, PermWrite, FaultWrite)
+	if mapping == nil {
+		return
 	}
-
-	Logger.Errorf("Write to unmapped memory: 0x%04X, %d", address, data)
+	if m.accessHook != nil {
+		m.accessHook(address, data, true)
+	}
+	physicalAddress := mapping.physStart + uint32(address-mapping.virtStart)
+	m.write(mapping, physicalAddress, data)
 }
 
 // SetWordAt writes the given word to the given address
@@ -192,16 +468,3 @@ func (m *MMU) SetWordAt(address uint16, data uint16) {
 	m.SetByteAt(address+1, uint8(data>>8))
 	m.SetByteAt(address, uint8(data))
 }
-
-// convertVirtualAddressIntoPhysicalAddress converts a virtual address into a physical address
-// virtual address should be mapped.
-func (m *MMU) convertVirtualAddressIntoPhysicalAddress(address uint16) uint32 {
-	for _, mapping := range m.mappings {
-		if address >= mapping.virtStart && address < mapping.virtStart+mapping.size {
-			return mapping.physStart + uint32(address-mapping.virtStart)
-		}
-	}
-
-	Logger.Fatalf("Virtual address not mapped")
-	return 0
-}
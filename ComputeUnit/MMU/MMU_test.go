@@ -0,0 +1,123 @@
+package MMU_test
+
+import (
+	"emu6502/ComputeUnit/MMU"
+	"emu6502/Logger"
+	"emu6502/Machine"
+	"io"
+	"testing"
+)
+
+// newTestMMU creates an MMU for the devices of the default machine.
+// nil selects the mappings of the default machine.
+func newTestMMU(tb testing.TB, mappings []*MMU.Mapping) *MMU.MMU {
+	tb.Helper()
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	bus, defaultMappings, err := Machine.Boot("../../hello.rom", io.Discard)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if mappings == nil {
+		mappings = defaultMappings
+	}
+	return MMU.NewMMU(mappings, bus.Devices)
+}
+
+// fragmentedMappings splits the RAM window into many small mappings,
+// so a linear search has to look at a lot of them
+func fragmentedMappings() []*MMU.Mapping {
+	mappings := []*MMU.Mapping{MMU.NewMapping(0x0000, 0x0000, 0x2000, MMU.PrivramName, MMU.PermAll)}
+	for i := uint16(0); i < 0x1F; i++ {
+		mappings = append(mappings, MMU.NewMapping(0x2000+i*0x100, uint32(i)*0x100, 0x100, "ram", MMU.PermAll))
+	}
+	return append(mappings,
+		MMU.NewMapping(0x3FE0, 0x0000, 0x0020, MMU.MmuName, MMU.PermRead|MMU.PermWrite),
+		MMU.NewMapping(0x4000, 0x0000, 0x0020, "gpu", MMU.PermRead|MMU.PermWrite),
+		MMU.NewMapping(0x4020, 0x0000, 0xBFE0, "rom", MMU.PermRead|MMU.PermExecute),
+	)
+}
+
+func TestTranslationCacheMatchesLinearLookup(t *testing.T) {
+	for _, mappings := range [][]*MMU.Mapping{nil, fragmentedMappings()} {
+		m := newTestMMU(t, mappings)
+		for address := 0; address <= 0xFFFF; address++ {
+			if cached, linear := m.Lookup(uint16(address)), m.LookupLinear(uint16(address)); cached != linear {
+				t.Fatalf("0x%04X: cached %v, linear %v", address, cached, linear)
+			}
+		}
+	}
+}
+
+func TestTranslationCacheIsInvalidated(t *testing.T) {
+	m := newTestMMU(t, nil)
+	m.SetByteAt(0x2000, 0xAA)
+
+	// Move the RAM window by one page
+	m.SetByteAt(0x3FE0+MMU.RegSelect, 1)
+	m.SetByteAt(0x3FE0+MMU.RegControl, MMU.CommandLoad)
+	m.SetByteAt(0x3FE0+MMU.RegMapping+3, 0x01)
+	m.SetByteAt(0x3FE0+MMU.RegControl, MMU.CommandCommit)
+	if status := m.GetByteAt(0x3FE0 + MMU.RegControl); status != MMU.StatusOk {
+		t.Fatalf("commit failed with status %d", status)
+	}
+	if data := m.GetByteAt(0x2000); data != 0x00 {
+		t.Errorf("read 0x%02X from the moved window, expected 0x00", data)
+	}
+
+	// Reset restores the initial mappings
+	m.Reset()
+	if data := m.GetByteAt(0x2000); data != 0xAA {
+		t.Errorf("read 0x%02X after reset, expected 0xAA", data)
+	}
+}
+
+// tightLoop mimics the accesses of a small loop: opcode fetches from ROM,
+// a zero page counter, the stack and a store to RAM
+var tightLoop = []uint16{0x4020, 0x4021, 0x0010, 0x4022, 0x01FF, 0x4023, 0x2100, 0x4024, 0x4025}
+
+func benchmarkLookup(b *testing.B, mappings []*MMU.Mapping, lookup func(m *MMU.MMU, address uint16) *MMU.Mapping) {
+	m := newTestMMU(b, mappings)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, address := range tightLoop {
+			if lookup(m, address) == nil {
+				b.Fatalf("0x%04X is unmapped", address)
+			}
+		}
+	}
+}
+
+func cachedLookup(m *MMU.MMU, address uint16) *MMU.Mapping {
+	return m.Lookup(address)
+}
+
+func linearLookup(m *MMU.MMU, address uint16) *MMU.Mapping {
+	return m.LookupLinear(address)
+}
+
+func BenchmarkLookupLinear(b *testing.B) {
+	benchmarkLookup(b, nil, linearLookup)
+}
+
+func BenchmarkLookupCached(b *testing.B) {
+	benchmarkLookup(b, nil, cachedLookup)
+}
+
+func BenchmarkLookupLinearFragmented(b *testing.B) {
+	benchmarkLookup(b, fragmentedMappings(), linearLookup)
+}
+
+func BenchmarkLookupCachedFragmented(b *testing.B) {
+	benchmarkLookup(b, fragmentedMappings(), cachedLookup)
+}
+
+func BenchmarkTightLoop(b *testing.B) {
+	m := newTestMMU(b, fragmentedMappings())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.FetchByteAt(0x4020)
+		m.SetByteAt(0x0010, m.GetByteAt(0x0010)+1)
+		m.FetchByteAt(0x4022)
+		m.SetByteAt(0x2100, m.GetByteAt(0x01FF))
+	}
+}
@@ -0,0 +1,160 @@
+package MMU
+
+import (
+	"emu6502/Logger"
+)
+
+// Layout of the register window of the MMU.
+// A mapping is edited by selecting it, loading it into the staging
+// registers, changing them and committing them again. Committing the
+// mapping at index Count appends a new mapping. Select, count and the
+// commands work on the context in RegEditContext, which doesn't have
+// to be the active one.
+const (
+	RegSelect  = 0x00
+	RegControl = 0x01
+	RegCount   = 0x02
+	// RegContext holds the active context, writing to it switches the
+	// address space before the next access
+	RegContext = 0x03
+	// RegMapping is the first of the staging registers, they have the
+	// same layout as a mapping: virtStart (2), physStart (4), size (2),
+	// the id of the backing store (1) and the permissions (1)
+	RegMapping = 0x04
+	// RegEditContext selects the context that is edited
+	RegEditContext = 0x0E
+	// RegCpuId holds the id of the CPU, so CPUs running the same
+	// code can tell each other apart
+	RegCpuId = 0x0F
+	// RegFaultAddress holds the address of the latched fault (2)
+	RegFaultAddress = 0x10
+	// RegFaultReason holds the reason of the latched fault, writing
+	// to it acknowledges the fault
+	RegFaultReason = 0x12
+
+	windowSize = 0x20
+)
+
+// Commands written to RegControl
+const (
+	CommandLoad   = 0x01
+	CommandCommit = 0x02
+	// CommandClone adds a copy of the edited context and selects the
+	// copy for editing
+	CommandClone = 0x03
+)
+
+// Status read from RegControl
+const (
+	StatusOk      = 0x00
+	StatusInvalid = 0x01
+)
+
+// registers is the register window of the MMU
+type registers struct {
+	mmu *MMU
+
+	selected    uint8
+	editContext uint8
+	status      uint8
+	staging     Mapping
+}
+
+func (r *registers) Read(address uint32) uint8 {
+	switch {
+	case address == RegSelect:
+		return r.selected
+	case address == RegControl:
+		return r.status
+	case address == RegCount:
+		if int(r.editContext) >= r.mmu.Contexts() {
+			return 0
+		}
+		return uint8(len(r.mmu.contexts[r.editContext]))
+	case address == RegContext:
+		return uint8(r.mmu.ActiveContext())
+	case address == RegEditContext:
+		return r.editContext
+	case address == RegCpuId:
+		return r.mmu.id
+	case address >= RegMapping && address < RegMapping+mappingSize:
+		return r.staging.getByte(address - RegMapping)
+	case address == RegFaultAddress:
+		return uint8(r.mmu.faultAddress)
+	case address == RegFaultAddress+1:
+		return uint8(r.mmu.faultAddress >> 8)
+	case address == RegFaultReason:
+		return r.mmu.faultReason
+	default:
+		Logger.Warnf("MMU: Read from unused register 0x%02X", address)
+		return 0
+	}
+}
+
+func (r *registers) Write(address uint32, data uint8) {
+	switch {
+	case address == RegSelect:
+		r.selected = data
+	case address == RegControl:
+		r.command(data)
+	case address == RegContext:
+		if err := r.mmu.SwitchContext(int(data)); err != nil {
+			Logger.Warnf("MMU: %s", err)
+			r.status = StatusInvalid
+			return
+		}
+		r.status = StatusOk
+	case address == RegEditContext:
+		r.editContext = data
+	case address >= RegMapping && address < RegMapping+mappingSize:
+		r.staging.setByte(address-RegMapping, data)
+	case address == RegFaultReason:
+		r.mmu.acknowledgeFault()
+	default:
+		Logger.Warnf("MMU: Write of 0x%02X to read only register 0x%02X", data, address)
+	}
+}
+
+func (r *registers) Reset() {
+	r.selected = 0
+	r.editContext = 0
+	r.status = StatusOk
+	r.staging = Mapping{}
+}
+
+func (r *registers) Size() uint32 {
+	return windowSize
+}
+
+// command executes a command written to the control register
+func (r *registers) command(command uint8) {
+	switch command {
+	case CommandLoad:
+		if int(r.editContext) >= r.mmu.Contexts() || int(r.selected) >= len(r.mmu.contexts[r.editContext]) {
+			r.status = StatusInvalid
+			return
+		}
+		r.staging = *r.mmu.contexts[r.editContext][r.selected]
+		r.status = StatusOk
+	case CommandCommit:
+		mapping := r.staging
+		if err := r.mmu.replaceMapping(int(r.editContext), int(r.selected), &mapping); err != nil {
+			Logger.Warnf("MMU: Rejected mapping %d of context %d: %s", r.selected, r.editContext, err)
+			r.status = StatusInvalid
+			return
+		}
+		r.status = StatusOk
+	case CommandClone:
+		context, err := r.mmu.CloneContext(int(r.editContext))
+		if err != nil {
+			Logger.Warnf("MMU: %s", err)
+			r.status = StatusInvalid
+			return
+		}
+		r.editContext = uint8(context)
+		r.status = StatusOk
+	default:
+		Logger.Warnf("MMU: Unknown command 0x%02X", command)
+		r.status = StatusInvalid
+	}
+}
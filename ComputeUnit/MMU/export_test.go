@@ -0,0 +1,11 @@
+package MMU
+
+// Lookup exposes the cached lookup to the tests
+func (m *MMU) Lookup(address uint16) *Mapping {
+	return m.lookup(address)
+}
+
+// LookupLinear searches the mappings without the translation cache
+func (m *MMU) LookupLinear(address uint16) *Mapping {
+	return lookupLinear(m.mappings, address)
+}
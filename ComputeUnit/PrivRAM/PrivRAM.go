@@ -8,10 +8,25 @@ func NewPrivRAM(size uint16) *PrivRAM {
 	return &PrivRAM{make([]byte, size)}
 }
 
-func (p *PrivRAM) Read(address uint16) byte {
+func (p *PrivRAM) Read(address uint32) byte {
 	return p.storage[address]
 }
 
-func (p *PrivRAM) Write(address uint16, data byte) {
+func (p *PrivRAM) Write(address uint32, data byte) {
 	p.storage[address] = data
 }
+
+func (p *PrivRAM) Reset() {
+	for i := range p.storage {
+		p.storage[i] = 0
+	}
+}
+
+func (p *PrivRAM) Size() uint32 {
+	return uint32(len(p.storage))
+}
+
+// Peek reads like Read, see BusUnit.Memory
+func (p *PrivRAM) Peek(address uint32) byte {
+	return p.storage[address]
+}
@@ -0,0 +1,600 @@
+package DAP
+
+import (
+	"emu6502/BusUnit"
+	"emu6502/ComputeUnit"
+	"emu6502/ComputeUnit/CPU"
+	"emu6502/Debugger"
+	"emu6502/Logger"
+	"emu6502/Machine"
+	"emu6502/Scheduler"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// threadId is the id of the only thread, the first CPU
+const threadId = 1
+
+// Variable references of the scopes
+const (
+	scopeRegisters = iota + 1
+	scopeFlags
+	scopeZeroPage
+)
+
+// flagNames are the bits of the processor status, from bit 7 down
+var flagNames = []struct {
+	name string
+	mask uint8
+}{
+	{"N", 0x80},
+	{"V", 0x40},
+	{"D", 0x08},
+	{"I", 0x04},
+	{"Z", 0x02},
+	{"C", 0x01},
+}
+
+// handler executes a request and returns the body of the response
+type handler func(s *Server, arguments json.RawMessage) (interface{}, error)
+
+var handlers map[string]handler
+
+func init() {
+	handlers = map[string]handler{
+		"initialize":        (*Server).initialize,
+		"launch":            (*Server).launch,
+		"setBreakpoints":    (*Server).setBreakpoints,
+		"configurationDone": (*Server).configurationDone,
+		"threads":           (*Server).threads,
+		"stackTrace":        (*Server).stackTrace,
+		"scopes":            (*Server).scopes,
+		"variables":         (*Server).variables,
+		"continue":          resume((*Debugger.Debugger).Continue),
+		"next":              resume((*Debugger.Debugger).Next),
+		"stepIn":            resume((*Debugger.Debugger).Step),
+		"stepOut":           (*Server).stepOut,
+		"stepBack":          reverse((*Debugger.Debugger).StepBack),
+		"reverseContinue":   reverse((*Debugger.Debugger).ReverseContinue),
+		"pause":             (*Server).pause,
+		"terminate":         (*Server).terminate,
+		"disconnect":        (*Server).disconnect,
+	}
+}
+
+// errNotLaunched is returned for requests that need a running program
+var errNotLaunched = errors.New("no program launched")
+
+// Server is a Debug Adapter Protocol server for one CPU. The program is
+// started by the launch request.
+type Server struct {
+	c *connection
+
+	// linesStartAt1 is requested by the client in initialize
+	linesStartAt1 bool
+
+	d         *Debugger.Debugger
+	listing   *Debugger.Listing
+	bus       *BusUnit.BusUnit
+	scheduler *Scheduler.Scheduler
+
+	stopOnEntry bool
+	// reverseStop is reported after the response to a reverse request
+	reverseStop *Debugger.Stop
+	// sourceBreakpoints are the ids of the breakpoints set in the listing
+	sourceBreakpoints []int
+
+	mutex   sync.Mutex
+	stopped bool
+	done    chan struct{}
+}
+
+// NewServer creates a server that reads requests from in and writes
+// responses and events to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		c:             newConnection(in, out),
+		linesStartAt1: true,
+		done:          make(chan struct{}),
+	}
+}
+
+// Run handles requests until the client disconnects or the input ends
+func (s *Server) Run() error {
+	defer s.shutdown()
+	for {
+		r, err := s.c.read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if r.Type != "request" {
+			continue
+		}
+
+		handle, ok := handlers[r.Command]
+		if !ok {
+			err = s.c.respond(r, nil, fmt.Errorf("unsupported request %s", r.Command))
+		} else {
+			body, requestErr := handle(s, r.Arguments)
+			err = s.c.respond(r, body, requestErr)
+		}
+		if err != nil {
+			return err
+		}
+
+		switch r.Command {
+		case "initialize":
+			// The client sends the configuration once the program is launched
+		case "launch":
+			if s.d != nil {
+				err = s.c.emit("initialized", nil)
+			}
+		case "stepBack", "reverseContinue":
+			if s.reverseStop != nil {
+				err = s.c.emit("stopped", s.stoppedBody(*s.reverseStop))
+				s.reverseStop = nil
+			}
+		case "terminate":
+			err = s.c.emit("terminated", nil)
+		case "disconnect":
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// shutdown stops the program
+func (s *Server) shutdown() {
+	select {
+	case <-s.done:
+		return
+	default:
+		close(s.done)
+	}
+	if s.d == nil {
+		return
+	}
+	s.d.Detach()
+	s.scheduler.Halt()
+	s.bus.Halt()
+}
+
+// decode unmarshals the arguments of a request
+func decode(arguments json.RawMessage, v interface{}) error {
+	if len(arguments) == 0 {
+		return nil
+	}
+	return json.Unmarshal(arguments, v)
+}
+
+func (s *Server) initialize(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		LinesStartAt1 *bool `json:"linesStartAt1"`
+	}
+	if err := decode(arguments, &args); err != nil {
+		return nil, err
+	}
+	if args.LinesStartAt1 != nil {
+		s.linesStartAt1 = *args.LinesStartAt1
+	}
+	return map[string]interface{}{
+		"supportsConfigurationDoneRequest":  true,
+		"supportsTerminateRequest":          true,
+		"supportsConditionalBreakpoints":    true,
+		"supportsHitConditionalBreakpoints": true,
+		"supportsStepBack":                  true,
+	}, nil
+}
+
+// launch builds the machine and starts the program. The CPU waits at its
+// first instruction until the configuration is done.
+func (s *Server) launch(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Rom         string  `json:"rom"`
+		Listing     string  `json:"listing"`
+		Mapping     string  `json:"mapping"`
+		Machine     string  `json:"machine"`
+		Mhz         float64 `json:"mhz"`
+		Turbo       bool    `json:"turbo"`
+		StopOnEntry bool    `json:"stopOnEntry"`
+		Record      int     `json:"record"`
+		BrkDebug    bool    `json:"brkDebug"`
+	}
+	if err := decode(arguments, &args); err != nil {
+		return nil, err
+	}
+	if s.d != nil {
+		return nil, errors.New("program already launched")
+	}
+
+	machine := Machine.Default()
+	if args.Machine != "" {
+		var err error
+		if machine, err = Machine.Load(args.Machine); err != nil {
+			return nil, err
+		}
+	}
+	bus, mappings, err := machine.Build(args.Rom)
+	if err != nil {
+		return nil, err
+	}
+
+	var listing *Debugger.Listing
+	if args.Listing != "" {
+		if listing, err = Debugger.LoadListing(args.Listing); err != nil {
+			return nil, err
+		}
+	}
+
+	// The program prints to the debug console, stdout carries the protocol
+	for _, device := range bus.Devices.Devices() {
+		if gpu, ok := device.(*BusUnit.GPU); ok {
+			gpu.SetOutput(outputWriter{s.c})
+		}
+	}
+
+	cu := ComputeUnit.NewComputeUnit(bus, mappings, 0)
+	switch {
+	case args.Turbo:
+		cu.SetClockSpeed(0)
+	case args.Mhz > 0:
+		cu.SetClockSpeed(uint64(args.Mhz * 1000000))
+	default:
+		cu.SetClockSpeed(1000000)
+	}
+	scheduler, err := Scheduler.NewScheduler([]*ComputeUnit.ComputeUnit{cu}, Scheduler.DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	s.d = Debugger.Attach(cu.CPU(), true)
+	if args.BrkDebug {
+		s.d.TrapBRK()
+	}
+	if args.Mapping != "" {
+		s.d.Symbols = Debugger.NewSymbols(Logger.LoadSymbols(args.Mapping))
+	}
+	s.listing = listing
+	s.bus = bus
+	s.scheduler = scheduler
+	s.d.EnableRecording(args.Record)
+	s.stopOnEntry = args.StopOnEntry
+
+	bus.Reset()
+	bus.Run()
+	cu.Reset()
+	scheduler.Run()
+	return nil, nil
+}
+
+// configurationDone lets the program run and starts reporting its stops
+func (s *Server) configurationDone(arguments json.RawMessage) (interface{}, error) {
+	if s.d == nil {
+		return nil, errNotLaunched
+	}
+	if !s.stopOnEntry {
+		<-s.d.Stops()
+		s.d.Continue()
+	}
+	go s.reportStops()
+	return nil, nil
+}
+
+// stopReasons are the reasons of the stopped event
+var stopReasons = map[Debugger.StopReason]string{
+	Debugger.StopEntry:        "entry",
+	Debugger.StopStep:         "step",
+	Debugger.StopBreakpoint:   "breakpoint",
+	Debugger.StopBRK:          "exception",
+	Debugger.StopInterrupt:    "pause",
+	Debugger.StopWatchpoint:   "data breakpoint",
+	Debugger.StopHistoryStart: "step",
+}
+
+// stoppedBody returns the body of the stopped event for the stop
+func (s *Server) stoppedBody(stop Debugger.Stop) map[string]interface{} {
+	body := map[string]interface{}{
+		"reason":            stopReasons[stop.Reason],
+		"threadId":          threadId,
+		"allThreadsStopped": true,
+		"description":       fmt.Sprintf("Stopped (%s) at %s", stop.Reason, s.d.Symbols.Describe(stop.PC)),
+	}
+	if stop.Breakpoint != nil {
+		body["hitBreakpointIds"] = []int{stop.Breakpoint.Id}
+	}
+	return body
+}
+
+// reportStops sends a stopped event every time the CPU stops
+func (s *Server) reportStops() {
+	for {
+		select {
+		case stop := <-s.d.Stops():
+			s.reportStop(stop)
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Server) reportStop(stop Debugger.Stop) {
+	s.mutex.Lock()
+	s.stopped = true
+	s.mutex.Unlock()
+	if err := s.c.emit("stopped", s.stoppedBody(stop)); err != nil {
+		Logger.Errorf("Cannot send stopped event: %s", err)
+	}
+}
+
+// resume returns a handler that resumes the stopped CPU with the given method
+func resume(method func(*Debugger.Debugger)) handler {
+	return func(s *Server, arguments json.RawMessage) (interface{}, error) {
+		if s.d == nil {
+			return nil, errNotLaunched
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if !s.stopped {
+			return nil, errors.New("the CPU is running")
+		}
+		s.stopped = false
+		method(s.d)
+		return map[string]interface{}{"allThreadsContinued": true}, nil
+	}
+}
+
+// stepOut runs until the current subroutine returns. At the outermost frame
+// there is nothing to return to, so the request fails.
+func (s *Server) stepOut(arguments json.RawMessage) (interface{}, error) {
+	if s.d == nil {
+		return nil, errNotLaunched
+	}
+	s.mutex.Lock()
+	stopped := s.stopped
+	s.mutex.Unlock()
+	if stopped && len(s.d.CallStack()) == 0 {
+		return nil, errors.New("not inside a subroutine")
+	}
+	return resume((*Debugger.Debugger).Finish)(s, arguments)
+}
+
+// reverse returns a handler that runs the stopped CPU backwards with the
+// given method. The CPU stays stopped, the stop is reported after the response.
+func reverse(method func(*Debugger.Debugger) (Debugger.Stop, error)) handler {
+	return func(s *Server, arguments json.RawMessage) (interface{}, error) {
+		if s.d == nil {
+			return nil, errNotLaunched
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if !s.stopped {
+			return nil, errors.New("the CPU is running")
+		}
+		stop, err := method(s.d)
+		if err != nil {
+			return nil, err
+		}
+		s.reverseStop = &stop
+		return nil, nil
+	}
+}
+
+func (s *Server) pause(arguments json.RawMessage) (interface{}, error) {
+	if s.d == nil {
+		return nil, errNotLaunched
+	}
+	s.d.Interrupt()
+	return nil, nil
+}
+
+func (s *Server) terminate(arguments json.RawMessage) (interface{}, error) {
+	s.shutdown()
+	return nil, nil
+}
+
+func (s *Server) disconnect(arguments json.RawMessage) (interface{}, error) {
+	s.shutdown()
+	return nil, nil
+}
+
+func (s *Server) threads(arguments json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"threads": []map[string]interface{}{{"id": threadId, "name": "CPU 0"}},
+	}, nil
+}
+
+// source describes the listing, the only source the client sees
+func (s *Server) source() map[string]interface{} {
+	if s.listing == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"name": filepath.Base(s.listing.Path),
+		"path": s.listing.Path,
+	}
+}
+
+// clientLine converts a zero based line for the client
+func (s *Server) clientLine(line int) int {
+	if s.linesStartAt1 {
+		return line + 1
+	}
+	return line
+}
+
+// frame describes a location of the call stack
+func (s *Server) frame(id int, name string, address uint16) map[string]interface{} {
+	frame := map[string]interface{}{
+		"id":                          id,
+		"name":                        name,
+		"line":                        0,
+		"column":                      0,
+		"instructionPointerReference": fmt.Sprintf("0x%04X", address),
+	}
+	if line, ok := s.listing.Line(address); ok {
+		frame["source"] = s.source()
+		frame["line"] = s.clientLine(line)
+		frame["column"] = s.clientLine(0)
+	}
+	return frame
+}
+
+// stackTrace returns the PC followed by the call sites of the active
+// subroutines, the innermost first
+func (s *Server) stackTrace(arguments json.RawMessage) (interface{}, error) {
+	if s.d == nil {
+		return nil, errNotLaunched
+	}
+	callStack := s.d.CallStack()
+	frames := []map[string]interface{}{s.frame(0, s.d.Symbols.Describe(s.d.CPU().PC()), s.d.CPU().PC())}
+	for i := len(callStack) - 1; i >= 0; i-- {
+		frames = append(frames, s.frame(len(frames), s.d.Symbols.Describe(callStack[i].CallSite), callStack[i].CallSite))
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+// scopes returns the same scopes for every frame, the CPU has only one
+// set of registers
+func (s *Server) scopes(arguments json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"scopes": []map[string]interface{}{
+			{"name": "Registers", "variablesReference": scopeRegisters, "expensive": false},
+			{"name": "Flags", "variablesReference": scopeFlags, "expensive": false},
+			{"name": "Zero Page", "variablesReference": scopeZeroPage, "expensive": false},
+		},
+	}, nil
+}
+
+func (s *Server) variables(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := decode(arguments, &args); err != nil {
+		return nil, err
+	}
+	if s.d == nil {
+		return nil, errNotLaunched
+	}
+
+	variables := []map[string]interface{}{}
+	variable := func(name string, value string) {
+		variables = append(variables, map[string]interface{}{"name": name, "value": value, "variablesReference": 0})
+	}
+
+	registers := s.d.CPU().Registers()
+	switch args.VariablesReference {
+	case scopeRegisters:
+		variable("A", fmt.Sprintf("$%02X", registers.A))
+		variable("X", fmt.Sprintf("$%02X", registers.X))
+		variable("Y", fmt.Sprintf("$%02X", registers.Y))
+		variable("SP", fmt.Sprintf("$%02X", registers.SP))
+		variable("PC", s.d.Symbols.Describe(registers.PC))
+		variable("P", fmt.Sprintf("$%02X %s", registers.P, CPU.FlagsString(registers.P)))
+	case scopeFlags:
+		for _, flag := range flagNames {
+			value := "0"
+			if registers.P&flag.mask != 0 {
+				value = "1"
+			}
+			variable(flag.name, value)
+		}
+	case scopeZeroPage:
+		labels := s.d.Symbols.Labels()
+		for address := uint16(0); address < 0x100; address++ {
+			name := fmt.Sprintf("$%02X", address)
+			if label, ok := labels[address]; ok {
+				name += " " + label
+			}
+			value := "??"
+			if data, ok := s.d.StoredByteAt(address); ok {
+				value = fmt.Sprintf("$%02X", data)
+			}
+			variable(name, value)
+		}
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+	return map[string]interface{}{"variables": variables}, nil
+}
+
+// unverified describes a breakpoint that couldn't be set
+func unverified(line int, message string) map[string]interface{} {
+	return map[string]interface{}{"verified": false, "line": line, "message": message}
+}
+
+// setBreakpoints replaces the breakpoints of the listing. A line without an
+// instruction gets the breakpoint of the next instruction.
+func (s *Server) setBreakpoints(arguments json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line         int    `json:"line"`
+			Condition    string `json:"condition"`
+			HitCondition string `json:"hitCondition"`
+		} `json:"breakpoints"`
+	}
+	if err := decode(arguments, &args); err != nil {
+		return nil, err
+	}
+	if s.d == nil {
+		return nil, errNotLaunched
+	}
+
+	sameSource := s.listing != nil && filepath.Clean(args.Source.Path) == filepath.Clean(s.listing.Path)
+	if sameSource {
+		for _, id := range s.sourceBreakpoints {
+			s.d.DeleteBreakpoint(id)
+		}
+		s.sourceBreakpoints = nil
+	}
+
+	breakpoints := []map[string]interface{}{}
+	for _, requested := range args.Breakpoints {
+		line := requested.Line
+		if s.linesStartAt1 {
+			line--
+		}
+		address, found, ok := s.listing.Address(line)
+		if !sameSource || !ok {
+			breakpoints = append(breakpoints, unverified(requested.Line, "no instruction at this line of the listing"))
+			continue
+		}
+		ignore := 0
+		if requested.HitCondition != "" {
+			// The hit condition is the number of the hit that stops
+			hits, err := strconv.Atoi(strings.TrimSpace(requested.HitCondition))
+			if err != nil || hits < 1 {
+				breakpoints = append(breakpoints, unverified(requested.Line, "the hit condition has to be a positive number"))
+				continue
+			}
+			ignore = hits - 1
+		}
+		breakpoint := s.d.AddBreakpoint(address, false)
+		s.sourceBreakpoints = append(s.sourceBreakpoints, breakpoint.Id)
+		if err := s.d.SetCondition(breakpoint.Id, requested.Condition); err != nil {
+			s.d.DeleteBreakpoint(breakpoint.Id)
+			breakpoints = append(breakpoints, unverified(requested.Line, err.Error()))
+			continue
+		}
+		_ = s.d.SetIgnoreCount(breakpoint.Id, ignore)
+		breakpoints = append(breakpoints, map[string]interface{}{
+			"id":       breakpoint.Id,
+			"verified": true,
+			"line":     s.clientLine(found),
+			"source":   s.source(),
+		})
+	}
+	return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
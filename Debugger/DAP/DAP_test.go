@@ -0,0 +1,309 @@
+package DAP
+
+import (
+	"bufio"
+	"emu6502/Logger"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// message is a response or event received by the client
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client drives the server like an editor would, through a pair of pipes
+// standing in for stdin and stdout
+type client struct {
+	t        *testing.T
+	in       *io.PipeWriter
+	messages chan message
+	// events received while waiting for something else
+	events []message
+	seq    int
+	// output collects the output events
+	output strings.Builder
+}
+
+func newClient(t *testing.T) *client {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, in: clientOut, messages: make(chan message, 64)}
+
+	go func() {
+		if err := NewServer(serverIn, serverOut).Run(); err != nil {
+			t.Errorf("server: %s", err)
+		}
+		_ = serverOut.Close()
+	}()
+	go func() {
+		defer close(c.messages)
+		reader := textproto.NewReader(bufio.NewReader(clientIn))
+		for {
+			header, err := reader.ReadMIMEHeader()
+			if err != nil {
+				return
+			}
+			length, _ := strconv.Atoi(header.Get("Content-Length"))
+			content := make([]byte, length)
+			if _, err := io.ReadFull(reader.R, content); err != nil {
+				return
+			}
+			var m message
+			if err := json.Unmarshal(content, &m); err != nil {
+				t.Errorf("invalid message %s: %s", content, err)
+				return
+			}
+			c.messages <- m
+		}
+	}()
+	return c
+}
+
+// next returns the next message from the server
+func (c *client) next() message {
+	c.t.Helper()
+	select {
+	case m, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("server closed the connection")
+		}
+		if m.Type == "event" && m.Event == "output" {
+			var body struct {
+				Output string `json:"output"`
+			}
+			_ = json.Unmarshal(m.Body, &body)
+			c.output.WriteString(body.Output)
+		}
+		return m
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timeout waiting for the server")
+	}
+	return message{}
+}
+
+// request sends a request and decodes the body of its response into body
+func (c *client) request(command string, arguments interface{}, body interface{}) message {
+	c.t.Helper()
+	m := c.send(command, arguments)
+	if !m.Success {
+		c.t.Fatalf("%s failed: %s", command, m.Message)
+	}
+	if body != nil {
+		if err := json.Unmarshal(m.Body, body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// send sends a request and returns its response, which may be a failure
+func (c *client) send(command string, arguments interface{}) message {
+	c.t.Helper()
+	c.seq++
+	content, _ := json.Marshal(map[string]interface{}{
+		"seq":       c.seq,
+		"type":      "request",
+		"command":   command,
+		"arguments": arguments,
+	})
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(content), content); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		m := c.next()
+		if m.Type == "event" {
+			c.events = append(c.events, m)
+			continue
+		}
+		if m.RequestSeq != c.seq || m.Command != command {
+			c.t.Fatalf("%s: unexpected response %+v", command, m)
+		}
+		return m
+	}
+}
+
+// event waits for the next event with the name and decodes its body
+func (c *client) event(name string, body interface{}) {
+	c.t.Helper()
+	for {
+		var m message
+		if len(c.events) > 0 {
+			m, c.events = c.events[0], c.events[1:]
+		} else {
+			m = c.next()
+		}
+		if m.Type != "event" || m.Event != name {
+			continue
+		}
+		if body != nil {
+			if err := json.Unmarshal(m.Body, body); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+		return
+	}
+}
+
+type stopped struct {
+	Reason           string `json:"reason"`
+	HitBreakpointIds []int  `json:"hitBreakpointIds"`
+}
+
+type stackTrace struct {
+	StackFrames []struct {
+		Name   string `json:"name"`
+		Line   int    `json:"line"`
+		Source *struct {
+			Path string `json:"path"`
+		} `json:"source"`
+	} `json:"stackFrames"`
+}
+
+type variables struct {
+	Variables []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"variables"`
+}
+
+// lines returns the listing lines of the frames
+func (s stackTrace) lines() []int {
+	lines := make([]int, len(s.StackFrames))
+	for i, frame := range s.StackFrames {
+		lines[i] = frame.Line
+	}
+	return lines
+}
+
+func (c *client) variables(reference int) map[string]string {
+	c.t.Helper()
+	var body variables
+	c.request("variables", map[string]interface{}{"variablesReference": reference}, &body)
+	values := make(map[string]string)
+	for _, variable := range body.Variables {
+		values[variable.Name] = variable.Value
+	}
+	return values
+}
+
+func TestSession(t *testing.T) {
+	c := newClient(t)
+
+	c.request("initialize", map[string]interface{}{"adapterID": "emu6502", "linesStartAt1": true}, nil)
+	c.request("launch", map[string]interface{}{
+		"rom":         "../../hello.rom",
+		"listing":     "testdata/hello.l",
+		"mapping":     "testdata/hello.m",
+		"turbo":       true,
+		"stopOnEntry": true,
+		"record":      1000,
+	}, nil)
+	c.event("initialized", nil)
+
+	// Line 17 is a comment, the breakpoint moves to the PHA on line 18
+	var breakpoints struct {
+		Breakpoints []struct {
+			Id       int  `json:"id"`
+			Verified bool `json:"verified"`
+			Line     int  `json:"line"`
+		} `json:"breakpoints"`
+	}
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": "testdata/hello.l"},
+		"breakpoints": []map[string]int{{"line": 17}, {"line": 1000}},
+	}, &breakpoints)
+	if len(breakpoints.Breakpoints) != 2 || !breakpoints.Breakpoints[0].Verified || breakpoints.Breakpoints[0].Line != 18 || breakpoints.Breakpoints[1].Verified {
+		t.Fatalf("setBreakpoints: got %+v", breakpoints)
+	}
+	c.request("configurationDone", nil, nil)
+
+	var stop stopped
+	c.event("stopped", &stop)
+	if stop.Reason != "entry" {
+		t.Errorf("first stop: got %q, expected entry", stop.Reason)
+	}
+	var trace stackTrace
+	c.request("stackTrace", map[string]interface{}{"threadId": threadId}, &trace)
+	if lines := trace.lines(); len(lines) != 1 || lines[0] != 27 || trace.StackFrames[0].Name != "$4047 <start>" {
+		t.Errorf("stack at entry: got %+v", trace)
+	}
+	// There is no subroutine to step out of
+	if m := c.send("stepOut", map[string]interface{}{"threadId": threadId}); m.Success || m.Message != "not inside a subroutine" {
+		t.Errorf("stepOut at entry: got %+v", m)
+	}
+
+	// stepIn executes one instruction
+	c.request("stepIn", map[string]interface{}{"threadId": threadId}, nil)
+	c.event("stopped", &stop)
+	if registers := c.variables(scopeRegisters); registers["PC"] != "$4049 <start+2>" || registers["X"] != "$00" {
+		t.Errorf("registers after stepIn: got %v", registers)
+	}
+	c.request("stepBack", map[string]interface{}{"threadId": threadId}, nil)
+	c.event("stopped", &stop)
+	if registers := c.variables(scopeRegisters); stop.Reason != "step" || registers["PC"] != "$4047 <start>" {
+		t.Errorf("registers after stepBack: got %v", registers)
+	}
+
+	// printDigit is called from printDec8, which is called from start
+	c.request("continue", map[string]interface{}{"threadId": threadId}, nil)
+	c.event("stopped", &stop)
+	if stop.Reason != "breakpoint" || len(stop.HitBreakpointIds) != 1 || stop.HitBreakpointIds[0] != breakpoints.Breakpoints[0].Id {
+		t.Errorf("breakpoint stop: got %+v", stop)
+	}
+	c.request("stackTrace", map[string]interface{}{"threadId": threadId}, &trace)
+	if lines := trace.lines(); fmt.Sprint(lines) != "[18 8 42]" {
+		t.Errorf("stack in printDigit: got lines %v, expected [18 8 42]", lines)
+	}
+
+	if !strings.HasPrefix(c.output.String(), "Hello World!\nABCDEFGHIJKLMNOPQRSTUVWXYZ\n") {
+		t.Errorf("output: got %q", c.output.String())
+	}
+
+	// stepOut returns to printDec8
+	c.request("stepOut", map[string]interface{}{"threadId": threadId}, nil)
+	c.event("stopped", &stop)
+	c.request("stackTrace", map[string]interface{}{"threadId": threadId}, &trace)
+	if lines := trace.lines(); fmt.Sprint(lines) != "[9 42]" {
+		t.Errorf("stack after stepOut: got lines %v, expected [9 42]", lines)
+	}
+
+	// next runs the second call of printDigit completely
+	c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]string{"path": "testdata/hello.l"},
+		"breakpoints": []map[string]int{{"line": 15}},
+	}, nil)
+	c.request("continue", map[string]interface{}{"threadId": threadId}, nil)
+	c.event("stopped", &stop)
+	c.request("next", map[string]interface{}{"threadId": threadId}, nil)
+	c.event("stopped", &stop)
+	c.request("stackTrace", map[string]interface{}{"threadId": threadId}, &trace)
+	if lines := trace.lines(); stop.Reason != "step" || fmt.Sprint(lines) != "[16 42]" {
+		t.Errorf("stack after next: got %s at lines %v, expected step at [16 42]", stop.Reason, lines)
+	}
+
+	flags := c.variables(scopeFlags)
+	if len(flags) != 6 || flags["C"] != "0" && flags["C"] != "1" {
+		t.Errorf("flags: got %v", flags)
+	}
+	if zeroPage := c.variables(scopeZeroPage); len(zeroPage) != 0x100 {
+		t.Errorf("zero page: got %d variables", len(zeroPage))
+	}
+
+	c.request("disconnect", nil, nil)
+}
@@ -0,0 +1,128 @@
+package DAP
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// request is a message sent by the client
+type request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// response answers a request
+type response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+// event is sent by the adapter on its own
+type event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// connection reads and writes messages framed by a Content-Length header.
+// Messages can be sent from several goroutines.
+type connection struct {
+	reader *textproto.Reader
+
+	mutex  sync.Mutex
+	writer io.Writer
+	seq    int
+}
+
+func newConnection(in io.Reader, out io.Writer) *connection {
+	return &connection{
+		reader: textproto.NewReader(bufio.NewReader(in)),
+		writer: out,
+	}
+}
+
+// read returns the next request
+func (c *connection) read() (*request, error) {
+	header, err := c.reader.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length: %q", header.Get("Content-Length"))
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(c.reader.R, content); err != nil {
+		return nil, err
+	}
+
+	var r request
+	if err := json.Unmarshal(content, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// respond sends the response to the request. A non-nil err fails the request.
+func (c *connection) respond(r *request, body interface{}, err error) error {
+	message := &response{
+		Type:       "response",
+		RequestSeq: r.Seq,
+		Success:    err == nil,
+		Command:    r.Command,
+		Body:       body,
+	}
+	if err != nil {
+		message.Message = err.Error()
+		message.Body = nil
+	}
+	return c.write(func(seq int) interface{} {
+		message.Seq = seq
+		return message
+	})
+}
+
+// emit sends an event
+func (c *connection) emit(name string, body interface{}) error {
+	return c.write(func(seq int) interface{} {
+		return &event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+// write numbers and sends a message
+func (c *connection) write(message func(seq int) interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.seq++
+	content, err := json.Marshal(message(c.seq))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n%s", len(content), content)
+	return err
+}
+
+// outputWriter turns the characters printed by the program into output events
+type outputWriter struct {
+	c *connection
+}
+
+func (w outputWriter) Write(data []byte) (int, error) {
+	if err := w.c.emit("output", map[string]string{"category": "stdout", "output": string(data)}); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -0,0 +1,4 @@
+$4020 | printDec8  | hello.oph:3
+$403B | printDigit | hello.oph:17
+$4047 | start      | hello.oph:25
+$4054 | _alphabet  | hello.oph:31
@@ -0,0 +1,503 @@
+package Debugger
+
+import (
+	"emu6502/ComputeUnit/CPU"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// opcodeJSR is recognised to track subroutine calls
+const opcodeJSR = 0x20
+
+// historySize is the number of executed instructions that are remembered
+const historySize = 16
+
+// ErrUnknownValue is returned by Evaluate for expressions that read an
+// I/O device, which can't be done without side effects
+var ErrUnknownValue = errors.New("the value depends on an I/O device")
+
+// StopReason tells why the CPU stopped
+type StopReason int
+
+const (
+	StopEntry StopReason = iota
+	StopStep
+	StopBreakpoint
+	StopBRK
+	StopInterrupt
+	StopWatchpoint
+	// StopHistoryStart is reported when running backwards reached the
+	// oldest recorded state
+	StopHistoryStart
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopEntry:
+		return "entry"
+	case StopStep:
+		return "step"
+	case StopBreakpoint:
+		return "breakpoint"
+	case StopBRK:
+		return "BRK"
+	case StopInterrupt:
+		return "interrupt"
+	case StopWatchpoint:
+		return "watchpoint"
+	case StopHistoryStart:
+		return "start of history"
+	default:
+		return "unknown"
+	}
+}
+
+// Stop is reported every time the CPU stops
+type Stop struct {
+	Reason StopReason
+	PC     uint16
+	// Breakpoint is the breakpoint that was hit, if any
+	Breakpoint *Breakpoint
+	// Watchpoint is the watchpoint that triggered, Access the access
+	// that triggered it
+	Watchpoint *Watchpoint
+	Access     Access
+	// Reverse is set for the stops of StepBack and ReverseContinue
+	Reverse bool
+}
+
+// Breakpoint stops the CPU before the instruction at Address executes
+type Breakpoint struct {
+	Id      int
+	Address uint16
+	// Temporary breakpoints are deleted when they are hit
+	Temporary bool
+	// Condition has to be true for the breakpoint to be hit, nil
+	// if it is unconditional
+	Condition *Expression
+	// Hits counts how often the breakpoint was hit, Ignore is the
+	// number of further hits that don't stop the CPU
+	Hits   int
+	Ignore int
+}
+
+// Frame is an entry of the call stack, created by a JSR
+type Frame struct {
+	// CallSite is the address of the JSR
+	CallSite uint16
+	// Target is the address of the subroutine
+	Target uint16
+	// SP is the stack pointer before the JSR. The frame is left as soon
+	// as the stack pointer is back at this value.
+	SP uint8
+}
+
+// action is what the CPU does when it is resumed
+type action int
+
+const (
+	actionContinue action = iota
+	actionStep
+	actionNext
+	actionFinish
+)
+
+// Debugger controls the execution of one CPU.
+// It runs as an instruction hook on the goroutine of the CPU. When the CPU
+// stops, a Stop is sent on the Stops channel and the CPU waits until one of
+// Continue, Step, Next or Finish is called. While the CPU is stopped its
+// registers and memory can be accessed from any goroutine, and with a
+// recording it can run backwards with StepBack and ReverseContinue.
+type Debugger struct {
+	cpu *CPU.CPU
+
+	Symbols *Symbols
+
+	mutex       sync.Mutex
+	breakpoints []*Breakpoint
+	watchpoints []*Watchpoint
+	// watching is the number of watchpoints, so that the access hook
+	// can return early without taking the mutex
+	watching int32
+	nextId   int
+
+	// action is the current way of running, depth the call depth at the
+	// time it was started
+	action action
+	depth  int
+	// resumePC is the PC the CPU was resumed at. A breakpoint there
+	// doesn't stop again before the instruction executed.
+	resumePC     uint16
+	resumed      bool
+	pendingStop  *Stop
+	interrupted  uint32
+	detached     uint32
+	detach       chan struct{}
+	callStack    []Frame
+	history      [historySize]uint16
+	historyCount int
+	// recording is the undo log for reverse execution, nil if it is off
+	recording *recording
+	// waiting is set while the CPU waits in stop
+	waiting uint32
+
+	stops   chan Stop
+	resumes chan action
+}
+
+// Attach installs the debugger as instruction and access hook of the CPU.
+// If stopAtEntry is set the CPU stops before its first instruction. BRK
+// keeps raising an interrupt unless TrapBRK is called.
+func Attach(cpu *CPU.CPU, stopAtEntry bool) *Debugger {
+	d := &Debugger{
+		cpu:     cpu,
+		nextId:  1,
+		stops:   make(chan Stop, 1),
+		resumes: make(chan action),
+		detach:  make(chan struct{}),
+	}
+	if stopAtEntry {
+		d.pendingStop = &Stop{Reason: StopEntry}
+	}
+	cpu.AddInstructionHook(d.beforeInstruction)
+	cpu.SetAccessHook(d.access)
+	return d
+}
+
+// CPU returns the CPU controlled by the debugger
+func (d *Debugger) CPU() *CPU.CPU {
+	return d.cpu
+}
+
+// Stops returns the channel the stops of the CPU are reported on
+func (d *Debugger) Stops() <-chan Stop {
+	return d.stops
+}
+
+// TrapBRK makes BRK stop in the debugger instead of raising an interrupt
+func (d *Debugger) TrapBRK() {
+	d.cpu.SetBRKTrap(d.trap)
+}
+
+// trap is called by the CPU instead of the BRK interrupt sequence
+func (d *Debugger) trap(c *CPU.CPU) {
+	d.pendingStop = &Stop{Reason: StopBRK}
+}
+
+// beforeInstruction decides if the CPU has to stop before the next instruction
+func (d *Debugger) beforeInstruction(c *CPU.CPU) {
+	if atomic.LoadUint32(&d.detached) != 0 {
+		return
+	}
+
+	pc := c.PC()
+	registers := c.Registers()
+
+	// Leave all frames the stack pointer has returned from
+	for len(d.callStack) > 0 && registers.SP >= d.callStack[len(d.callStack)-1].SP {
+		d.callStack = d.callStack[:len(d.callStack)-1]
+	}
+
+	if stop := d.checkStop(pc); stop != nil {
+		stop.PC = pc
+		d.stop(*stop)
+	}
+
+	if d.recording != nil {
+		d.beginRecord()
+	}
+	if d.Peek(c.PC()) == opcodeJSR {
+		d.callStack = append(d.callStack, Frame{
+			CallSite: c.PC(),
+			Target:   CPU.CombineLowHigh(d.Peek(c.PC()+1), d.Peek(c.PC()+2)),
+			SP:       c.Registers().SP,
+		})
+	}
+	d.history[d.historyCount%historySize] = c.PC()
+	d.historyCount++
+}
+
+// checkStop returns why the CPU has to stop at the PC, nil if it can go on
+func (d *Debugger) checkStop(pc uint16) *Stop {
+	resumed := d.resumed && d.resumePC == pc
+	d.resumed = false
+
+	if d.pendingStop != nil {
+		stop := d.pendingStop
+		d.pendingStop = nil
+		return stop
+	}
+	if atomic.CompareAndSwapUint32(&d.interrupted, 1, 0) {
+		return &Stop{Reason: StopInterrupt}
+	}
+
+	switch d.action {
+	case actionStep:
+		return &Stop{Reason: StopStep}
+	case actionNext:
+		if len(d.callStack) <= d.depth {
+			return &Stop{Reason: StopStep}
+		}
+	case actionFinish:
+		if len(d.callStack) < d.depth {
+			return &Stop{Reason: StopStep}
+		}
+	}
+
+	if resumed {
+		return nil
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for i, breakpoint := range d.breakpoints {
+		if breakpoint.Address != pc || !d.hit(breakpoint.Condition, &breakpoint.Hits, &breakpoint.Ignore) {
+			continue
+		}
+		if breakpoint.Temporary {
+			d.breakpoints = append(d.breakpoints[:i:i], d.breakpoints[i+1:]...)
+		}
+		return &Stop{Reason: StopBreakpoint, Breakpoint: breakpoint}
+	}
+	return nil
+}
+
+// hit decides if a breakpoint or watchpoint whose location matched is
+// hit. It evaluates the condition and counts the hit, and returns false
+// while hits are ignored. The mutex has to be held.
+func (d *Debugger) hit(condition *Expression, hits *int, ignore *int) bool {
+	if condition != nil && !condition.True(d.cpu.Registers(), d.StoredByteAt) {
+		return false
+	}
+	*hits++
+	if *ignore > 0 {
+		*ignore--
+		return false
+	}
+	return true
+}
+
+// stop reports the stop and waits until the CPU is resumed
+func (d *Debugger) stop(stop Stop) {
+	atomic.StoreUint32(&d.waiting, 1)
+	defer atomic.StoreUint32(&d.waiting, 0)
+	select {
+	case d.stops <- stop:
+	case <-d.detach:
+		return
+	}
+	select {
+	case d.action = <-d.resumes:
+	case <-d.detach:
+		d.action = actionContinue
+	}
+	d.depth = len(d.callStack)
+	d.resumePC = d.cpu.PC()
+	d.resumed = true
+}
+
+// resume lets the stopped CPU run again
+func (d *Debugger) resume(a action) {
+	select {
+	case d.resumes <- a:
+	case <-d.detach:
+	}
+}
+
+// Continue runs until a breakpoint is hit. The CPU has to be stopped.
+func (d *Debugger) Continue() {
+	d.resume(actionContinue)
+}
+
+// Step executes one instruction. The CPU has to be stopped.
+func (d *Debugger) Step() {
+	d.resume(actionStep)
+}
+
+// Next executes one instruction, subroutines called by a JSR are run to
+// completion. The CPU has to be stopped.
+func (d *Debugger) Next() {
+	d.resume(actionNext)
+}
+
+// Finish runs until the current subroutine returns. The CPU has to be stopped.
+func (d *Debugger) Finish() {
+	d.resume(actionFinish)
+}
+
+// Interrupt stops the running CPU before the next instruction
+func (d *Debugger) Interrupt() {
+	atomic.StoreUint32(&d.interrupted, 1)
+}
+
+// Detach lets the CPU run freely. A stopped CPU is resumed.
+func (d *Debugger) Detach() {
+	if atomic.CompareAndSwapUint32(&d.detached, 0, 1) {
+		close(d.detach)
+	}
+}
+
+// Evaluate compiles and evaluates an expression against the stopped CPU
+func (d *Debugger) Evaluate(text string) (int, error) {
+	expression, err := ParseExpression(text, d.Symbols)
+	if err != nil {
+		return 0, err
+	}
+	e := &environment{registers: d.cpu.Registers(), peek: d.StoredByteAt}
+	value := expression.eval(e)
+	if e.unknown {
+		return 0, ErrUnknownValue
+	}
+	return value, nil
+}
+
+// AddBreakpoint adds a breakpoint at the address and returns it
+func (d *Debugger) AddBreakpoint(address uint16, temporary bool) *Breakpoint {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	breakpoint := &Breakpoint{Id: d.nextId, Address: address, Temporary: temporary}
+	d.nextId++
+	d.breakpoints = append(d.breakpoints, breakpoint)
+	return breakpoint
+}
+
+// SetCondition sets the condition of the breakpoint or watchpoint with the
+// given id. An empty condition makes it unconditional.
+func (d *Debugger) SetCondition(id int, condition string) error {
+	var expression *Expression
+	if strings.TrimSpace(condition) != "" {
+		var err error
+		if expression, err = ParseExpression(condition, d.Symbols); err != nil {
+			return err
+		}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if breakpoint := d.breakpoint(id); breakpoint != nil {
+		breakpoint.Condition = expression
+		return nil
+	}
+	if watchpoint := d.watchpoint(id); watchpoint != nil {
+		watchpoint.Condition = expression
+		return nil
+	}
+	return fmt.Errorf("no breakpoint or watchpoint %d", id)
+}
+
+// SetIgnoreCount lets the breakpoint or watchpoint with the given id
+// ignore its next count hits
+func (d *Debugger) SetIgnoreCount(id int, count int) error {
+	if count < 0 {
+		return fmt.Errorf("invalid ignore count %d", count)
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if breakpoint := d.breakpoint(id); breakpoint != nil {
+		breakpoint.Ignore = count
+		return nil
+	}
+	if watchpoint := d.watchpoint(id); watchpoint != nil {
+		watchpoint.Ignore = count
+		return nil
+	}
+	return fmt.Errorf("no breakpoint or watchpoint %d", id)
+}
+
+// breakpoint returns the breakpoint with the id, the mutex has to be held
+func (d *Debugger) breakpoint(id int) *Breakpoint {
+	for _, breakpoint := range d.breakpoints {
+		if breakpoint.Id == id {
+			return breakpoint
+		}
+	}
+	return nil
+}
+
+// DeleteBreakpoint deletes the breakpoint or watchpoint with the given id
+func (d *Debugger) DeleteBreakpoint(id int) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for i, breakpoint := range d.breakpoints {
+		if breakpoint.Id == id {
+			d.breakpoints = append(d.breakpoints[:i:i], d.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	for i, watchpoint := range d.watchpoints {
+		if watchpoint.Id == id {
+			d.watchpoints = append(d.watchpoints[:i:i], d.watchpoints[i+1:]...)
+			atomic.StoreInt32(&d.watching, int32(len(d.watchpoints)))
+			return true
+		}
+	}
+	return false
+}
+
+// ClearBreakpoints deletes all breakpoints and watchpoints
+func (d *Debugger) ClearBreakpoints() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.breakpoints = nil
+	d.watchpoints = nil
+	atomic.StoreInt32(&d.watching, 0)
+}
+
+// Breakpoints returns all breakpoints sorted by their id
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	breakpoints := append([]*Breakpoint(nil), d.breakpoints...)
+	sort.Slice(breakpoints, func(i, j int) bool { return breakpoints[i].Id < breakpoints[j].Id })
+	return breakpoints
+}
+
+// CallStack returns the active subroutine calls, the innermost last.
+// The CPU has to be stopped.
+func (d *Debugger) CallStack() []Frame {
+	return append([]Frame(nil), d.callStack...)
+}
+
+// History returns the addresses of the last executed instructions, the
+// most recent last. The CPU has to be stopped.
+func (d *Debugger) History() []uint16 {
+	count := d.historyCount
+	if count > historySize {
+		count = historySize
+	}
+	history := make([]uint16, count)
+	for i := range history {
+		history[i] = d.history[(d.historyCount-count+i)%historySize]
+	}
+	return history
+}
+
+// Peek reads memory through the MMU of the CPU like StoredByteAt, but
+// returns 0 for addresses that can't be read without side effects
+func (d *Debugger) Peek(address uint16) uint8 {
+	data, _ := d.cpu.StoredByteAt(address)
+	return data
+}
+
+// StoredByteAt reads memory through the MMU of the CPU. It doesn't trigger
+// watchpoints or MMU faults, and it doesn't read I/O devices, whose reads
+// have side effects like popping a FIFO. ok is false for those.
+func (d *Debugger) StoredByteAt(address uint16) (uint8, bool) {
+	return d.cpu.StoredByteAt(address)
+}
+
+// Poke writes memory through the MMU of the CPU. It doesn't trigger
+// watchpoints or MMU faults.
+func (d *Debugger) Poke(address uint16, data uint8) {
+	d.cpu.PokeByteAt(address, data)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, watchpoint := range d.watchpoints {
+		if watchpoint.contains(address) {
+			watchpoint.values[address-watchpoint.Start] = data
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package Debugger
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTrapBRK(t *testing.T) {
+	for _, trap := range []bool{false, true} {
+		d, _, wait := startHello(t)
+		if trap {
+			d.TrapBRK()
+		}
+		d.Poke(0x0300, 0x00)
+		registers := d.CPU().Registers()
+		registers.PC = 0x0300
+		d.CPU().SetRegisters(registers)
+		// The IRQ handler of hello.rom
+		d.AddBreakpoint(0x4069, false)
+
+		d.Continue()
+		stop := wait()
+		switch {
+		case trap && (stop.Reason != StopBRK || stop.PC != 0x0301):
+			t.Errorf("with the trap: got %s at $%04X, expected BRK at $0301", stop.Reason, stop.PC)
+		case !trap && (stop.Reason != StopBreakpoint || stop.PC != 0x4069):
+			t.Errorf("without the trap: got %s at $%04X, expected the breakpoint at $4069", stop.Reason, stop.PC)
+		}
+	}
+}
+
+func TestIODevices(t *testing.T) {
+	d, _, _ := startHello(t)
+	// The GPU is mapped at $4000, its registers are not memory
+	if _, ok := d.StoredByteAt(0x4000); ok {
+		t.Error("the GPU can be read without side effects")
+	}
+	if _, ok := d.StoredByteAt(0x4020); !ok {
+		t.Error("the ROM can't be read")
+	}
+	if _, err := d.Evaluate("[$4000] + 1"); !errors.Is(err, ErrUnknownValue) {
+		t.Errorf("reading the GPU: got %v, expected %v", err, ErrUnknownValue)
+	}
+	if value, err := d.Evaluate("{$FFFE}"); err != nil || value != 0x4069 {
+		t.Errorf("IRQ vector: got $%04X %v, expected $4069", value, err)
+	}
+	condition, err := ParseExpression("[$4000] == 0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if condition.True(d.CPU().Registers(), d.StoredByteAt) {
+		t.Error("a condition on the GPU is true")
+	}
+}
@@ -0,0 +1,329 @@
+package Debugger
+
+import (
+	"emu6502/ComputeUnit/CPU"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Expression is a compiled breakpoint condition like
+// "A == $0A && [printDec16_num1] > 3". It knows
+//   - numbers: $FF, 0xFF, %1010 and decimal
+//   - the registers A, X, Y, SP, PC and P and the flags N, V, D, I, Z and C
+//   - labels of the symbol table, which evaluate to their address
+//   - [address] reads a byte, {address} reads a little endian word
+//   - the operators || && == != < <= > >= | ^ & + - and the unary ! - ~
+//
+// Comparisons and logical operators evaluate to 1 or 0. An expression is
+// true if it is not 0.
+type Expression struct {
+	text string
+	eval evaluator
+}
+
+// evaluator computes the value of a part of an expression
+type evaluator func(e *environment) int
+
+// PeekFunc reads memory without side effects. ok is false if the address
+// can't be read that way, like the registers of an I/O device.
+type PeekFunc func(address uint16) (data uint8, ok bool)
+
+// environment is what an expression is evaluated against
+type environment struct {
+	registers CPU.Registers
+	peek      PeekFunc
+	// unknown is set once the expression read an address that peek can't read
+	unknown bool
+}
+
+// read returns the byte at the address, 0 if it can't be read
+func (e *environment) read(address uint16) uint8 {
+	data, ok := e.peek(address)
+	if !ok {
+		e.unknown = true
+	}
+	return data
+}
+
+// String returns the source of the expression
+func (x *Expression) String() string {
+	return x.text
+}
+
+// True evaluates the expression against the state of the CPU. It is false
+// if the expression reads an address whose value is unknown.
+func (x *Expression) True(registers CPU.Registers, peek PeekFunc) bool {
+	e := &environment{registers: registers, peek: peek}
+	return x.eval(e) != 0 && !e.unknown
+}
+
+// ParseExpression compiles the expression. Labels are resolved with the
+// symbol table, which may be nil.
+func ParseExpression(text string, symbols *Symbols) (*Expression, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, symbols: symbols}
+	eval, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.position < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in expression", p.tokens[p.position])
+	}
+	return &Expression{text: strings.TrimSpace(text), eval: eval}, nil
+}
+
+// operators lists the binary operators by increasing precedence
+var operators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"|", "^", "&"},
+	{"+", "-"},
+}
+
+// tokenize splits the expression into numbers, names, operators and brackets
+func tokenize(text string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := rune(text[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '$' || c == '%' || unicode.IsDigit(c):
+			end := i + 1
+			for end < len(text) && (isHexDigit(text[end]) || text[end] == 'x' || text[end] == 'X') {
+				end++
+			}
+			tokens = append(tokens, text[i:end])
+			i = end
+		case c == '_' || c == '.' || unicode.IsLetter(c):
+			end := i + 1
+			for end < len(text) && (text[end] == '_' || text[end] == '.' || unicode.IsLetter(rune(text[end])) || unicode.IsDigit(rune(text[end]))) {
+				end++
+			}
+			tokens = append(tokens, text[i:end])
+			i = end
+		case strings.ContainsRune("[]{}()", c):
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			if i+1 < len(text) {
+				switch text[i : i+2] {
+				case "||", "&&", "==", "!=", "<=", ">=":
+					tokens = append(tokens, text[i:i+2])
+					i += 2
+					continue
+				}
+			}
+			if !strings.ContainsRune("<>|^&+-!~", c) {
+				return nil, fmt.Errorf("unexpected %q in expression", c)
+			}
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// parser is a precedence climbing parser over the tokens
+type parser struct {
+	tokens   []string
+	position int
+	symbols  *Symbols
+}
+
+// peek returns the next token, "" at the end
+func (p *parser) peek() string {
+	if p.position >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.position]
+}
+
+func (p *parser) next() string {
+	token := p.peek()
+	p.position++
+	return token
+}
+
+func (p *parser) expect(token string) error {
+	if next := p.next(); next != token {
+		if next == "" {
+			return fmt.Errorf("missing %q at the end of the expression", token)
+		}
+		return fmt.Errorf("expected %q instead of %q", token, next)
+	}
+	return nil
+}
+
+// parseBinary parses the operators of the given precedence and higher
+func (p *parser) parseBinary(precedence int) (evaluator, error) {
+	if precedence == len(operators) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(precedence + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator := p.peek()
+		if !contains(operators[precedence], operator) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binary(operator, left, right)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, element := range list {
+		if element == s {
+			return true
+		}
+	}
+	return false
+}
+
+// boolean converts a truth value to 1 or 0
+func boolean(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func binary(operator string, left evaluator, right evaluator) evaluator {
+	switch operator {
+	case "||":
+		return func(e *environment) int { return boolean(left(e) != 0 || right(e) != 0) }
+	case "&&":
+		return func(e *environment) int { return boolean(left(e) != 0 && right(e) != 0) }
+	case "==":
+		return func(e *environment) int { return boolean(left(e) == right(e)) }
+	case "!=":
+		return func(e *environment) int { return boolean(left(e) != right(e)) }
+	case "<":
+		return func(e *environment) int { return boolean(left(e) < right(e)) }
+	case "<=":
+		return func(e *environment) int { return boolean(left(e) <= right(e)) }
+	case ">":
+		return func(e *environment) int { return boolean(left(e) > right(e)) }
+	case ">=":
+		return func(e *environment) int { return boolean(left(e) >= right(e)) }
+	case "|":
+		return func(e *environment) int { return left(e) | right(e) }
+	case "^":
+		return func(e *environment) int { return left(e) ^ right(e) }
+	case "&":
+		return func(e *environment) int { return left(e) & right(e) }
+	case "+":
+		return func(e *environment) int { return left(e) + right(e) }
+	default:
+		return func(e *environment) int { return left(e) - right(e) }
+	}
+}
+
+func (p *parser) parseUnary() (evaluator, error) {
+	switch operator := p.peek(); operator {
+	case "!", "-", "~":
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		switch operator {
+		case "!":
+			return func(e *environment) int { return boolean(operand(e) == 0) }, nil
+		case "-":
+			return func(e *environment) int { return -operand(e) }, nil
+		default:
+			return func(e *environment) int { return ^operand(e) }, nil
+		}
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (evaluator, error) {
+	token := p.next()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "(", "[", "{":
+		inner, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		closing := map[string]string{"(": ")", "[": "]", "{": "}"}[token]
+		if err := p.expect(closing); err != nil {
+			return nil, err
+		}
+		switch token {
+		case "[":
+			return func(e *environment) int { return int(e.read(uint16(inner(e)))) }, nil
+		case "{":
+			return func(e *environment) int {
+				address := uint16(inner(e))
+				return int(CPU.CombineLowHigh(e.read(address), e.read(address+1)))
+			}, nil
+		}
+		return inner, nil
+	}
+
+	if value, err := ParseNumber(token); err == nil {
+		return func(e *environment) int { return int(value) }, nil
+	}
+	if register := registerEvaluator(token); register != nil {
+		return register, nil
+	}
+	if address, ok := p.symbols.Address(token); ok {
+		return func(e *environment) int { return int(address) }, nil
+	}
+	return nil, fmt.Errorf("unknown name %q in expression", token)
+}
+
+// registerEvaluator returns the evaluator of a register or flag, nil if
+// the name is neither
+func registerEvaluator(name string) evaluator {
+	switch strings.ToUpper(name) {
+	case "A":
+		return func(e *environment) int { return int(e.registers.A) }
+	case "X":
+		return func(e *environment) int { return int(e.registers.X) }
+	case "Y":
+		return func(e *environment) int { return int(e.registers.Y) }
+	case "SP":
+		return func(e *environment) int { return int(e.registers.SP) }
+	case "PC":
+		return func(e *environment) int { return int(e.registers.PC) }
+	case "P":
+		return func(e *environment) int { return int(e.registers.P) }
+	}
+	for _, flag := range flags {
+		if strings.EqualFold(name, flag.name) {
+			mask := flag.mask
+			return func(e *environment) int { return boolean(e.registers.P&mask != 0) }
+		}
+	}
+	return nil
+}
+
+// flags are the bits of the processor status that can be used by name
+var flags = []struct {
+	name string
+	mask uint8
+}{
+	{"N", 0x80},
+	{"V", 0x40},
+	{"D", 0x08},
+	{"I", 0x04},
+	{"Z", 0x02},
+	{"C", 0x01},
+}
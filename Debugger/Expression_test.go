@@ -0,0 +1,45 @@
+package Debugger
+
+import (
+	"emu6502/ComputeUnit/CPU"
+	"testing"
+)
+
+func TestExpression(t *testing.T) {
+	symbols := NewSymbols(map[string]uint16{"num": 0x10, "start": 0x4020})
+	registers := CPU.Registers{A: 0x0A, X: 2, Y: 0xFF, SP: 0xFD, PC: 0x4025, P: 0b10100001}
+	memory := map[uint16]uint8{0x10: 0x34, 0x11: 0x12, 0x12: 4}
+	peek := func(address uint16) (uint8, bool) { return memory[address], true }
+
+	expressions := map[string]int{
+		"A == $0A":                      1,
+		"A == $0A && [num] > 3":         1,
+		"A != 10 || X == 2":             1,
+		"{num}":                         0x1234,
+		"[num+X]":                       4,
+		"[num + 2] - 1":                 3,
+		"PC - start":                    5,
+		"C && N && !Z":                  1,
+		"P & %00000001":                 1,
+		"-1 + ~0 + 2":                   0,
+		"(A | $F0) ^ $FF":               0x05,
+		"y >= 0xff && sp < $FE":         1,
+		"A == 10 && (X == 1 || X == 2)": 1,
+	}
+	for text, expected := range expressions {
+		expression, err := ParseExpression(text, symbols)
+		if err != nil {
+			t.Errorf("%s: %s", text, err)
+			continue
+		}
+		if value := expression.eval(&environment{registers: registers, peek: peek}); value != expected {
+			t.Errorf("%s: got %d, expected %d", text, value, expected)
+		}
+	}
+
+	for _, text := range []string{"", "A ==", "[num", "unknown == 1", "A = 1", "(A))"} {
+		if _, err := ParseExpression(text, symbols); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+package GDB
+
+import (
+	"bufio"
+	"emu6502/ComputeUnit/CPU"
+	"emu6502/Debugger"
+	"emu6502/Logger"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Signals reported in stop replies
+const (
+	signalInterrupt = 0x02
+	signalTrap      = 0x05
+)
+
+// Register numbers, the order of the registers in the g packet
+const (
+	regA = iota
+	regX
+	regY
+	regSP
+	regPC
+	regP
+	registerCount
+)
+
+// targetXML describes the registers of the 6502 to GDB
+const targetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.emu6502.cpu">
+    <reg name="a" bitsize="8" type="uint8" regnum="0"/>
+    <reg name="x" bitsize="8" type="uint8"/>
+    <reg name="y" bitsize="8" type="uint8"/>
+    <reg name="sp" bitsize="8" type="uint8"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+    <reg name="p" bitsize="8" type="uint8"/>
+  </feature>
+</target>
+`
+
+// Server serves the GDB Remote Serial Protocol for one CPU. Clients
+// are served one after the other.
+type Server struct {
+	d        *Debugger.Debugger
+	listener net.Listener
+
+	// stopped is set while the CPU waits in the debugger, lastStop is
+	// the reason it stopped
+	stopped  bool
+	lastStop Debugger.Stop
+	// breakpoints are the ids of the breakpoints set by the client, by
+	// address. Breakpoints of the monitor are left alone.
+	breakpoints map[uint16]int
+
+	quit chan struct{}
+}
+
+// Listen starts listening on the address, like ":2345". The CPU must
+// have been attached to the debugger with stopAtEntry set.
+func Listen(address string, d *Debugger.Debugger) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		d:           d,
+		listener:    listener,
+		breakpoints: make(map[uint16]int),
+		quit:        make(chan struct{}),
+	}, nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Quit is closed when a client kills the target
+func (s *Server) Quit() <-chan struct{} {
+	return s.quit
+}
+
+// Close stops listening
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// Serve accepts clients until the listener is closed
+func (s *Server) Serve() {
+	Logger.Infof("GDB server listening on %s", s.listener.Addr())
+	// The CPU was attached with stopAtEntry
+	s.waitForStop()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		Logger.Infof("GDB client connected from %s", conn.RemoteAddr())
+
+		// GDB expects a stopped target when it connects
+		if !s.stopped {
+			s.d.Interrupt()
+			s.waitForStop()
+		}
+
+		killed := s.session(conn)
+		_ = conn.Close()
+		Logger.Infof("GDB client disconnected")
+		if killed {
+			close(s.quit)
+			_ = s.listener.Close()
+			return
+		}
+	}
+}
+
+// waitForStop waits until the CPU stops
+func (s *Server) waitForStop() {
+	s.lastStop = <-s.d.Stops()
+	s.stopped = true
+}
+
+// session handles the packets of one client. It returns true if the
+// client killed the target.
+func (s *Server) session(conn net.Conn) bool {
+	packets := make(chan string)
+	// done stops the reader once the session is over
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(packets)
+		reader := bufio.NewReader(conn)
+		for {
+			packet, err := readPacket(reader, conn, s.d.Interrupt)
+			if err != nil {
+				return
+			}
+			select {
+			case packets <- packet:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for packet := range packets {
+		reply, resumed := s.handle(packet)
+		switch {
+		case packet == "k":
+			s.d.Detach()
+			return true
+		case resumed && packet == "D":
+			_ = writePacket(conn, reply)
+			return false
+		case resumed:
+			// Wait until the CPU stops again, the reader goroutine passes
+			// on Ctrl-C in the meantime
+			if !s.waitWhileRunning(packets) {
+				return false
+			}
+			reply = stopReply(s.lastStop)
+		}
+		if err := writePacket(conn, reply); err != nil {
+			return false
+		}
+	}
+	return false
+}
+
+// waitWhileRunning waits until the CPU stops. Packets sent while the CPU
+// runs are ignored. It returns false if the client disconnects.
+func (s *Server) waitWhileRunning(packets <-chan string) bool {
+	for {
+		select {
+		case stop := <-s.d.Stops():
+			s.lastStop = stop
+			s.stopped = true
+			return true
+		case packet, ok := <-packets:
+			if !ok {
+				return false
+			}
+			Logger.Warnf("GDB packet ignored while running: %s", packet)
+		}
+	}
+}
+
+// stopReply creates the reply that tells GDB why the CPU stopped
+func stopReply(stop Debugger.Stop) string {
+	switch stop.Reason {
+	case Debugger.StopInterrupt:
+		return fmt.Sprintf("S%02x", signalInterrupt)
+	case Debugger.StopHistoryStart:
+		return fmt.Sprintf("T%02xreplaylog:begin;", signalTrap)
+	}
+	return fmt.Sprintf("S%02x", signalTrap)
+}
+
+// handle executes a packet and returns the reply. resumed is true if
+// the CPU was resumed, the reply is then sent once it stops.
+func (s *Server) handle(packet string) (reply string, resumed bool) {
+	if packet == "" {
+		return "", false
+	}
+
+	switch packet[0] {
+	case '?':
+		return stopReply(s.lastStop), false
+	case 'g':
+		return encodeRegisters(s.d.CPU().Registers()), false
+	case 'G':
+		registers, err := decodeRegisters(packet[1:])
+		if err != nil {
+			return "E01", false
+		}
+		s.d.CPU().SetRegisters(registers)
+		return "OK", false
+	case 'p':
+		number, err := strconv.ParseUint(packet[1:], 16, 8)
+		if err != nil || number >= registerCount {
+			return "E01", false
+		}
+		return encodeRegisters(s.d.CPU().Registers())[registerOffset(int(number)):registerOffset(int(number)+1)], false
+	case 'P':
+		return s.writeRegister(packet[1:]), false
+	case 'm':
+		return s.readMemory(packet[1:]), false
+	case 'M':
+		return s.writeMemory(packet[1:], false), false
+	case 'X':
+		return s.writeMemory(packet[1:], true), false
+	case 'Z', 'z':
+		return s.breakpoint(packet), false
+	case 'c':
+		if !s.setPC(packet[1:]) {
+			return "E01", false
+		}
+		s.stopped = false
+		s.d.Continue()
+		return "", true
+	case 's':
+		if !s.setPC(packet[1:]) {
+			return "E01", false
+		}
+		s.stopped = false
+		s.d.Step()
+		return "", true
+	case 'b':
+		return s.reverse(packet[1:]), false
+	case 'D':
+		for address, id := range s.breakpoints {
+			s.d.DeleteBreakpoint(id)
+			delete(s.breakpoints, address)
+		}
+		s.stopped = false
+		s.d.Continue()
+		return "OK", true
+	case 'H':
+		return "OK", false
+	case 'q':
+		return s.query(packet[1:]), false
+	default:
+		return "", false
+	}
+}
+
+// reverse runs the CPU backwards for the bs and bc packets. The CPU stays
+// stopped, so the stop reply is sent right away.
+func (s *Server) reverse(packet string) string {
+	var stop Debugger.Stop
+	var err error
+	switch packet {
+	case "s":
+		stop, err = s.d.StepBack()
+	case "c":
+		stop, err = s.d.ReverseContinue()
+	default:
+		return ""
+	}
+	if err != nil {
+		Logger.Warnf("GDB: %s", err)
+		return "E01"
+	}
+	s.lastStop = stop
+	return stopReply(stop)
+}
+
+// query answers the general query packets
+func (s *Server) query(query string) string {
+	switch {
+	case strings.HasPrefix(query, "Supported"):
+		return "PacketSize=4000;qXfer:features:read+;ReverseStep+;ReverseContinue+"
+	case query == "Attached":
+		return "1"
+	case query == "C":
+		return "QC1"
+	case query == "fThreadInfo":
+		return "m1"
+	case query == "sThreadInfo":
+		return "l"
+	case strings.HasPrefix(query, "Xfer:features:read:target.xml:"):
+		var offset, length int
+		if _, err := fmt.Sscanf(strings.TrimPrefix(query, "Xfer:features:read:target.xml:"), "%x,%x", &offset, &length); err != nil {
+			return "E01"
+		}
+		if offset >= len(targetXML) {
+			return "l"
+		}
+		if offset+length >= len(targetXML) {
+			return "l" + targetXML[offset:]
+		}
+		return "m" + targetXML[offset:offset+length]
+	default:
+		return ""
+	}
+}
+
+// setPC changes the PC if a c or s packet carries an address
+func (s *Server) setPC(address string) bool {
+	if address == "" {
+		return true
+	}
+	pc, err := strconv.ParseUint(address, 16, 16)
+	if err != nil {
+		return false
+	}
+	registers := s.d.CPU().Registers()
+	registers.PC = uint16(pc)
+	s.d.CPU().SetRegisters(registers)
+	return true
+}
+
+func (s *Server) writeRegister(assignment string) string {
+	parts := strings.SplitN(assignment, "=", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	number, err := strconv.ParseUint(parts[0], 16, 8)
+	if err != nil || number >= registerCount {
+		return "E01"
+	}
+	value, err := hex.DecodeString(parts[1])
+	if err != nil || len(value) != registerOffset(int(number)+1)/2-registerOffset(int(number))/2 {
+		return "E01"
+	}
+
+	registers := s.d.CPU().Registers()
+	switch number {
+	case regA:
+		registers.A = value[0]
+	case regX:
+		registers.X = value[0]
+	case regY:
+		registers.Y = value[0]
+	case regSP:
+		registers.SP = value[0]
+	case regPC:
+		registers.PC = CPU.CombineLowHigh(value[0], value[1])
+	case regP:
+		registers.P = value[0]
+	}
+	s.d.CPU().SetRegisters(registers)
+	return "OK"
+}
+
+// parseRange parses "addr,length"
+func parseRange(text string) (uint16, int, error) {
+	var address, length uint64
+	parts := strings.SplitN(text, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range: %s", text)
+	}
+	address, err := strconv.ParseUint(parts[0], 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	if length, err = strconv.ParseUint(parts[1], 16, 32); err != nil || length > 0x10000 {
+		return 0, 0, fmt.Errorf("invalid length: %s", parts[1])
+	}
+	return uint16(address), int(length), nil
+}
+
+func (s *Server) readMemory(arguments string) string {
+	address, length, err := parseRange(arguments)
+	if err != nil {
+		return "E01"
+	}
+	data := make([]byte, length)
+	for i := range data {
+		data[i] = s.d.Peek(address + uint16(i))
+	}
+	return hex.EncodeToString(data)
+}
+
+func (s *Server) writeMemory(arguments string, binary bool) string {
+	parts := strings.SplitN(arguments, ":", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	address, length, err := parseRange(parts[0])
+	if err != nil {
+		return "E01"
+	}
+
+	data := []byte(parts[1])
+	if !binary {
+		if data, err = hex.DecodeString(parts[1]); err != nil {
+			return "E01"
+		}
+	}
+	if len(data) != length {
+		return "E01"
+	}
+	for i, b := range data {
+		s.d.Poke(address+uint16(i), b)
+	}
+	return "OK"
+}
+
+// breakpoint handles Z and z packets. Software and hardware breakpoints
+// are the same for the emulator.
+func (s *Server) breakpoint(packet string) string {
+	parts := strings.Split(packet[1:], ",")
+	if len(parts) < 2 || (parts[0] != "0" && parts[0] != "1") {
+		return ""
+	}
+	address, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "E01"
+	}
+
+	id, exists := s.breakpoints[uint16(address)]
+	if packet[0] == 'Z' {
+		if !exists {
+			s.breakpoints[uint16(address)] = s.d.AddBreakpoint(uint16(address), false).Id
+		}
+		return "OK"
+	}
+	if exists {
+		s.d.DeleteBreakpoint(id)
+		delete(s.breakpoints, uint16(address))
+	}
+	return "OK"
+}
+
+// registerOffset returns the offset of the register in the hex encoding of the g packet
+func registerOffset(number int) int {
+	if number > regPC {
+		// PC is the only 16 bit register
+		return (number + 1) * 2
+	}
+	return number * 2
+}
+
+func encodeRegisters(registers CPU.Registers) string {
+	return hex.EncodeToString([]byte{
+		registers.A,
+		registers.X,
+		registers.Y,
+		registers.SP,
+		uint8(registers.PC),
+		uint8(registers.PC >> 8),
+		registers.P,
+	})
+}
+
+func decodeRegisters(text string) (CPU.Registers, error) {
+	data, err := hex.DecodeString(text)
+	if err != nil || len(data) != registerOffset(registerCount)/2 {
+		return CPU.Registers{}, fmt.Errorf("invalid registers: %s", text)
+	}
+	return CPU.Registers{
+		A:  data[0],
+		X:  data[1],
+		Y:  data[2],
+		SP: data[3],
+		PC: CPU.CombineLowHigh(data[4], data[5]),
+		P:  data[6],
+	}, nil
+}
@@ -0,0 +1,166 @@
+package GDB
+
+import (
+	"bufio"
+	"emu6502/ComputeUnit"
+	"emu6502/Debugger"
+	"emu6502/Logger"
+	"emu6502/Machine"
+	"emu6502/Scheduler"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client speaks the protocol like GDB does
+type client struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// send sends a packet and returns the reply
+func (c *client) send(packet string) string {
+	c.t.Helper()
+	if err := writePacket(c.conn, packet); err != nil {
+		c.t.Fatal(err)
+	}
+	if ack, err := c.reader.ReadByte(); err != nil || ack != '+' {
+		c.t.Fatalf("%s: no acknowledgement, got %q %v", packet, ack, err)
+	}
+	return c.receive()
+}
+
+// receive reads the next reply
+func (c *client) receive() string {
+	c.t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := readPacket(c.reader, io.Discard, func() {})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return reply
+}
+
+// expect sends a packet and checks the reply
+func (c *client) expect(packet string, expected string) {
+	c.t.Helper()
+	if reply := c.send(packet); reply != expected {
+		c.t.Errorf("%s: got %q, expected %q", packet, reply, expected)
+	}
+}
+
+// start runs hello.rom on one CPU with the GDB server attached
+func start(t *testing.T) (*client, *Debugger.Debugger, func()) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+
+	bus, mappings, err := Machine.Boot("../../hello.rom", io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cu := ComputeUnit.NewComputeUnit(bus, mappings, 0)
+	d := Debugger.Attach(cu.CPU(), true)
+	server, err := Listen("127.0.0.1:0", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+
+	cu.Reset()
+	scheduler, err := Scheduler.NewScheduler([]*ComputeUnit.ComputeUnit{cu}, Scheduler.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler.Run()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client{t: t, conn: conn, reader: bufio.NewReader(conn)}, d, func() {
+		_ = conn.Close()
+		_ = server.Close()
+		d.Detach()
+		scheduler.Halt()
+	}
+}
+
+func TestSession(t *testing.T) {
+	c, _, stop := start(t)
+	defer stop()
+
+	if reply := c.send("qSupported:multiprocess+"); !strings.Contains(reply, "qXfer:features:read+") {
+		t.Errorf("qSupported: got %q", reply)
+	}
+	if reply := c.send("qXfer:features:read:target.xml:0,fff"); !strings.HasPrefix(reply, "l<?xml") {
+		t.Errorf("target.xml: got %q", reply)
+	}
+	c.expect("?", "S05")
+	c.expect("g", "000000ff474020")
+	c.expect("m4047,3", "a200bd")
+	c.expect("vMustReplyEmpty", "")
+
+	// Run into the loop that prints the string
+	c.expect("Z0,404e,1", "OK")
+	c.expect("c", "S05")
+	c.expect("p4", "4e40")
+	c.expect("s", "S05")
+	c.expect("p4", "5140")
+	c.expect("z0,404e,1", "OK")
+
+	c.expect("M0300,2:beef", "OK")
+	c.expect("m0300,2", "beef")
+	c.expect("X0302,1:}", "OK")
+	c.expect("m0302,1", "7d")
+	c.expect("P0=41", "OK")
+	c.expect("p0", "41")
+	c.expect("P4=4740", "OK")
+	c.expect("p4", "4740")
+
+	// Ctrl-C stops the running CPU
+	if err := writePacket(c.conn, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if ack, err := c.reader.ReadByte(); err != nil || ack != '+' {
+		t.Fatalf("c: no acknowledgement")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if _, err := c.conn.Write([]byte{interruptByte}); err != nil {
+		t.Fatal(err)
+	}
+	if reply := c.receive(); reply != "S02" {
+		t.Errorf("interrupt: got %q, expected S02", reply)
+	}
+}
+
+func TestOwnBreakpoints(t *testing.T) {
+	c, d, stop := start(t)
+	defer stop()
+
+	// The monitor's breakpoint survives z0 and D at the same address
+	monitor := d.AddBreakpoint(0x404E, false)
+	c.expect("Z0,404e,1", "OK")
+	c.expect("Z0,404e,1", "OK")
+	c.expect("z0,404e,1", "OK")
+	c.expect("Z0,4054,1", "OK")
+	c.expect("Z0,404e,1", "OK")
+	c.expect("D", "OK")
+	if breakpoints := d.Breakpoints(); len(breakpoints) != 1 || breakpoints[0] != monitor {
+		t.Errorf("breakpoints after D: got %v, expected only the monitor's", breakpoints)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	var reply strings.Builder
+	reader := bufio.NewReader(strings.NewReader("+$g#00$g#67"))
+	packet, err := readPacket(reader, &reply, func() {})
+	if err != nil || packet != "g" {
+		t.Fatalf("got %q %v", packet, err)
+	}
+	if reply.String() != "-+" {
+		t.Errorf("acknowledgements: got %q, expected \"-+\"", reply.String())
+	}
+}
@@ -0,0 +1,96 @@
+package GDB
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// interruptByte is sent by GDB outside of a packet to stop the target
+const interruptByte = 0x03
+
+// readPacket reads the next packet and acknowledges it. Interrupts that
+// arrive in between are passed to onInterrupt.
+func readPacket(reader *bufio.Reader, writer io.Writer, onInterrupt func()) (string, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch b {
+		case interruptByte:
+			onInterrupt()
+			continue
+		case '$':
+		default:
+			// Acknowledgements and noise between packets
+			continue
+		}
+
+		data, err := reader.ReadString('#')
+		if err != nil {
+			return "", err
+		}
+		data = data[:len(data)-1]
+
+		checksum := make([]byte, 2)
+		if _, err := io.ReadFull(reader, checksum); err != nil {
+			return "", err
+		}
+		var expected uint8
+		if _, err := fmt.Sscanf(string(checksum), "%02x", &expected); err != nil || expected != sum(data) {
+			if _, err := writer.Write([]byte{'-'}); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if _, err := writer.Write([]byte{'+'}); err != nil {
+			return "", err
+		}
+		return unescape(data), nil
+	}
+}
+
+// writePacket sends a packet. Acknowledgements are read by readPacket
+// together with the next command, so they are not waited for here.
+func writePacket(writer io.Writer, data string) error {
+	_, err := fmt.Fprintf(writer, "$%s#%02x", escape(data), sum(escape(data)))
+	return err
+}
+
+// sum calculates the checksum of a packet
+func sum(data string) uint8 {
+	var checksum uint8
+	for i := 0; i < len(data); i++ {
+		checksum += data[i]
+	}
+	return checksum
+}
+
+// escape escapes the characters that have a meaning in the protocol
+func escape(data string) string {
+	escaped := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '$', '#', '}', '*':
+			escaped = append(escaped, '}', data[i]^0x20)
+		default:
+			escaped = append(escaped, data[i])
+		}
+	}
+	return string(escaped)
+}
+
+// unescape reverses escape, it is needed for binary data sent by GDB
+func unescape(data string) string {
+	unescaped := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			unescaped = append(unescaped, data[i]^0x20)
+			continue
+		}
+		unescaped = append(unescaped, data[i])
+	}
+	return string(unescaped)
+}
@@ -0,0 +1,93 @@
+package Debugger
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+)
+
+// Listing maps the lines of an Ophis listing file to the addresses of the
+// instructions on them. A line belongs to an address if it starts with
+// " %04X".
+type Listing struct {
+	Path string
+	// lines contains the address of every line, -1 for lines without one
+	lines     []int
+	text      []string
+	addresses map[uint16]int
+}
+
+// LoadListing reads a listing file
+func LoadListing(path string) (*Listing, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	l := &Listing{Path: path, addresses: make(map[uint16]int)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		l.text = append(l.text, scanner.Text())
+		address, ok := parseListingAddress(scanner.Text())
+		if !ok {
+			l.lines = append(l.lines, -1)
+			continue
+		}
+		if _, exists := l.addresses[address]; !exists {
+			l.addresses[address] = len(l.lines)
+		}
+		l.lines = append(l.lines, int(address))
+	}
+	return l, scanner.Err()
+}
+
+// parseListingAddress returns the address at the start of a listing line
+func parseListingAddress(line string) (uint16, bool) {
+	if len(line) < 5 || line[0] != ' ' {
+		return 0, false
+	}
+	if len(line) > 5 && isHexDigit(line[5]) {
+		return 0, false
+	}
+	address, err := strconv.ParseUint(line[1:5], 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(address), true
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// Line returns the zero based line of the instruction at the address
+func (l *Listing) Line(address uint16) (int, bool) {
+	if l == nil {
+		return 0, false
+	}
+	line, ok := l.addresses[address]
+	return line, ok
+}
+
+// Address returns the address of the first instruction at or after the
+// zero based line, together with the line it was found on
+func (l *Listing) Address(line int) (uint16, int, bool) {
+	if l == nil || line < 0 {
+		return 0, 0, false
+	}
+	for ; line < len(l.lines); line++ {
+		if l.lines[line] >= 0 {
+			return uint16(l.lines[line]), line, true
+		}
+	}
+	return 0, 0, false
+}
+
+// Text returns the zero based line as it is written in the listing
+func (l *Listing) Text(line int) (string, bool) {
+	if l == nil || line < 0 || line >= len(l.text) {
+		return "", false
+	}
+	return l.text[line], true
+}
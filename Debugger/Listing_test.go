@@ -0,0 +1,51 @@
+package Debugger
+
+import "testing"
+
+func TestListing(t *testing.T) {
+	listing, err := LoadListing("DAP/testdata/hello.l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first line is the "; printDec8" comment
+	for address, expected := range map[uint16]int{0x4020: 1, 0x4022: 2, 0x403B: 17, 0x4047: 26} {
+		if line, ok := listing.Line(address); !ok || line != expected {
+			t.Errorf("line of $%04X: got %d %v, expected %d", address, line, ok, expected)
+		}
+	}
+	if _, ok := listing.Line(0x4021); ok {
+		t.Error("the operand of an instruction has a line")
+	}
+
+	// Comments map to the next instruction
+	if address, line, ok := listing.Address(16); !ok || address != 0x403B || line != 17 {
+		t.Errorf("address of line 16: got $%04X on line %d %v, expected $403B on line 17", address, line, ok)
+	}
+	if _, _, ok := listing.Address(-1); ok {
+		t.Error("line -1 has an address")
+	}
+	if _, _, ok := listing.Address(1 << 20); ok {
+		t.Error("a line after the end has an address")
+	}
+
+	if text, ok := listing.Text(1); !ok || text != " 4020  A2 FF     LDX #$FF" {
+		t.Errorf("text of line 1: got %q %v", text, ok)
+	}
+	if _, ok := listing.Text(1 << 20); ok {
+		t.Error("a line after the end has text")
+	}
+
+	var missing *Listing
+	if _, ok := missing.Line(0x4020); ok {
+		t.Error("a nil listing has lines")
+	}
+	if _, err := LoadListing("DAP/testdata/missing.l"); err == nil {
+		t.Error("loading a missing listing succeeded")
+	}
+
+	for line, expected := range map[string]bool{" 4020  A2 FF     LDX #$FF": true, " 4020": true, "; start": false, " 40200": false, " XYZW  ": false} {
+		if _, ok := parseListingAddress(line); ok != expected {
+			t.Errorf("%q: got %v, expected %v", line, ok, expected)
+		}
+	}
+}
@@ -0,0 +1,609 @@
+package Debugger
+
+import (
+	"bufio"
+	"emu6502/Disassembler"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Monitor is an interactive command line frontend for the debugger
+type Monitor struct {
+	d   *Debugger
+	in  *bufio.Scanner
+	out io.Writer
+	// Listing shows the source line of the instruction at a stop
+	Listing *Listing
+
+	// lastCommand is repeated when an empty line is entered
+	lastCommand string
+	quitting    bool
+	quit        chan struct{}
+}
+
+// monitorCommand executes a command with its arguments. It returns true
+// if the CPU was resumed.
+type monitorCommand struct {
+	names   []string
+	usage   string
+	execute func(m *Monitor, args []string) (bool, error)
+}
+
+var monitorCommands []monitorCommand
+
+func init() {
+	monitorCommands = []monitorCommand{
+		{[]string{"break", "b"}, "break <address> [if <condition>]    set a breakpoint", (*Monitor).cmdBreak},
+		{[]string{"tbreak", "tb"}, "tbreak <address> [if <condition>]   set a breakpoint that is deleted when hit", (*Monitor).cmdBreak},
+		{[]string{"watch", "w"}, "watch <range> [if <condition>]      stop when a write changes memory", (*Monitor).cmdWatch},
+		{[]string{"wwatch"}, "wwatch <range> [if <condition>]     stop at every write", (*Monitor).cmdWatch},
+		{[]string{"rwatch"}, "rwatch <range> [if <condition>]     stop at every read", (*Monitor).cmdWatch},
+		{[]string{"awatch"}, "awatch <range> [if <condition>]     stop at every read or write", (*Monitor).cmdWatch},
+		{[]string{"condition", "cond"}, "condition <id> [condition]          set or remove the condition of a breakpoint", (*Monitor).cmdCondition},
+		{[]string{"ignore"}, "ignore <id> <count>                 ignore the next hits of a breakpoint", (*Monitor).cmdIgnore},
+		{[]string{"delete", "d"}, "delete [id]                         delete a breakpoint, or all of them", (*Monitor).cmdDelete},
+		{[]string{"info", "i"}, "info                                list the breakpoints and watchpoints", (*Monitor).cmdInfo},
+		{[]string{"print", "p"}, "print <expression>                  evaluate an expression", (*Monitor).cmdPrint},
+		{[]string{"step", "s"}, "step [count]                        execute instructions", (*Monitor).cmdStep},
+		{[]string{"next", "n"}, "next                                execute an instruction, stepping over JSR", (*Monitor).cmdNext},
+		{[]string{"finish", "f"}, "finish                              run until the current subroutine returns", (*Monitor).cmdFinish},
+		{[]string{"continue", "c"}, "continue                            run until a breakpoint is hit", (*Monitor).cmdContinue},
+		{[]string{"record"}, "record [size|off]                   record instructions to run backwards", (*Monitor).cmdRecord},
+		{[]string{"back", "bs"}, "back [count]                        take back the last instructions", (*Monitor).cmdBack},
+		{[]string{"rcontinue", "rc"}, "rcontinue                           run backwards until a breakpoint is hit", (*Monitor).cmdReverseContinue},
+		{[]string{"lastwrite", "lw"}, "lastwrite <address>                 find the last instruction that wrote", (*Monitor).cmdLastWrite},
+		{[]string{"registers", "r"}, "registers [name [value]]            show or set registers (a, x, y, sp, pc, p)", (*Monitor).cmdRegisters},
+		{[]string{"dump", "x"}, "dump <address> [length]             dump memory in hex and ASCII", (*Monitor).cmdDump},
+		{[]string{"edit", "e"}, "edit <address> <byte>...            write bytes to memory", (*Monitor).cmdEdit},
+		{[]string{"disasm", "l"}, "disasm [address] [count]            disassemble around the PC or at the address", (*Monitor).cmdDisasm},
+		{[]string{"backtrace", "bt"}, "backtrace                           show the subroutine calls", (*Monitor).cmdBacktrace},
+		{[]string{"help", "h", "?"}, "help                                show this help", (*Monitor).cmdHelp},
+		{[]string{"quit", "q"}, "quit                                detach the monitor and stop the emulator", (*Monitor).cmdQuit},
+	}
+}
+
+// NewMonitor creates a monitor that reads commands from in and writes to out
+func NewMonitor(d *Debugger, in io.Reader, out io.Writer) *Monitor {
+	return &Monitor{
+		d:    d,
+		in:   bufio.NewScanner(in),
+		out:  out,
+		quit: make(chan struct{}),
+	}
+}
+
+// Quit is closed when the user quits the monitor
+func (m *Monitor) Quit() <-chan struct{} {
+	return m.quit
+}
+
+// Run waits for the CPU to stop and reads commands until it is resumed.
+// It returns when the input ends or the user quits.
+func (m *Monitor) Run() {
+	for stop := range m.d.Stops() {
+		m.printStop(stop)
+		for {
+			fmt.Fprint(m.out, "(mon) ")
+			if !m.in.Scan() {
+				m.cmdQuit(nil)
+				return
+			}
+			resumed := m.execute(m.in.Text())
+			// quit resumes the CPU as well, but there won't be another stop
+			if m.quitting {
+				return
+			}
+			if resumed {
+				break
+			}
+		}
+	}
+}
+
+// execute runs one command line and reports whether the CPU was resumed
+func (m *Monitor) execute(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		line = m.lastCommand
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	m.lastCommand = line
+
+	name := strings.ToLower(fields[0])
+	for _, command := range monitorCommands {
+		for _, commandName := range command.names {
+			if commandName != name {
+				continue
+			}
+			resumed, err := command.execute(m, fields)
+			if err != nil {
+				fmt.Fprintf(m.out, "%s\n", err)
+			}
+			return resumed
+		}
+	}
+	fmt.Fprintf(m.out, "Unknown command %s, try help\n", fields[0])
+	return false
+}
+
+func (m *Monitor) printStop(stop Stop) {
+	switch stop.Reason {
+	case StopBreakpoint:
+		fmt.Fprintf(m.out, "Breakpoint %d at %s\n", stop.Breakpoint.Id, m.d.Symbols.Describe(stop.PC))
+	case StopWatchpoint:
+		access := stop.Access
+		switch {
+		case !access.Write:
+			fmt.Fprintf(m.out, "Watchpoint %d: %s read $%02X\n", stop.Watchpoint.Id, m.d.Symbols.Describe(access.Address), access.Value)
+		case access.Value != access.Old:
+			fmt.Fprintf(m.out, "Watchpoint %d: %s changed from $%02X to $%02X\n", stop.Watchpoint.Id, m.d.Symbols.Describe(access.Address), access.Old, access.Value)
+		default:
+			fmt.Fprintf(m.out, "Watchpoint %d: %s written $%02X\n", stop.Watchpoint.Id, m.d.Symbols.Describe(access.Address), access.Value)
+		}
+		if stop.Reverse {
+			fmt.Fprintln(m.out, "by the next instruction")
+		} else if history := m.d.History(); len(history) > 0 {
+			fmt.Fprintf(m.out, "by the instruction at %s\n", m.d.Symbols.Describe(history[len(history)-1]))
+		}
+	case StopStep:
+	default:
+		fmt.Fprintf(m.out, "Stopped (%s) at %s\n", stop.Reason, m.d.Symbols.Describe(stop.PC))
+	}
+	fmt.Fprintf(m.out, "%s\n", m.d.CPU().Registers())
+	m.printLine(Disassembler.Decode(m.d.Peek, stop.PC), stop.PC)
+	if line, ok := m.Listing.Line(stop.PC); ok {
+		text, _ := m.Listing.Text(line)
+		fmt.Fprintf(m.out, "%s:%d: %s\n", filepath.Base(m.Listing.Path), line+1, text)
+	}
+}
+
+// printLine prints a disassembled line, marking the PC
+func (m *Monitor) printLine(line Disassembler.Line, pc uint16) {
+	marker := "  "
+	if line.Address == pc {
+		marker = "=>"
+	}
+	label := ""
+	if name, ok := m.d.Symbols.Labels()[line.Address]; ok {
+		label = name + ":"
+	}
+	fmt.Fprintf(m.out, "%s %-16s %s\n", marker, label, line.Format(m.d.Symbols.Labels()))
+}
+
+// splitCondition splits the arguments at "if" into the location and the condition
+func splitCondition(args []string) ([]string, string) {
+	for i, arg := range args {
+		if strings.ToLower(arg) == "if" {
+			return args[:i], strings.Join(args[i+1:], " ")
+		}
+	}
+	return args, ""
+}
+
+func (m *Monitor) cmdBreak(args []string) (bool, error) {
+	args, condition := splitCondition(args)
+	if len(args) != 2 {
+		return false, fmt.Errorf("usage: %s <address> [if <condition>]", args[0])
+	}
+	address, err := m.d.Symbols.ParseAddress(args[1])
+	if err != nil {
+		return false, err
+	}
+	if condition != "" {
+		// Check the condition before the breakpoint exists
+		if _, err := ParseExpression(condition, m.d.Symbols); err != nil {
+			return false, err
+		}
+	}
+	temporary := strings.HasPrefix(strings.ToLower(args[0]), "t")
+	breakpoint := m.d.AddBreakpoint(address, temporary)
+	if err := m.d.SetCondition(breakpoint.Id, condition); err != nil {
+		return false, err
+	}
+	fmt.Fprintf(m.out, "Breakpoint %d at %s\n", breakpoint.Id, m.d.Symbols.Describe(address))
+	return false, nil
+}
+
+func (m *Monitor) cmdWatch(args []string) (bool, error) {
+	args, condition := splitCondition(args)
+	if len(args) != 2 {
+		return false, fmt.Errorf("usage: %s <range> [if <condition>]", args[0])
+	}
+	start, end, err := m.d.Symbols.ParseRange(args[1])
+	if err != nil {
+		return false, err
+	}
+	kind := map[string]WatchKind{"rwatch": WatchRead, "wwatch": WatchWrite, "awatch": WatchAccess}[strings.ToLower(args[0])]
+	watchpoint, err := m.d.AddWatchpoint(start, end, kind, condition)
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprintf(m.out, "Watchpoint %d (%s) at %s\n", watchpoint.Id, watchpoint.Kind, m.d.Symbols.Describe(start))
+	return false, nil
+}
+
+func (m *Monitor) cmdCondition(args []string) (bool, error) {
+	if len(args) < 2 {
+		return false, fmt.Errorf("usage: %s <id> [condition]", args[0])
+	}
+	id, err := strconv.Atoi(args[1])
+	if err != nil {
+		return false, fmt.Errorf("invalid id %s", args[1])
+	}
+	return false, m.d.SetCondition(id, strings.Join(args[2:], " "))
+}
+
+func (m *Monitor) cmdIgnore(args []string) (bool, error) {
+	if len(args) != 3 {
+		return false, fmt.Errorf("usage: %s <id> <count>", args[0])
+	}
+	id, err := strconv.Atoi(args[1])
+	if err != nil {
+		return false, fmt.Errorf("invalid id %s", args[1])
+	}
+	count, err := strconv.Atoi(args[2])
+	if err != nil {
+		return false, fmt.Errorf("invalid count %s", args[2])
+	}
+	return false, m.d.SetIgnoreCount(id, count)
+}
+
+func (m *Monitor) cmdPrint(args []string) (bool, error) {
+	if len(args) < 2 {
+		return false, fmt.Errorf("usage: %s <expression>", args[0])
+	}
+	value, err := m.d.Evaluate(strings.Join(args[1:], " "))
+	if errors.Is(err, ErrUnknownValue) {
+		fmt.Fprintln(m.out, "??")
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	fmt.Fprintf(m.out, "$%04X (%d)\n", uint16(value), value)
+	return false, nil
+}
+
+func (m *Monitor) cmdDelete(args []string) (bool, error) {
+	if len(args) == 1 {
+		m.d.ClearBreakpoints()
+		return false, nil
+	}
+	for _, arg := range args[1:] {
+		id, err := strconv.Atoi(arg)
+		if err != nil || !m.d.DeleteBreakpoint(id) {
+			return false, fmt.Errorf("no breakpoint %s", arg)
+		}
+	}
+	return false, nil
+}
+
+func (m *Monitor) cmdInfo(args []string) (bool, error) {
+	breakpoints, watchpoints := m.d.Breakpoints(), m.d.Watchpoints()
+	if len(breakpoints) == 0 && len(watchpoints) == 0 {
+		fmt.Fprintln(m.out, "No breakpoints")
+	}
+	for _, breakpoint := range breakpoints {
+		kind := "break"
+		if breakpoint.Temporary {
+			kind = "tbreak"
+		}
+		fmt.Fprintf(m.out, "%3d %-6s %s hit %d times%s\n", breakpoint.Id, kind, m.d.Symbols.Describe(breakpoint.Address), breakpoint.Hits, describeFilter(breakpoint.Condition, breakpoint.Ignore))
+	}
+	for _, watchpoint := range watchpoints {
+		fmt.Fprintf(m.out, "%3d %-6s %s hit %d times%s\n", watchpoint.Id, watchpoint.Kind, watchpoint, watchpoint.Hits, describeFilter(watchpoint.Condition, watchpoint.Ignore))
+	}
+	return false, nil
+}
+
+// describeFilter describes the condition and ignore count for info
+func describeFilter(condition *Expression, ignore int) string {
+	text := ""
+	if condition != nil {
+		text += fmt.Sprintf(", if %s", condition)
+	}
+	if ignore > 0 {
+		text += fmt.Sprintf(", ignoring the next %d hits", ignore)
+	}
+	return text
+}
+
+func (m *Monitor) cmdStep(args []string) (bool, error) {
+	count := 1
+	if len(args) > 1 {
+		var err error
+		if count, err = strconv.Atoi(args[1]); err != nil || count < 1 {
+			return false, fmt.Errorf("invalid count: %s", args[1])
+		}
+	}
+	// All but the last step are executed silently
+	for i := 1; i < count; i++ {
+		m.d.Step()
+		if stop := <-m.d.Stops(); stop.Reason != StopStep {
+			m.printStop(stop)
+			return false, nil
+		}
+	}
+	m.d.Step()
+	return true, nil
+}
+
+func (m *Monitor) cmdNext(args []string) (bool, error) {
+	m.d.Next()
+	return true, nil
+}
+
+func (m *Monitor) cmdFinish(args []string) (bool, error) {
+	if len(m.d.CallStack()) == 0 {
+		return false, fmt.Errorf("not inside a subroutine")
+	}
+	m.d.Finish()
+	return true, nil
+}
+
+func (m *Monitor) cmdContinue(args []string) (bool, error) {
+	m.d.Continue()
+	return true, nil
+}
+
+func (m *Monitor) cmdRecord(args []string) (bool, error) {
+	size := DefaultRecordSize
+	if len(args) > 1 {
+		if strings.EqualFold(args[1], "off") {
+			size = 0
+		} else if n, err := strconv.Atoi(args[1]); err != nil || n < 1 {
+			return false, fmt.Errorf("invalid size: %s", args[1])
+		} else {
+			size = n
+		}
+	}
+	m.d.EnableRecording(size)
+	if size == 0 {
+		fmt.Fprintln(m.out, "Recording is off")
+	} else {
+		fmt.Fprintf(m.out, "Recording the last %d instructions\n", size)
+	}
+	return false, nil
+}
+
+func (m *Monitor) cmdBack(args []string) (bool, error) {
+	count := 1
+	if len(args) > 1 {
+		var err error
+		if count, err = strconv.Atoi(args[1]); err != nil || count < 1 {
+			return false, fmt.Errorf("invalid count: %s", args[1])
+		}
+	}
+	// All but the last step are taken back silently
+	for i := 1; i <= count; i++ {
+		stop, err := m.d.StepBack()
+		if err != nil {
+			return false, err
+		}
+		if i == count || stop.Reason != StopStep {
+			m.printStop(stop)
+			break
+		}
+	}
+	return false, nil
+}
+
+func (m *Monitor) cmdReverseContinue(args []string) (bool, error) {
+	stop, err := m.d.ReverseContinue()
+	if err != nil {
+		return false, err
+	}
+	m.printStop(stop)
+	return false, nil
+}
+
+func (m *Monitor) cmdLastWrite(args []string) (bool, error) {
+	if len(args) < 2 {
+		return false, fmt.Errorf("usage: lastwrite <address>")
+	}
+	address, err := m.d.Symbols.ParseAddress(args[1])
+	if err != nil {
+		return false, err
+	}
+	write, back, pc, err := m.d.LastWrite(address)
+	if err != nil {
+		return false, err
+	}
+	old := ""
+	if write.Undoable {
+		old = fmt.Sprintf(" (was $%02X)", write.Old)
+	}
+	fmt.Fprintf(m.out, "%s set to $%02X%s by the instruction at %s, back %d\n",
+		m.d.Symbols.Describe(address), write.New, old, m.d.Symbols.Describe(pc), back)
+	return false, nil
+}
+
+func (m *Monitor) cmdRegisters(args []string) (bool, error) {
+	registers := m.d.CPU().Registers()
+	if len(args) == 1 {
+		fmt.Fprintf(m.out, "%s\n", registers)
+		return false, nil
+	}
+
+	var register8 *uint8
+	var register16 *uint16
+	switch strings.ToLower(args[1]) {
+	case "a":
+		register8 = &registers.A
+	case "x":
+		register8 = &registers.X
+	case "y":
+		register8 = &registers.Y
+	case "sp", "s":
+		register8 = &registers.SP
+	case "p":
+		register8 = &registers.P
+	case "pc":
+		register16 = &registers.PC
+	default:
+		return false, fmt.Errorf("unknown register: %s", args[1])
+	}
+
+	if len(args) == 2 {
+		if register16 != nil {
+			fmt.Fprintf(m.out, "%s = %s\n", args[1], m.d.Symbols.Describe(*register16))
+		} else {
+			fmt.Fprintf(m.out, "%s = $%02X (%d)\n", args[1], *register8, *register8)
+		}
+		return false, nil
+	}
+
+	value, err := m.d.Symbols.ParseAddress(args[2])
+	if err != nil {
+		return false, err
+	}
+	if register16 != nil {
+		*register16 = value
+	} else {
+		if value > 0xFF {
+			return false, fmt.Errorf("value doesn't fit into %s: %s", args[1], args[2])
+		}
+		*register8 = uint8(value)
+	}
+	m.d.CPU().SetRegisters(registers)
+	fmt.Fprintf(m.out, "%s\n", m.d.CPU().Registers())
+	return false, nil
+}
+
+func (m *Monitor) cmdDump(args []string) (bool, error) {
+	if len(args) < 2 {
+		return false, fmt.Errorf("usage: x <address> [length]")
+	}
+	address, err := m.d.Symbols.ParseAddress(args[1])
+	if err != nil {
+		return false, err
+	}
+	length := uint16(64)
+	if len(args) > 2 {
+		if length, err = ParseNumber(args[2]); err != nil {
+			return false, err
+		}
+	}
+
+	// The dump stops at the end of the address space
+	end := int(address) + int(length)
+	if end > 0x10000 {
+		end = 0x10000
+	}
+	for line := int(address); line < end; line += 16 {
+		hex := make([]string, 0, 16)
+		ascii := make([]byte, 0, 16)
+		for i := line; i < line+16 && i < end; i++ {
+			data, ok := m.d.StoredByteAt(uint16(i))
+			if !ok {
+				hex = append(hex, "??")
+				ascii = append(ascii, '?')
+				continue
+			}
+			hex = append(hex, fmt.Sprintf("%02X", data))
+			if data >= 0x20 && data < 0x7F {
+				ascii = append(ascii, data)
+			} else {
+				ascii = append(ascii, '.')
+			}
+		}
+		fmt.Fprintf(m.out, "%04X  %-47s  |%s|\n", line, strings.Join(hex, " "), ascii)
+	}
+	return false, nil
+}
+
+func (m *Monitor) cmdEdit(args []string) (bool, error) {
+	if len(args) < 3 {
+		return false, fmt.Errorf("usage: edit <address> <byte>...")
+	}
+	address, err := m.d.Symbols.ParseAddress(args[1])
+	if err != nil {
+		return false, err
+	}
+	for i, arg := range args[2:] {
+		value, err := ParseNumber(arg)
+		if err != nil {
+			return false, err
+		}
+		if value > 0xFF {
+			return false, fmt.Errorf("not a byte: %s", arg)
+		}
+		m.d.Poke(address+uint16(i), uint8(value))
+	}
+	return false, nil
+}
+
+func (m *Monitor) cmdDisasm(args []string) (bool, error) {
+	pc := m.d.CPU().PC()
+	count := 8
+	if len(args) > 2 {
+		value, err := ParseNumber(args[2])
+		if err != nil {
+			return false, err
+		}
+		count = int(value)
+	}
+
+	if len(args) > 1 {
+		address, err := m.d.Symbols.ParseAddress(args[1])
+		if err != nil {
+			return false, err
+		}
+		for _, line := range Disassembler.Range(m.d.Peek, address, count) {
+			m.printLine(line, pc)
+		}
+		return false, nil
+	}
+
+	// Show the last executed instructions, as disassembling backwards
+	// from the PC is ambiguous
+	history := m.d.History()
+	if len(history) > 4 {
+		history = history[len(history)-4:]
+	}
+	for _, address := range history {
+		if address != pc {
+			m.printLine(Disassembler.Decode(m.d.Peek, address), pc)
+		}
+	}
+	for _, line := range Disassembler.Range(m.d.Peek, pc, count) {
+		m.printLine(line, pc)
+	}
+	return false, nil
+}
+
+func (m *Monitor) cmdBacktrace(args []string) (bool, error) {
+	callStack := m.d.CallStack()
+	fmt.Fprintf(m.out, "#0  %s\n", m.d.Symbols.Describe(m.d.CPU().PC()))
+	for i := len(callStack) - 1; i >= 0; i-- {
+		fmt.Fprintf(m.out, "#%d  %s\n", len(callStack)-i, m.d.Symbols.Describe(callStack[i].CallSite))
+	}
+	return false, nil
+}
+
+func (m *Monitor) cmdHelp(args []string) (bool, error) {
+	for _, command := range monitorCommands {
+		alias := ""
+		if len(command.names) > 1 {
+			alias = command.names[len(command.names)-1]
+		}
+		fmt.Fprintf(m.out, "  %-4s %s\n", alias, command.usage)
+	}
+	fmt.Fprintln(m.out, "Addresses can be $hex, 0xhex, decimal or labels from the mapping file.")
+	fmt.Fprintln(m.out, "Ranges are <address>, <start>-<end> or <start>:<length>.")
+	fmt.Fprintln(m.out, "Conditions use registers, flags, labels, [byte] and {word} reads, like A == $0A && [label] > 3.")
+	return false, nil
+}
+
+func (m *Monitor) cmdQuit(args []string) (bool, error) {
+	m.d.Detach()
+	m.quitting = true
+	close(m.quit)
+	return true, nil
+}
@@ -0,0 +1,135 @@
+package Debugger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"emu6502/Logger"
+)
+
+// runMonitor feeds the script to a monitor attached to hello.rom and
+// returns what it printed. The CPU starts stopped at $4049.
+func runMonitor(t *testing.T, script string) string {
+	t.Helper()
+	d, _, _ := startHello(t)
+	d.Symbols = NewSymbols(Logger.LoadSymbols("DAP/testdata/hello.m"))
+	var out bytes.Buffer
+	m := NewMonitor(d, strings.NewReader(script), &out)
+	listing, err := LoadListing("DAP/testdata/hello.l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Listing = listing
+
+	d.Step()
+	done := make(chan struct{})
+	go func() {
+		m.Run()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the monitor didn't finish the script")
+	}
+	select {
+	case <-m.Quit():
+	default:
+		t.Error("the monitor didn't quit")
+	}
+	return out.String()
+}
+
+func TestMonitor(t *testing.T) {
+	output := runMonitor(t, `
+break _alphabet
+continue
+step
+edit $0300 $48 $65 $6C $6C $6F
+dump $0300 5
+print [$0300] + 1
+print [$4000]
+dump $4000 4
+`)
+	for _, expected := range []string{
+		"Breakpoint 1 at $4054 <_alphabet>\n",
+		"hello.l:33:  4054  A2 40     LDX #$40\n",
+		"=> _alphabet:       4054  A2 40     LDX #$40",
+		"=>                  4056  E8        INX",
+		"0300  48 65 6C 6C 6F                                   |Hello|\n",
+		"$0049 (73)\n",
+		"??\n",
+		"4000  ?? ?? ?? ??                                      |????|\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output doesn't contain %q:\n%s", expected, output)
+		}
+	}
+}
+
+func TestMonitorErrors(t *testing.T) {
+	output := runMonitor(t, `
+break
+break nowhere
+break $4054 if A ==
+edit $0300 $100
+dump
+dump $XYZ
+step 0
+frobnicate
+`)
+	for _, expected := range []string{
+		"usage: break <address> [if <condition>]\n",
+		"unknown address or label: nowhere\n",
+		"unexpected end of expression\n",
+		"not a byte: $100\n",
+		"invalid count: 0\n",
+		"Unknown command frobnicate, try help\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output doesn't contain %q:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "Breakpoint") {
+		t.Errorf("a breakpoint was set:\n%s", output)
+	}
+}
+
+func TestMonitorQuit(t *testing.T) {
+	// The rest of the input isn't read after quit
+	output := runMonitor(t, `
+quit
+frobnicate
+`)
+	if strings.Contains(output, "Unknown command") {
+		t.Errorf("the monitor went on after quit:\n%s", output)
+	}
+}
+
+func TestMonitorDumpEnd(t *testing.T) {
+	// Dumps stop at the end of the address space instead of wrapping
+	output := runMonitor(t, `
+dump $FFF8
+dump $FFF0 $FFFF
+dump 1 $FFFF
+`)
+	for _, expected := range []string{
+		"FFF8  ",
+		"FFF0  ",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output doesn't contain %q:\n%s", expected, output)
+		}
+	}
+	if lines := strings.Count(output, "FFF0  "); lines != 1 {
+		t.Errorf("got %d lines at $FFF0, expected 1", lines)
+	}
+	if lines := strings.Count(output, "0001  "); lines != 1 {
+		t.Errorf("got %d lines at $0001, expected 1", lines)
+	}
+	if strings.Contains(output, "0000  ") {
+		t.Errorf("a dump wrapped around:\n%s", output)
+	}
+}
@@ -0,0 +1,279 @@
+package Debugger
+
+import (
+	"emu6502/ComputeUnit/CPU"
+	"errors"
+	"sync/atomic"
+)
+
+// Default size of the recording, see EnableRecording
+const (
+	DefaultRecordSize = 1 << 16
+	checkpointCount   = 8
+)
+
+// errRunning is returned by operations that need a stopped CPU
+var errRunning = errors.New("the CPU is running")
+
+// Write is a memory write recorded for reverse execution
+type Write struct {
+	Address uint16
+	Old     uint8
+	New     uint8
+	// Undoable is false for writes to devices that aren't memory, like
+	// the GPU. They can't be taken back, and Old is unknown.
+	Undoable bool
+}
+
+// record is the undo log of one instruction: the state before it executed
+// and the writes it made
+type record struct {
+	index     uint64
+	registers CPU.Registers
+	callStack []Frame
+	writes    []Write
+}
+
+// checkpoint is a full copy of the registers and the memory
+type checkpoint struct {
+	index     uint64
+	registers CPU.Registers
+	callStack []Frame
+	memory    [0x10000]uint8
+	// stored marks the addresses backed by memory
+	stored [0x10000]bool
+}
+
+// recording keeps the undo log of the last instructions in a ring, and
+// a full checkpoint every interval instructions. Once the log is used up,
+// the CPU can still go back to the checkpoints before it.
+type recording struct {
+	records []record
+	// first is the position of the oldest record in the ring
+	first, count int
+	// index counts the recorded instructions
+	index    uint64
+	interval uint64
+	// checkpoints are sorted from the oldest to the newest
+	checkpoints []*checkpoint
+	// current is the record of the executing instruction, nil if none
+	current *record
+}
+
+// EnableRecording records the undo log of the last size instructions so
+// the CPU can run backwards, starting with the next instruction. 0 stops
+// the recording. The CPU has to be stopped or not started yet.
+// Only the CPU controlled by the debugger is recorded. Other CPUs, I/O
+// devices and the cycle count aren't rewound.
+func (d *Debugger) EnableRecording(size int) {
+	if size <= 0 {
+		d.recording = nil
+		return
+	}
+	interval := uint64(size / 4)
+	if interval == 0 {
+		interval = 1
+	}
+	d.recording = &recording{records: make([]record, size), interval: interval}
+}
+
+// Recording reports whether the CPU is recorded
+func (d *Debugger) Recording() bool {
+	return d.recording != nil
+}
+
+// Stopped reports whether the CPU waits in the debugger
+func (d *Debugger) Stopped() bool {
+	return atomic.LoadUint32(&d.waiting) != 0
+}
+
+// checkpoint copies the current state
+func (d *Debugger) checkpoint(index uint64) *checkpoint {
+	c := &checkpoint{index: index, registers: d.cpu.Registers(), callStack: d.CallStack()}
+	for address := range c.memory {
+		c.memory[address], c.stored[address] = d.cpu.StoredByteAt(uint16(address))
+	}
+	return c
+}
+
+// beginRecord starts the record of the instruction that is about to execute
+func (d *Debugger) beginRecord() {
+	r := d.recording
+	if len(r.checkpoints) == 0 || r.index%r.interval == 0 && r.index != r.checkpoints[len(r.checkpoints)-1].index {
+		r.checkpoints = append(r.checkpoints, d.checkpoint(r.index))
+		if len(r.checkpoints) > checkpointCount {
+			r.checkpoints = r.checkpoints[1:]
+		}
+	}
+
+	position := (r.first + r.count) % len(r.records)
+	if r.count == len(r.records) {
+		r.first = (r.first + 1) % len(r.records)
+	} else {
+		r.count++
+	}
+	current := &r.records[position]
+	current.index = r.index
+	current.registers = d.cpu.Registers()
+	current.callStack = append(current.callStack[:0], d.callStack...)
+	current.writes = current.writes[:0]
+	r.current = current
+	r.index++
+}
+
+// recordWrite adds a write to the record of the executing instruction
+func (d *Debugger) recordWrite(address uint16, data uint8) {
+	if d.recording == nil || d.recording.current == nil || atomic.LoadUint32(&d.detached) != 0 {
+		return
+	}
+	old, stored := d.cpu.StoredByteAt(address)
+	d.recording.current.writes = append(d.recording.current.writes, Write{Address: address, Old: old, New: data, Undoable: stored})
+}
+
+// undo takes back the newest record and returns it
+func (d *Debugger) undo() *record {
+	r := d.recording
+	r.count--
+	undone := &r.records[(r.first+r.count)%len(r.records)]
+	for i := len(undone.writes) - 1; i >= 0; i-- {
+		write := undone.writes[i]
+		if current, _ := d.cpu.StoredByteAt(write.Address); write.Undoable && current != write.Old {
+			d.Poke(write.Address, write.Old)
+		}
+	}
+	d.restore(undone.registers, undone.callStack)
+	if d.historyCount > 0 {
+		d.historyCount--
+	}
+	r.index = undone.index
+	r.current = nil
+	// Checkpoints after this point in time are in the future now
+	for len(r.checkpoints) > 0 && r.checkpoints[len(r.checkpoints)-1].index > r.index {
+		r.checkpoints = r.checkpoints[:len(r.checkpoints)-1]
+	}
+	return undone
+}
+
+// restore sets the registers and the call stack
+func (d *Debugger) restore(registers CPU.Registers, callStack []Frame) {
+	d.cpu.SetRegisters(registers)
+	d.callStack = append(d.callStack[:0], callStack...)
+}
+
+// restoreCheckpoint goes back to the newest checkpoint before the oldest
+// record. The log is empty afterwards. It returns false if there is none.
+func (d *Debugger) restoreCheckpoint() bool {
+	r := d.recording
+	var target *checkpoint
+	for i := len(r.checkpoints) - 1; i >= 0; i-- {
+		if r.checkpoints[i].index < r.index {
+			target = r.checkpoints[i]
+			r.checkpoints = r.checkpoints[:i+1]
+			break
+		}
+	}
+	if target == nil {
+		return false
+	}
+	for address := range target.memory {
+		if current, stored := d.cpu.StoredByteAt(uint16(address)); stored && target.stored[address] && current != target.memory[address] {
+			d.Poke(uint16(address), target.memory[address])
+		}
+	}
+	d.restore(target.registers, target.callStack)
+	r.index = target.index
+	r.count = 0
+	r.current = nil
+	return true
+}
+
+// StepBack takes back the last instruction. At the start of the log the CPU
+// goes back to the previous checkpoint. The CPU has to be stopped.
+func (d *Debugger) StepBack() (Stop, error) {
+	if err := d.checkReverse(); err != nil {
+		return Stop{}, err
+	}
+	if d.recording.count == 0 {
+		if !d.restoreCheckpoint() {
+			return Stop{}, errors.New("no recorded history")
+		}
+		return Stop{Reason: StopHistoryStart, PC: d.cpu.PC(), Reverse: true}, nil
+	}
+	d.undo()
+	return Stop{Reason: StopStep, PC: d.cpu.PC(), Reverse: true}, nil
+}
+
+// ReverseContinue runs backwards until the PC is at a breakpoint, or until
+// an instruction that triggers a write watchpoint is taken back. The CPU
+// stops before that instruction. Hit and ignore counts are left alone.
+// At the start of the log it stops with StopHistoryStart.
+func (d *Debugger) ReverseContinue() (Stop, error) {
+	if err := d.checkReverse(); err != nil {
+		return Stop{}, err
+	}
+	if d.recording.count == 0 {
+		return d.StepBack()
+	}
+
+	for d.recording.count > 0 {
+		if stop := d.reverseStop(d.undo()); stop != nil {
+			return *stop, nil
+		}
+	}
+	return Stop{Reason: StopHistoryStart, PC: d.cpu.PC(), Reverse: true}, nil
+}
+
+// reverseStop checks if ReverseContinue stops after the record was undone
+func (d *Debugger) reverseStop(undone *record) *Stop {
+	registers := d.cpu.Registers()
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, write := range undone.writes {
+		access := Access{Address: write.Address, Write: true, Value: write.New, Old: write.Old}
+		if !write.Undoable {
+			// The old value of an I/O device is unknown, any write counts
+			access.Old = write.New
+		}
+		for _, watchpoint := range d.watchpoints {
+			if watchpoint.contains(write.Address) && watchpoint.Kind != WatchRead && (!write.Undoable || watchpoint.matches(access)) {
+				return &Stop{Reason: StopWatchpoint, PC: registers.PC, Watchpoint: watchpoint, Access: access, Reverse: true}
+			}
+		}
+	}
+	for _, breakpoint := range d.breakpoints {
+		if breakpoint.Address == registers.PC && (breakpoint.Condition == nil || breakpoint.Condition.True(registers, d.StoredByteAt)) {
+			return &Stop{Reason: StopBreakpoint, PC: registers.PC, Breakpoint: breakpoint, Reverse: true}
+		}
+	}
+	return nil
+}
+
+// LastWrite finds the newest recorded write to the address. back is the
+// number of instructions StepBack has to take back to stop before the
+// instruction that wrote, pc is the address of that instruction.
+func (d *Debugger) LastWrite(address uint16) (write Write, back int, pc uint16, err error) {
+	if err := d.checkReverse(); err != nil {
+		return Write{}, 0, 0, err
+	}
+	r := d.recording
+	for back = 1; back <= r.count; back++ {
+		record := &r.records[(r.first+r.count-back)%len(r.records)]
+		for i := len(record.writes) - 1; i >= 0; i-- {
+			if record.writes[i].Address == address {
+				return record.writes[i], back, record.registers.PC, nil
+			}
+		}
+	}
+	return Write{}, 0, 0, errors.New("no recorded write")
+}
+
+// checkReverse checks that the CPU can run backwards
+func (d *Debugger) checkReverse() error {
+	if !d.Stopped() {
+		return errRunning
+	}
+	if d.recording == nil {
+		return errors.New("recording is off")
+	}
+	return nil
+}
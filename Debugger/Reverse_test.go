@@ -0,0 +1,96 @@
+package Debugger
+
+import (
+	"emu6502/ComputeUnit/CPU"
+	"reflect"
+	"testing"
+)
+
+// state is what running backwards has to restore
+type state struct {
+	registers CPU.Registers
+	stack     [0x100]uint8
+	callStack []Frame
+}
+
+func capture(d *Debugger) state {
+	s := state{registers: d.CPU().Registers(), callStack: d.CallStack()}
+	for i := range s.stack {
+		s.stack[i] = d.Peek(0x0100 + uint16(i))
+	}
+	return s
+}
+
+func TestReverse(t *testing.T) {
+	d, _, wait := startHello(t)
+	d.EnableRecording(1000)
+
+	// printDigit is called twice for each number
+	d.AddBreakpoint(0x403B, false)
+	d.Continue()
+	wait()
+	first := capture(d)
+	d.Continue()
+	wait()
+
+	stop, err := d.ReverseContinue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stop.Reason != StopBreakpoint || !stop.Reverse || !reflect.DeepEqual(capture(d), first) {
+		t.Errorf("reverse continue: got %+v with %+v, expected %+v", stop, capture(d), first)
+	}
+
+	// Stepping forward and back again ends in the same state
+	for i := 0; i < 5; i++ {
+		d.Step()
+		wait()
+	}
+	for i := 0; i < 5; i++ {
+		if stop, err = d.StepBack(); err != nil || stop.Reason != StopStep {
+			t.Fatalf("step back: got %+v, %v", stop, err)
+		}
+	}
+	if !reflect.DeepEqual(capture(d), first) {
+		t.Errorf("step back: got %+v, expected %+v", capture(d), first)
+	}
+
+	// The return address of printDigit was pushed by the JSR in printDec8
+	write, back, pc, err := d.LastWrite(0x01FC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back != 1 || d.Peek(pc) != opcodeJSR || write.New != first.stack[0xFC] || !write.Undoable {
+		t.Errorf("last write: got %+v back %d at $%04X", write, back, pc)
+	}
+
+	// Running backwards to the start ends at the entry
+	d.ClearBreakpoints()
+	if stop, err = d.ReverseContinue(); err != nil || stop.Reason != StopHistoryStart || stop.PC != 0x4047 {
+		t.Errorf("reverse continue to the start: got %+v, %v", stop, err)
+	}
+	if _, err = d.StepBack(); err == nil {
+		t.Error("step back before the start: no error")
+	}
+
+	// A short recording goes back to its checkpoints
+	d.AddBreakpoint(0x403B, false)
+	d.EnableRecording(8)
+	d.Continue()
+	wait()
+	for stop.Reason = StopStep; stop.Reason == StopStep; {
+		if stop, err = d.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stop.Reason != StopHistoryStart {
+		t.Errorf("short recording: got %+v", stop)
+	}
+	d.Continue()
+	wait()
+	if !reflect.DeepEqual(capture(d), first) {
+		t.Errorf("replay: got %+v, expected %+v", capture(d), first)
+	}
+	d.ClearBreakpoints()
+	d.Continue()
+}
@@ -0,0 +1,133 @@
+package Debugger
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbols maps the labels of a program to their addresses and back
+type Symbols struct {
+	labels    map[uint16]string
+	addresses map[string]uint16
+	// sorted contains the addresses of all labels in ascending order
+	sorted []uint16
+}
+
+// NewSymbols creates the symbol table from the addresses of the labels,
+// as returned by Logger.LoadSymbols. Every label can be looked up by name;
+// if several share an address, preferLabel picks the one that is shown.
+func NewSymbols(addresses map[string]uint16) *Symbols {
+	s := &Symbols{
+		labels:    make(map[uint16]string, len(addresses)),
+		addresses: addresses,
+	}
+	for label, address := range addresses {
+		existing, ok := s.labels[address]
+		if !ok {
+			s.sorted = append(s.sorted, address)
+		}
+		if !ok || preferLabel(label, existing) {
+			s.labels[address] = label
+		}
+	}
+	sort.Slice(s.sorted, func(i, j int) bool { return s.sorted[i] < s.sorted[j] })
+	return s
+}
+
+// preferLabel decides which of two labels at the same address is shown.
+// Global labels are preferred over local ones starting with an underscore.
+func preferLabel(label string, existing string) bool {
+	labelLocal, existingLocal := strings.HasPrefix(label, "_"), strings.HasPrefix(existing, "_")
+	if labelLocal != existingLocal {
+		return existingLocal
+	}
+	return label < existing
+}
+
+// Labels returns the label shown for each address
+func (s *Symbols) Labels() map[uint16]string {
+	if s == nil {
+		return nil
+	}
+	return s.labels
+}
+
+// Address returns the address of the label
+func (s *Symbols) Address(label string) (uint16, bool) {
+	if s == nil {
+		return 0, false
+	}
+	address, ok := s.addresses[label]
+	return address, ok
+}
+
+// Describe formats the address with the closest label before it, like "$4025 <start+5>"
+func (s *Symbols) Describe(address uint16) string {
+	text := fmt.Sprintf("$%04X", address)
+	if label := s.Label(address); label != "" {
+		return fmt.Sprintf("%s <%s>", text, label)
+	}
+	return text
+}
+
+// Label returns the closest label before the address with the offset to
+// it, like "start+5". It is empty if there is no label before the address.
+func (s *Symbols) Label(address uint16) string {
+	if s == nil {
+		return ""
+	}
+	index := sort.Search(len(s.sorted), func(i int) bool { return s.sorted[i] > address }) - 1
+	if index < 0 {
+		return ""
+	}
+	base := s.sorted[index]
+	if address == base {
+		return s.labels[base]
+	}
+	return fmt.Sprintf("%s+%d", s.labels[base], address-base)
+}
+
+// ParseAddress parses "$4020", "0x4020", a decimal number or a label,
+// optionally followed by "+offset"
+func (s *Symbols) ParseAddress(text string) (uint16, error) {
+	base, offset := text, ""
+	if index := strings.LastIndex(text, "+"); index > 0 {
+		base, offset = text[:index], text[index+1:]
+	}
+
+	address, err := ParseNumber(base)
+	if err != nil {
+		var ok bool
+		if address, ok = s.Address(base); !ok {
+			return 0, fmt.Errorf("unknown address or label: %s", base)
+		}
+	}
+	if offset != "" {
+		value, err := ParseNumber(offset)
+		if err != nil {
+			return 0, err
+		}
+		address += value
+	}
+	return address, nil
+}
+
+// ParseNumber parses "$FF", "0xFF", "%1010" or a decimal number
+func ParseNumber(text string) (uint16, error) {
+	base := 10
+	switch {
+	case strings.HasPrefix(text, "$"):
+		text, base = text[1:], 16
+	case strings.HasPrefix(text, "0x"), strings.HasPrefix(text, "0X"):
+		text, base = text[2:], 16
+	case strings.HasPrefix(text, "%"):
+		text, base = text[1:], 2
+	}
+	value, err := strconv.ParseUint(text, base, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %s", text)
+	}
+	return uint16(value), nil
+}
@@ -0,0 +1,49 @@
+package Debugger
+
+import (
+	"emu6502/Logger"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymbols(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "program.m")
+	mapping := "$4020 | start      | program.oph:3\n" +
+		"$4030 | _halt      | program.oph:9\n" +
+		"$4030 | end        | program.oph:9\n" +
+		"$4040 | _halt      | program.oph:12\n"
+	if err := os.WriteFile(path, []byte(mapping), 0644); err != nil {
+		t.Fatal(err)
+	}
+	symbols := NewSymbols(Logger.LoadSymbols(path))
+
+	// Every label can be looked up, the first of a repeated name wins
+	for label, expected := range map[string]uint16{"start": 0x4020, "end": 0x4030, "_halt": 0x4030} {
+		if address, ok := symbols.Address(label); !ok || address != expected {
+			t.Errorf("%s: got $%04X %v, expected $%04X", label, address, ok, expected)
+		}
+	}
+	// Global labels are shown in place of local ones
+	if label := symbols.Label(0x4030); label != "end" {
+		t.Errorf("label at $4030: got %q, expected end", label)
+	}
+	if label := symbols.Label(0x4025); label != "start+5" {
+		t.Errorf("label at $4025: got %q, expected start+5", label)
+	}
+	if label := symbols.Label(0x4000); label != "" {
+		t.Errorf("label at $4000: got %q, expected none", label)
+	}
+
+	tests := map[string]uint16{"$4020": 0x4020, "0x10": 0x10, "%101": 5, "42": 42, "end": 0x4030, "start+$10": 0x4030}
+	for text, expected := range tests {
+		if address, err := symbols.ParseAddress(text); err != nil || address != expected {
+			t.Errorf("%s: got $%04X %v, expected $%04X", text, address, err, expected)
+		}
+	}
+	for _, text := range []string{"missing", "$10000", "start+x"} {
+		if _, err := symbols.ParseAddress(text); err == nil {
+			t.Errorf("%s: expected an error", text)
+		}
+	}
+}
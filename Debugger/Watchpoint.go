@@ -0,0 +1,195 @@
+package Debugger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// WatchKind selects the accesses a watchpoint stops at
+type WatchKind int
+
+const (
+	// WatchChange stops at writes that change the value
+	WatchChange WatchKind = iota
+	// WatchWrite stops at every write
+	WatchWrite
+	// WatchRead stops at every read
+	WatchRead
+	// WatchAccess stops at every read or write
+	WatchAccess
+)
+
+func (k WatchKind) String() string {
+	switch k {
+	case WatchChange:
+		return "change"
+	case WatchWrite:
+		return "write"
+	case WatchRead:
+		return "read"
+	case WatchAccess:
+		return "access"
+	default:
+		return "unknown"
+	}
+}
+
+// Watchpoint stops the CPU after an instruction accessed memory between
+// Start and End, both inclusive. Accesses are seen as the MMU translates
+// them, so they are checked against virtual addresses.
+type Watchpoint struct {
+	Id         int
+	Start, End uint16
+	Kind       WatchKind
+	// Condition has to be true for the watchpoint to trigger. It is
+	// evaluated during the access, before a written value is stored.
+	Condition *Expression
+	Hits      int
+	Ignore    int
+
+	// values are the last known values of the range, to recognise changes
+	values []uint8
+}
+
+// Access is a memory access that triggered a watchpoint
+type Access struct {
+	Address uint16
+	Write   bool
+	// Value is the value read or written, Old the value before a write
+	Value uint8
+	Old   uint8
+}
+
+// String describes the range of the watchpoint
+func (w *Watchpoint) String() string {
+	if w.Start == w.End {
+		return fmt.Sprintf("$%04X", w.Start)
+	}
+	return fmt.Sprintf("$%04X-$%04X", w.Start, w.End)
+}
+
+func (w *Watchpoint) contains(address uint16) bool {
+	return address >= w.Start && address <= w.End
+}
+
+// matches checks if the watchpoint triggers at the access
+func (w *Watchpoint) matches(access Access) bool {
+	switch w.Kind {
+	case WatchChange:
+		return access.Write && access.Value != access.Old
+	case WatchWrite:
+		return access.Write
+	case WatchRead:
+		return !access.Write
+	default:
+		return true
+	}
+}
+
+// ParseRange parses an address range like "$10", "$10-$1F" or "label:2",
+// where the number after the colon is the length
+func (s *Symbols) ParseRange(text string) (uint16, uint16, error) {
+	if index := strings.Index(text, ":"); index > 0 {
+		start, err := s.ParseAddress(text[:index])
+		if err != nil {
+			return 0, 0, err
+		}
+		length, err := ParseNumber(text[index+1:])
+		if err != nil || length == 0 || uint32(start)+uint32(length) > 0x10000 {
+			return 0, 0, fmt.Errorf("invalid length: %s", text[index+1:])
+		}
+		return start, start + length - 1, nil
+	}
+	if index := strings.Index(text, "-"); index > 0 {
+		start, err := s.ParseAddress(text[:index])
+		if err != nil {
+			return 0, 0, err
+		}
+		end, err := s.ParseAddress(text[index+1:])
+		if err != nil {
+			return 0, 0, err
+		}
+		if end < start {
+			return 0, 0, fmt.Errorf("invalid range: %s", text)
+		}
+		return start, end, nil
+	}
+	address, err := s.ParseAddress(text)
+	return address, address, err
+}
+
+// AddWatchpoint watches the addresses from start to end, both inclusive.
+// The condition may be empty.
+func (d *Debugger) AddWatchpoint(start uint16, end uint16, kind WatchKind, condition string) (*Watchpoint, error) {
+	if end < start {
+		return nil, fmt.Errorf("invalid range $%04X-$%04X", start, end)
+	}
+	watchpoint := &Watchpoint{Start: start, End: end, Kind: kind, values: make([]uint8, int(end-start)+1)}
+	if strings.TrimSpace(condition) != "" {
+		var err error
+		if watchpoint.Condition, err = ParseExpression(condition, d.Symbols); err != nil {
+			return nil, err
+		}
+	}
+	for i := range watchpoint.values {
+		watchpoint.values[i] = d.Peek(start + uint16(i))
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	watchpoint.Id = d.nextId
+	d.nextId++
+	d.watchpoints = append(d.watchpoints, watchpoint)
+	atomic.StoreInt32(&d.watching, int32(len(d.watchpoints)))
+	return watchpoint, nil
+}
+
+// Watchpoints returns all watchpoints sorted by their id
+func (d *Debugger) Watchpoints() []*Watchpoint {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	watchpoints := append([]*Watchpoint(nil), d.watchpoints...)
+	sort.Slice(watchpoints, func(i, j int) bool { return watchpoints[i].Id < watchpoints[j].Id })
+	return watchpoints
+}
+
+// watchpoint returns the watchpoint with the id, the mutex has to be held
+func (d *Debugger) watchpoint(id int) *Watchpoint {
+	for _, watchpoint := range d.watchpoints {
+		if watchpoint.Id == id {
+			return watchpoint
+		}
+	}
+	return nil
+}
+
+// access is the access hook of the MMU. It records writes for reverse
+// execution, and a triggered watchpoint stops the CPU before the next
+// instruction.
+func (d *Debugger) access(address uint16, data uint8, write bool) {
+	if write {
+		d.recordWrite(address, data)
+	}
+	if atomic.LoadInt32(&d.watching) == 0 || atomic.LoadUint32(&d.detached) != 0 {
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, watchpoint := range d.watchpoints {
+		if !watchpoint.contains(address) {
+			continue
+		}
+		access := Access{Address: address, Write: write, Value: data}
+		if write {
+			access.Old = watchpoint.values[address-watchpoint.Start]
+			watchpoint.values[address-watchpoint.Start] = data
+		}
+		if d.pendingStop != nil || !watchpoint.matches(access) || !d.hit(watchpoint.Condition, &watchpoint.Hits, &watchpoint.Ignore) {
+			continue
+		}
+		d.pendingStop = &Stop{Reason: StopWatchpoint, Watchpoint: watchpoint, Access: access}
+	}
+}
@@ -0,0 +1,118 @@
+package Debugger
+
+import (
+	"bytes"
+	"emu6502/ComputeUnit"
+	"emu6502/Logger"
+	"emu6502/Machine"
+	"emu6502/Scheduler"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer collects the output of the GPU, which is written on the
+// goroutine of the CPU
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(data []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(data)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// startHello runs hello.rom on a CPU with a debugger that stopped at the
+// entry. wait returns the next stop.
+func startHello(t *testing.T) (d *Debugger, output *syncBuffer, wait func() Stop) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+
+	output = &syncBuffer{}
+	bus, mappings, err := Machine.Boot("../hello.rom", output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cu := ComputeUnit.NewComputeUnit(bus, mappings, 0)
+	d = Attach(cu.CPU(), true)
+	cu.Reset()
+	scheduler, err := Scheduler.NewScheduler([]*ComputeUnit.ComputeUnit{cu}, Scheduler.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler.Run()
+	t.Cleanup(func() {
+		d.Detach()
+		scheduler.Halt()
+	})
+
+	wait = func() Stop {
+		t.Helper()
+		select {
+		case stop := <-d.Stops():
+			return stop
+		case <-time.After(5 * time.Second):
+			t.Fatal("the CPU didn't stop")
+		}
+		return Stop{}
+	}
+	wait()
+	return d, output, wait
+}
+
+func TestWatchpoints(t *testing.T) {
+	d, output, wait := startHello(t)
+
+	// The first character of the string is read by LDA $406D,X
+	read, err := d.AddWatchpoint(0x406D, 0x4079, WatchRead, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Continue()
+	if stop := wait(); stop.Watchpoint != read || stop.Access != (Access{Address: 0x406D, Value: 'H'}) || stop.PC != 0x404C {
+		t.Errorf("read watchpoint: got %+v", stop)
+	}
+	d.DeleteBreakpoint(read.Id)
+
+	// The second 'o' is printed after the first one is ignored
+	write, err := d.AddWatchpoint(0x4000, 0x4000, WatchWrite, "A == $6F")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetIgnoreCount(write.Id, 1); err != nil {
+		t.Fatal(err)
+	}
+	d.Continue()
+	if stop := wait(); stop.Watchpoint != write || stop.Access.Value != 'o' || !stop.Access.Write {
+		t.Errorf("write watchpoint: got %+v", stop)
+	}
+	if output.String() != "Hello Wo" || write.Hits != 2 {
+		t.Errorf("write watchpoint: printed %q after %d hits, expected \"Hello Wo\" after 2", output.String(), write.Hits)
+	}
+	d.DeleteBreakpoint(write.Id)
+
+	// JSR pushes the return address, changing the top of the stack
+	change, err := d.AddWatchpoint(0x01FF, 0x01FF, WatchChange, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Continue()
+	if stop := wait(); stop.Watchpoint != change || stop.Access != (Access{Address: 0x01FF, Write: true, Value: 0x40, Old: 0}) {
+		t.Errorf("change watchpoint: got %+v", stop)
+	}
+	// Poking doesn't trigger the watchpoint, but updates its value
+	d.Poke(0x01FF, 0x40)
+	if change.values[0] != 0x40 || change.Hits != 1 {
+		t.Errorf("poke: value %02X after %d hits", change.values[0], change.Hits)
+	}
+	d.ClearBreakpoints()
+	d.Continue()
+}
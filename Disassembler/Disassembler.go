@@ -0,0 +1,108 @@
+package Disassembler
+
+import (
+	"emu6502/ComputeUnit/CPU"
+	"emu6502/ComputeUnit/CPU/AddressMode"
+	"fmt"
+	"strings"
+)
+
+// ReadFunc reads the byte at the given address
+type ReadFunc func(address uint16) uint8
+
+// Line is one disassembled instruction
+type Line struct {
+	Address uint16
+	// Bytes are the bytes of the instruction, including the opcode
+	Bytes []uint8
+	// Instruction is nil if the opcode is illegal
+	Instruction *CPU.Instruction
+	// Operand is the value of the operand. For relative addressing it is
+	// the branch target.
+	Operand uint16
+}
+
+// Decode disassembles the instruction at the given address
+func Decode(read ReadFunc, address uint16) Line {
+	opcode := read(address)
+	line := Line{Address: address, Bytes: []uint8{opcode}}
+
+	instruction := &CPU.Instructions[opcode]
+	if !instruction.Valid() {
+		return line
+	}
+	line.Instruction = instruction
+
+	for i := uint16(1); i < uint16(instruction.Bytes); i++ {
+		line.Bytes = append(line.Bytes, read(address+i))
+	}
+	switch instruction.Bytes {
+	case 2:
+		line.Operand = uint16(line.Bytes[1])
+	case 3:
+		line.Operand = CPU.CombineLowHigh(line.Bytes[1], line.Bytes[2])
+	}
+	if instruction.Mode == AddressMode.Relative {
+		line.Operand = uint16(int32(address) + 2 + int32(CPU.Uint8ToInt8(line.Bytes[1])))
+	}
+	return line
+}
+
+// Length returns the number of bytes of the instruction
+func (l Line) Length() uint16 {
+	return uint16(len(l.Bytes))
+}
+
+// Next returns the address of the instruction following this one
+func (l Line) Next() uint16 {
+	return l.Address + l.Length()
+}
+
+// Assembly returns the instruction in assembler syntax. If symbols is
+// not nil, addresses that have a label are replaced by it.
+func (l Line) Assembly(symbols map[uint16]string) string {
+	if l.Instruction == nil {
+		return fmt.Sprintf(".byte $%02X", l.Bytes[0])
+	}
+
+	mode := l.Instruction.Mode
+	operand := mode.Format(l.Operand)
+	if label, ok := symbols[l.Operand]; ok && mode != AddressMode.Immediate && mode != AddressMode.Implied && mode != AddressMode.Accumulator {
+		hex := fmt.Sprintf("$%04X", l.Operand)
+		if l.Instruction.Bytes == 2 && mode != AddressMode.Relative {
+			hex = fmt.Sprintf("$%02X", l.Operand)
+		}
+		operand = strings.Replace(operand, hex, label, 1)
+	}
+
+	if operand == "" {
+		return l.Instruction.Mnemonic
+	}
+	return l.Instruction.Mnemonic + " " + operand
+}
+
+// String formats the line like "4020  A2 00     LDX #$00"
+func (l Line) String() string {
+	return l.Format(nil)
+}
+
+// Format formats the line with the address and bytes, using symbols for
+// the operand if available
+func (l Line) Format(symbols map[uint16]string) string {
+	hexBytes := make([]string, len(l.Bytes))
+	for i, b := range l.Bytes {
+		hexBytes[i] = fmt.Sprintf("%02X", b)
+	}
+	return fmt.Sprintf("%04X  %-9s %s", l.Address, strings.Join(hexBytes, " "), l.Assembly(symbols))
+}
+
+// Range disassembles count instructions starting at the given address
+func Range(read ReadFunc, address uint16, count int) []Line {
+	lines := make([]Line, 0, count)
+	for i := 0; i < count; i++ {
+		line := Decode(read, address)
+		lines = append(lines, line)
+		address = line.Next()
+	}
+	return lines
+}
@@ -0,0 +1,218 @@
+package Disassembler
+
+import (
+	"emu6502/ComputeUnit/CPU"
+	"emu6502/ComputeUnit/CPU/AddressMode"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultOrigin is the address the test programs are assembled for
+const DefaultOrigin = 0x4020
+
+// Image is a ROM image as it appears in the address space
+type Image struct {
+	Origin uint16
+	Data   []uint8
+}
+
+// LoadImage reads a ROM file that is mapped at the origin
+func LoadImage(path string, origin uint16) (*Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || int(origin)+len(data) > 0x10000 {
+		return nil, fmt.Errorf("%s: %d bytes don't fit at $%04X", path, len(data), origin)
+	}
+	return &Image{Origin: origin, Data: data}, nil
+}
+
+// End returns the last address of the image
+func (i *Image) End() uint16 {
+	return i.Origin + uint16(len(i.Data)-1)
+}
+
+// Contains reports whether the address is part of the image
+func (i *Image) Contains(address uint16) bool {
+	return address >= i.Origin && int(address-i.Origin) < len(i.Data)
+}
+
+// Read returns the byte at the address, 0 outside of the image
+func (i *Image) Read(address uint16) uint8 {
+	if !i.Contains(address) {
+		return 0
+	}
+	return i.Data[address-i.Origin]
+}
+
+// Vectors returns the NMI, reset and IRQ vectors if they are part of the
+// image, keyed by the name used for their labels
+func (i *Image) Vectors() map[string]uint16 {
+	vectors := make(map[string]uint16)
+	for name, vector := range map[string]uint16{"nmi": CPU.NMIVector, "reset": CPU.ResetVector, "irq": CPU.IRQVector} {
+		if i.Contains(vector) && i.Contains(vector+1) {
+			vectors[name] = CPU.CombineLowHigh(i.Read(vector), i.Read(vector+1))
+		}
+	}
+	return vectors
+}
+
+// Code is the result of a recursive descent disassembly
+type Code struct {
+	// Lines are the instructions that were reached, keyed by address
+	Lines map[uint16]Line
+	// Targets are the addresses that are called, jumped or branched to
+	Targets map[uint16]bool
+}
+
+// Trace follows the control flow of the image from the entry points.
+// Calls, jumps and both ways of a branch are followed. RTS, RTI, BRK,
+// indirect jumps and illegal opcodes end a path, since where they
+// continue isn't known without running the program.
+func Trace(image *Image, entries []uint16) *Code {
+	code := &Code{Lines: make(map[uint16]Line), Targets: make(map[uint16]bool)}
+	pending := append([]uint16(nil), entries...)
+	for _, entry := range entries {
+		code.Targets[entry] = true
+	}
+
+	for len(pending) > 0 {
+		address := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for image.Contains(address) {
+			if _, ok := code.Lines[address]; ok {
+				break
+			}
+			line := Decode(image.Read, address)
+			if line.Instruction == nil || !image.Contains(line.Next()-1) {
+				break
+			}
+			code.Lines[address] = line
+
+			mode := line.Instruction.Mode
+			mnemonic := line.Instruction.Mnemonic
+			if mode == AddressMode.Relative || mnemonic == "JSR" || mnemonic == "JMP" && mode == AddressMode.Absolut {
+				code.Targets[line.Operand] = true
+				pending = append(pending, line.Operand)
+			}
+			if mnemonic == "JMP" || mnemonic == "RTS" || mnemonic == "RTI" || mnemonic == "BRK" {
+				break
+			}
+			address = line.Next()
+		}
+	}
+	return code
+}
+
+// Print writes the disassembly of the image from start to end, both
+// inclusive. Without code every byte is disassembled as an instruction,
+// otherwise only the instructions found by Trace are, and the other bytes
+// are printed as data. Labels are printed on their own line and replace
+// the operands.
+func Print(w io.Writer, image *Image, start uint16, end uint16, code *Code, labels map[uint16]string) error {
+	for address := uint32(start); address <= uint32(end); {
+		if label, ok := labels[uint16(address)]; ok {
+			if _, err := fmt.Fprintf(w, "%s:\n", label); err != nil {
+				return err
+			}
+		}
+
+		var line Line
+		if code == nil {
+			line = Decode(image.Read, uint16(address))
+		} else if found, ok := code.Lines[uint16(address)]; ok {
+			line = found
+		} else {
+			next := dataEnd(image, uint16(address), end, code, labels)
+			if err := printData(w, image, uint16(address), next); err != nil {
+				return err
+			}
+			address = uint32(next) + 1
+			continue
+		}
+		if _, err := fmt.Fprintln(w, line.Format(labels)); err != nil {
+			return err
+		}
+		address += uint32(line.Length())
+	}
+	return nil
+}
+
+// dataEnd returns the last address of the data at start. Data ends before
+// an instruction or a label.
+func dataEnd(image *Image, start uint16, end uint16, code *Code, labels map[uint16]string) uint16 {
+	address := start
+	for address < end {
+		next := address + 1
+		if _, ok := code.Lines[next]; ok {
+			break
+		}
+		if _, ok := labels[next]; ok {
+			break
+		}
+		address = next
+	}
+	return address
+}
+
+// repeatedLength is the length from which runs of the same byte are
+// summarised in one line
+const repeatedLength = 16
+
+// printData writes the bytes from start to end as data, 8 per line
+func printData(w io.Writer, image *Image, start uint16, end uint16) error {
+	for address := uint32(start); address <= uint32(end); {
+		run := uint32(1)
+		for address+run <= uint32(end) && image.Read(uint16(address+run)) == image.Read(uint16(address)) {
+			run++
+		}
+		if run >= repeatedLength {
+			if _, err := fmt.Fprintf(w, "%04X  %-9s .advance $%04X, $%02X\n", address, "", address+run, image.Read(uint16(address))); err != nil {
+				return err
+			}
+			address += run
+			continue
+		}
+
+		var values []string
+		first := address
+		for ; address <= uint32(end) && len(values) < 8; address++ {
+			values = append(values, fmt.Sprintf("$%02X", image.Read(uint16(address))))
+		}
+		if _, err := fmt.Fprintf(w, "%04X  %-9s .byte %s\n", first, "", strings.Join(values, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TraceLabels returns labels for the entry points and targets of the code
+// that have none, like "L4049". Vectors are labelled by their name.
+func TraceLabels(image *Image, code *Code, labels map[uint16]string) map[uint16]string {
+	merged := make(map[uint16]string, len(labels))
+	for address, label := range labels {
+		merged[address] = label
+	}
+	vectors := image.Vectors()
+	names := make([]string, 0, len(vectors))
+	for name := range vectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := merged[vectors[name]]; !ok {
+			merged[vectors[name]] = name
+		}
+	}
+	for target := range code.Targets {
+		if _, ok := merged[target]; !ok && image.Contains(target) {
+			merged[target] = fmt.Sprintf("L%04X", target)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,49 @@
+package Disassembler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	image, err := LoadImage("../hello.rom", DefaultOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vectors := image.Vectors()
+	if vectors["reset"] != 0x4047 || vectors["nmi"] != 0x4069 || vectors["irq"] != 0x4069 {
+		t.Fatalf("vectors: got %v", vectors)
+	}
+
+	code := Trace(image, []uint16{vectors["reset"], vectors["nmi"]})
+	// The string after the JMP isn't code
+	if _, ok := code.Lines[0x406A]; !ok {
+		t.Error("JMP at $406A not found")
+	}
+	if _, ok := code.Lines[0x406D]; ok {
+		t.Error("data at $406D disassembled")
+	}
+	// printDec8 is only reached through the JSR at $4066
+	for _, target := range []uint16{0x4020, 0x403B, 0x4049, 0x4054} {
+		if !code.Targets[target] {
+			t.Errorf("target $%04X not found", target)
+		}
+	}
+
+	labels := TraceLabels(image, code, map[uint16]string{0x4020: "printDec8"})
+	var output strings.Builder
+	if err := Print(&output, image, 0x4064, 0x407F, code, labels); err != nil {
+		t.Fatal(err)
+	}
+	expected := "4064  A9 7B     LDA #$7B\n" +
+		"4066  20 20 40  JSR printDec8\n" +
+		"irq:\n" +
+		"4069  EA        NOP\n" +
+		"406A  4C 69 40  JMP irq\n" +
+		"406D            .byte $48, $65, $6C, $6C, $6F, $20, $57, $6F\n" +
+		"4075            .byte $72, $6C, $64, $21, $0A, $00, $00, $00\n" +
+		"407D            .byte $00, $00, $00\n"
+	if output.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", output.String(), expected)
+	}
+}
@@ -2,86 +2,64 @@ package Logger
 
 import (
 	"bufio"
-	"fmt"
 	"os"
+	"strconv"
 	"strings"
 )
 
 var DebugListingFile *string
 var DebugMappingFile *string
 
-var debugListingFileContent *[]string
-var debugMapping *map[string]string
-
-// LogDebugInstruction extracts the debug instruction from the debug listing file
-// and prints it to the console.
-func LogDebugInstruction(pc uint16) {
-	if DebugListingFile == nil {
-		// Without a listing file we can't do anything
-		Warnf("Cannot log debug instruction without a listing file")
-		return
-	}
-
-	if debugListingFileContent == nil {
-		// On first call, load the listing file
-		debugListingFileContent = readFile(DebugListingFile)
-	}
-
-	if debugMapping == nil {
-		if DebugMappingFile == nil {
-			// Without a mapping file we can still continue, just without showing label names
-			Warnf("Cannot log debug instruction without a mapping file")
-			tmpMapping := make(map[string]string)
-			debugMapping = &tmpMapping
-		} else {
-			debugMapping = readMappingFile(DebugMappingFile)
-		}
-	}
-
-	pcPrefix := fmt.Sprintf(" %04X", pc)
-	for _, line := range *debugListingFileContent {
-		if strings.HasPrefix(line, pcPrefix) {
-			// Add the label name to the address if available
-			for key, value := range *debugMapping {
-				line = strings.Replace(line, key, fmt.Sprintf("%s(%s)", key, value), -1)
-			}
-			Debugf("Running: %s", line)
-			return
-		}
-	}
-}
-
-// readFile reads a file and returns its content as a slice of strings.
-func readFile(fileName *string) *[]string {
-	file, _ := os.Open(*fileName)
-	scanner := bufio.NewScanner(file)
-	tempLines := make([]string, 0)
-	for scanner.Scan() {
-		tempLines = append(tempLines, scanner.Text())
-	}
-	return &tempLines
+// mappingLine is a label and its address, as written in the mapping file
+type mappingLine struct {
+	address string
+	label   string
 }
 
-// readMappingFile reads the mapping file and returns a map of the labels and their
-// corresponding addresses.
-func readMappingFile(fileName *string) *map[string]string {
+// readMappingLines reads the labels of the mapping file in the order they appear
+func readMappingLines(fileName *string) ([]mappingLine, error) {
 	// File format:
 	// $<ADDRESS> | <LABEL>      | <FILE>
-	// Returns:
-	// <ADDRESS> -> <LABEL>
 	file, err := os.Open(*fileName)
 	if err != nil {
-		Warnf("Could not open mapping file: %s", err)
-		return nil
+		return nil, err
 	}
+	defer file.Close()
 	scanner := bufio.NewScanner(file)
-	tempMapping := make(map[string]string)
+	lines := make([]mappingLine, 0)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if strings.HasPrefix(line, "$") {
 			parts := strings.Split(line, "|")
-			tempMapping[strings.TrimLeft(strings.TrimSpace(parts[0]), "$")] = strings.TrimSpace(parts[1])
+			if len(parts) < 2 {
+				continue
+			}
+			lines = append(lines, mappingLine{
+				address: strings.TrimLeft(strings.TrimSpace(parts[0]), "$"),
+				label:   strings.TrimSpace(parts[1]),
+			})
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// LoadSymbols reads every label of a mapping file with its address. Labels
+// sharing an address are all kept; if a name appears twice, the first one wins.
+func LoadSymbols(fileName string) map[string]uint16 {
+	symbols := make(map[string]uint16)
+	lines, err := readMappingLines(&fileName)
+	if err != nil {
+		Warnf("Could not open mapping file: %s", err)
+		return symbols
+	}
+	for _, line := range lines {
+		value, err := strconv.ParseUint(line.address, 16, 16)
+		if err != nil {
+			continue
+		}
+		if _, exists := symbols[line.label]; !exists {
+			symbols[line.label] = uint16(value)
 		}
 	}
-	return &tempMapping
+	return symbols
 }
@@ -0,0 +1,316 @@
+package Machine
+
+import (
+	"bytes"
+	_ "embed"
+	"emu6502/BusUnit"
+	"emu6502/ComputeUnit/MMU"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+//go:embed default.json
+var defaultDescription []byte
+
+// Device declares a device that gets attached to the bus
+type Device struct {
+	// Name is used by the mappings to refer to the device, defaults to the type
+	Name string `json:"name"`
+	// Type is one of ram, rom, gpu or mailbox
+	Type string `json:"type"`
+	// Size of the storage in bytes, only used by ram and rom
+	Size *Number `json:"size"`
+	// Image is loaded into the storage at Offset. Relative paths
+	// are relative to the machine description.
+	Image  string `json:"image"`
+	Offset Number `json:"offset"`
+	// Cpus is the number of mailboxes of a mailbox, defaults to 8
+	Cpus *Number `json:"cpus"`
+
+	offset int
+}
+
+// Mapping declares a virtual to physical mapping of the MMU
+type Mapping struct {
+	Virt   Number `json:"virt"`
+	Phys   Number `json:"phys"`
+	Size   Number `json:"size"`
+	Device string `json:"device"`
+	// Permissions is a combination of r, w and x, defaults to rwx
+	Permissions *string `json:"permissions"`
+
+	offset int
+}
+
+// Description describes the devices of a machine and its memory map
+type Description struct {
+	Devices  []*Device
+	Mappings []*Mapping
+
+	path   string
+	source []byte
+}
+
+// Load reads the machine description from a JSON file
+func Load(path string) (*Description, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(path, source)
+}
+
+// Default returns the description of the machine used when no file is given
+func Default() *Description {
+	d, err := parse("default.json", defaultDescription)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func parse(path string, source []byte) (*Description, error) {
+	d := &Description{path: path, source: source}
+
+	// Check the syntax of the whole file first, so the token walk below
+	// only has to deal with the structure
+	var value interface{}
+	if err := json.Unmarshal(source, &value); err != nil {
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) {
+			// The offset is after the character that caused the error
+			return nil, d.errorf(int(syntaxError.Offset)-1, "%s", err)
+		}
+		return nil, d.errorf(0, "%s", err)
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		return nil, d.errorf(d.skip(0), "machine description must be an object")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(source))
+	// Opening brace, checked above
+	_, _ = decoder.Token()
+	for decoder.More() {
+		keyOffset := d.skip(int(decoder.InputOffset()))
+		key, _ := decoder.Token()
+
+		var err error
+		switch key {
+		case "devices":
+			err = d.decodeList(decoder, keyOffset, func(offset int) interface{} {
+				device := &Device{offset: offset}
+				d.Devices = append(d.Devices, device)
+				return device
+			})
+		case "mappings":
+			err = d.decodeList(decoder, keyOffset, func(offset int) interface{} {
+				mapping := &Mapping{offset: offset}
+				d.Mappings = append(d.Mappings, mapping)
+				return mapping
+			})
+		default:
+			err = d.errorf(keyOffset, "unknown key %q", key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// decodeList decodes every element of a JSON array into the value
+// returned by element
+func (d *Description) decodeList(decoder *json.Decoder, keyOffset int, element func(offset int) interface{}) error {
+	listOffset := d.skip(int(decoder.InputOffset()))
+	if token, _ := decoder.Token(); token != json.Delim('[') {
+		return d.errorf(listOffset, "expected a list")
+	}
+
+	for decoder.More() {
+		offset := d.skip(int(decoder.InputOffset()))
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return d.errorf(offset, "%s", err)
+		}
+
+		elementDecoder := json.NewDecoder(bytes.NewReader(raw))
+		elementDecoder.DisallowUnknownFields()
+		if err := elementDecoder.Decode(element(offset)); err != nil {
+			return d.errorf(offset, "%s", err)
+		}
+	}
+
+	// Closing bracket
+	_, _ = decoder.Token()
+	return nil
+}
+
+// skip returns the offset of the next token after the given offset
+func (d *Description) skip(offset int) int {
+	for offset < len(d.source) {
+		switch d.source[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// errorf returns an error prefixed with the position of the offset in the file
+func (d *Description) errorf(offset int, format string, args ...interface{}) error {
+	line, column := d.position(offset)
+	return fmt.Errorf("%s:%d:%d: %s", d.path, line, column, fmt.Sprintf(format, args...))
+}
+
+// position converts a byte offset into a line and column, both starting at 1
+func (d *Description) position(offset int) (line int, column int) {
+	if offset > len(d.source) {
+		offset = len(d.source)
+	}
+	line = 1 + bytes.Count(d.source[:offset], []byte("\n"))
+	column = offset - bytes.LastIndexByte(d.source[:offset], '\n')
+	return line, column
+}
+
+// imagePath resolves the path of an image relative to the description
+func (d *Description) imagePath(image string) string {
+	if filepath.IsAbs(image) {
+		return image
+	}
+	return filepath.Join(filepath.Dir(d.path), image)
+}
+
+// Build creates the devices and mappings of the machine. ROMs without an
+// image of their own are loaded from romImage.
+func (d *Description) Build(romImage string) (*BusUnit.BusUnit, []*MMU.Mapping, error) {
+	bus := BusUnit.NewBusUnit()
+
+	for _, device := range d.Devices {
+		if device.Name == "" {
+			device.Name = device.Type
+		}
+		if device.Name == MMU.PrivramName || device.Name == MMU.MmuName {
+			return nil, nil, d.errorf(device.offset, "device name %s is reserved", device.Name)
+		}
+		if _, exists := bus.Devices.Id(device.Name); exists {
+			return nil, nil, d.errorf(device.offset, "device %s is declared twice", device.Name)
+		}
+
+		image := device.Image
+		if image != "" {
+			image = d.imagePath(image)
+		} else if device.Type == "rom" {
+			image = romImage
+		}
+		if image != "" {
+			if _, err := os.Stat(image); err != nil {
+				return nil, nil, d.errorf(device.offset, "cannot read image: %s", err)
+			}
+		}
+
+		switch device.Type {
+		case "ram":
+			ram := BusUnit.NewRAM(device.size(BusUnit.DefaultRAMSize))
+			if image != "" {
+				ram.LoadImage(image, uint32(device.Offset))
+			}
+			bus.Attach(device.Name, ram)
+		case "rom":
+			if image == "" {
+				return nil, nil, d.errorf(device.offset, "rom %s needs an image", device.Name)
+			}
+			rom := BusUnit.NewROM(device.size(BusUnit.DefaultROMSize))
+			rom.Load(image, uint32(device.Offset))
+			bus.Attach(device.Name, rom)
+		case "gpu":
+			bus.Attach(device.Name, BusUnit.NewGPU())
+		case "mailbox":
+			cpus := 8
+			if device.Cpus != nil {
+				cpus = int(*device.Cpus)
+			}
+			if cpus < 1 || cpus > 256 {
+				return nil, nil, d.errorf(device.offset, "a mailbox needs between 1 and 256 cpus")
+			}
+			bus.Attach(device.Name, BusUnit.NewMailbox(cpus))
+		default:
+			return nil, nil, d.errorf(device.offset, "unknown device type %q", device.Type)
+		}
+	}
+
+	mappings := make([]*MMU.Mapping, len(d.Mappings))
+	for i, mapping := range d.Mappings {
+		if mapping.Size == 0 || uint32(mapping.Virt)+uint32(mapping.Size) > 0x10000 || mapping.Size > 0xFFFF {
+			return nil, nil, d.errorf(mapping.offset, "mapping 0x%X+0x%X doesn't fit into the address space", uint32(mapping.Virt), uint32(mapping.Size))
+		}
+
+		if id, ok := bus.Devices.Id(mapping.Device); ok {
+			if sized, ok := bus.Devices.Device(id).(BusUnit.Sized); ok && uint64(mapping.Phys)+uint64(mapping.Size) > uint64(sized.Size()) {
+				return nil, nil, d.errorf(mapping.offset, "mapping exceeds the size of %s (0x%X bytes)", mapping.Device, sized.Size())
+			}
+		}
+
+		permissions := uint8(MMU.PermAll)
+		if mapping.Permissions != nil {
+			var err error
+			if permissions, err = MMU.ParsePermissions(*mapping.Permissions); err != nil {
+				return nil, nil, d.errorf(mapping.offset, "%s", err)
+			}
+		}
+
+		mappings[i] = MMU.NewMapping(uint16(mapping.Virt), uint32(mapping.Phys), uint16(mapping.Size), mapping.Device, permissions)
+	}
+
+	deviceNames := make([]string, bus.Devices.Len())
+	for id := range deviceNames {
+		deviceNames[id] = bus.Devices.Name(uint8(id))
+	}
+	if err := MMU.ValidateMappings(mappings, deviceNames); err != nil {
+		var mappingError *MMU.MappingError
+		if !errors.As(err, &mappingError) || mappingError.Index >= len(d.Mappings) {
+			return nil, nil, d.errorf(0, "%s", err)
+		}
+		if mappingError.Other >= 0 {
+			line, column := d.position(d.Mappings[mappingError.Other].offset)
+			return nil, nil, d.errorf(d.Mappings[mappingError.Index].offset, "%s (conflicts with mapping at %d:%d)", err, line, column)
+		}
+		return nil, nil, d.errorf(d.Mappings[mappingError.Index].offset, "%s", err)
+	}
+
+	return bus, mappings, nil
+}
+
+// Boot builds the default machine with the ROM image, sends the output of
+// its GPU to output and resets the devices
+func Boot(romImage string, output io.Writer) (*BusUnit.BusUnit, []*MMU.Mapping, error) {
+	bus, mappings, err := Default().Build(romImage)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, ok := bus.Devices.Id("gpu")
+	if !ok {
+		return nil, nil, errors.New("the machine has no gpu")
+	}
+	gpu, ok := bus.Devices.Device(id).(*BusUnit.GPU)
+	if !ok {
+		return nil, nil, errors.New("device gpu is not a GPU")
+	}
+	gpu.SetOutput(output)
+	bus.Reset()
+	return bus, mappings, nil
+}
+
+// size returns the configured size of the device or the given default
+func (device *Device) size(defaultSize uint32) uint32 {
+	if device.Size == nil {
+		return defaultSize
+	}
+	return uint32(*device.Size)
+}
@@ -0,0 +1,114 @@
+package Machine
+
+import (
+	"emu6502/Logger"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	smp, err := Load("smp.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, description := range map[string]*Description{"default": Default(), "smp": smp} {
+		bus, mappings, err := description.Build("../hello.rom")
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if _, ok := bus.Devices.Id("rom"); !ok {
+			t.Errorf("%s: no rom device", name)
+		}
+		// The last mapping is the ROM, which has to reach up to the vectors
+		last := mappings[len(mappings)-1]
+		if !strings.Contains(last.ToString(), "virtStart: 0x4020") || !strings.Contains(last.ToString(), "size: 0xbfe0") {
+			t.Errorf("%s: ROM mapping %s doesn't end at $FFFF", name, last.ToString())
+		}
+	}
+}
+
+func TestImagePath(t *testing.T) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "boot.rom"), []byte{0xEA}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "board.json")
+	source := strings.Replace(string(defaultDescription), `"size": "$BFE0" }`, `"size": "$BFE0", "image": "boot.rom" }`, 1)
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	description, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The image relative to the description is used instead of the -rom flag
+	if _, _, err := description.Build("missing.rom"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	const rom = `{ "name": "rom", "type": "rom" }`
+	const mappings = `
+		{ "virt": "$0000", "phys": "$0000", "size": "$2000", "device": "privram" },
+		{ "virt": "$4020", "phys": "$0000", "size": "$BFE0", "device": "rom", "permissions": "rx" }`
+
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{`[]`, "board.json:1:1: machine description must be an object"},
+		{"{\n  \"devices\": [\n    { \"name\": }\n  ]\n}", "board.json:3:15: invalid character '}' looking for beginning of value"},
+		{"{\n  \"cpus\": 2\n}", `board.json:2:3: unknown key "cpus"`},
+		{`{ "devices": {} }`, "board.json:1:14: expected a list"},
+		{`{ "devices": [ { "type": "ram", "colour": "red" } ] }`, `board.json:1:16: json: unknown field "colour"`},
+		{`{ "devices": [ { "type": "ram", "size": "$XYZ" } ] }`, `board.json:1:16: invalid number "$XYZ"`},
+		{`{ "devices": [ { "type": "disk" } ] }`, `board.json:1:16: unknown device type "disk"`},
+		{`{ "devices": [ { "type": "ram" }, { "type": "ram" } ] }`, "board.json:1:35: device ram is declared twice"},
+		{`{ "devices": [ { "name": "mmu", "type": "ram" } ] }`, "board.json:1:16: device name mmu is reserved"},
+		{`{ "devices": [ { "type": "mailbox", "cpus": 0 } ] }`, "board.json:1:16: a mailbox needs between 1 and 256 cpus"},
+		{`{ "devices": [ { "type": "ram", "image": "missing.bin" } ] }`, "board.json:1:16: cannot read image"},
+		{
+			"{ \"devices\": [ " + rom + " ], \"mappings\": [" + mappings + ",\n\t\t{ \"virt\": \"$FF00\", \"phys\": \"$0000\", \"size\": \"$0200\", \"device\": \"rom\" } ] }",
+			"board.json:4:3: mapping 0xFF00+0x200 doesn't fit into the address space",
+		},
+		{
+			"{ \"devices\": [ " + rom + " ], \"mappings\": [" + mappings + ",\n\t\t{ \"virt\": \"$8000\", \"phys\": \"$0000\", \"size\": \"$0100\", \"device\": \"rom\" } ] }",
+			"board.json:4:3: ", // overlaps the ROM mapping on line 3
+		},
+		{
+			"{ \"devices\": [ " + rom + " ], \"mappings\": [" + mappings + ",\n\t\t{ \"virt\": \"$2000\", \"phys\": \"$0000\", \"size\": \"$0100\", \"device\": \"disk\" } ] }",
+			"board.json:4:3: Unknown backing store: disk",
+		},
+		{
+			`{ "devices": [ { "type": "rom", "size": "$10" } ], "mappings": [ { "virt": "$2000", "phys": "$0008", "size": "$10", "device": "rom" } ] }`,
+			"board.json:1:66: mapping exceeds the size of rom (0x10 bytes)",
+		},
+	}
+	for _, test := range tests {
+		description, err := parse("board.json", []byte(test.source))
+		if err == nil {
+			_, _, err = description.Build("../hello.rom")
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), test.expected) {
+			t.Errorf("%s\ngot %v\nexpected %q", test.source, err, test.expected)
+		}
+	}
+
+	// Overlaps point at both mappings
+	source := "{ \"devices\": [ " + rom + " ], \"mappings\": [" + mappings + ",\n\t\t{ \"virt\": \"$8000\", \"phys\": \"$0000\", \"size\": \"$0100\", \"device\": \"rom\" } ] }"
+	description, err := parse("board.json", []byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := description.Build("../hello.rom"); err == nil || !strings.HasSuffix(err.Error(), "(conflicts with mapping at 3:3)") {
+		t.Errorf("overlap: got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package Machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Number is an unsigned number in a machine description. It can be
+// written as a JSON number or as a string in decimal, "0x" or "$" hex.
+type Number uint32
+
+func (n *Number) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		// Not a string, so it has to be a plain number
+		text = string(data)
+	}
+
+	base := 10
+	switch {
+	case strings.HasPrefix(text, "$"):
+		text, base = text[1:], 16
+	case strings.HasPrefix(text, "0x"), strings.HasPrefix(text, "0X"):
+		text, base = text[2:], 16
+	}
+
+	value, err := strconv.ParseUint(text, base, 32)
+	if err != nil {
+		return fmt.Errorf("invalid number %s", data)
+	}
+	*n = Number(value)
+	return nil
+}
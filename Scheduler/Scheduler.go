@@ -0,0 +1,197 @@
+package Scheduler
+
+import (
+	"emu6502/ComputeUnit"
+	"emu6502/Logger"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// Mode selects how the compute units are executed
+type Mode int
+
+const (
+	// ModeLockstep interleaves all compute units on one goroutine in a
+	// fixed order, so every run produces the same bus accesses
+	ModeLockstep Mode = iota
+	// ModeFree runs every compute unit in its own goroutine
+	ModeFree
+)
+
+// Granularity selects what a quantum is measured in
+type Granularity int
+
+const (
+	// GranularityInstruction gives every compute unit Quantum instructions per turn
+	GranularityInstruction Granularity = iota
+	// GranularityCycle lets every compute unit run until it has executed
+	// Quantum more cycles than in the last round
+	GranularityCycle
+)
+
+type Config struct {
+	Mode        Mode
+	Granularity Granularity
+	// Quantum is the length of a turn, at least 1
+	Quantum uint64
+	// Order lists the indices of the compute units in the order they
+	// take their turns. Empty means ascending.
+	Order []int
+	// Seed shuffles the order of every round if it isn't 0. The same
+	// seed always gives the same interleaving.
+	Seed int64
+}
+
+// DefaultConfig interleaves the compute units instruction by instruction
+func DefaultConfig() Config {
+	return Config{
+		Mode:        ModeLockstep,
+		Granularity: GranularityInstruction,
+		Quantum:     1,
+	}
+}
+
+type Scheduler struct {
+	units  []*ComputeUnit.ComputeUnit
+	config Config
+
+	order []int
+	rand  *rand.Rand
+	// target is the cycle count every unit has to reach in this round
+	// when scheduling by cycles
+	target uint64
+
+	shouldHalt uint32
+	wg         sync.WaitGroup
+	// done is closed when the compute units started by Run have stopped
+	done chan struct{}
+}
+
+// NewScheduler creates a scheduler for the compute units
+func NewScheduler(units []*ComputeUnit.ComputeUnit, config Config) (*Scheduler, error) {
+	if config.Quantum == 0 {
+		config.Quantum = 1
+	}
+
+	order := config.Order
+	if len(order) == 0 {
+		order = make([]int, len(units))
+		for i := range order {
+			order[i] = i
+		}
+	}
+	if len(order) != len(units) {
+		return nil, fmt.Errorf("order has %d entries for %d compute units", len(order), len(units))
+	}
+	seen := make([]bool, len(units))
+	for _, index := range order {
+		if index < 0 || index >= len(units) || seen[index] {
+			return nil, fmt.Errorf("order must list every compute unit exactly once")
+		}
+		seen[index] = true
+	}
+
+	s := &Scheduler{
+		units:  units,
+		config: config,
+		order:  append([]int(nil), order...),
+		done:   make(chan struct{}),
+	}
+	if config.Seed != 0 {
+		s.rand = rand.New(rand.NewSource(config.Seed))
+	}
+	return s, nil
+}
+
+// Step runs one round: every compute unit that hasn't halted gets one turn
+func (s *Scheduler) Step() {
+	if s.rand != nil {
+		s.rand.Shuffle(len(s.order), func(i, j int) {
+			s.order[i], s.order[j] = s.order[j], s.order[i]
+		})
+	}
+
+	s.target += s.config.Quantum
+	for _, index := range s.order {
+		unit := s.units[index]
+		switch s.config.Granularity {
+		case GranularityInstruction:
+			for i := uint64(0); i < s.config.Quantum && !unit.Halted(); i++ {
+				unit.Step()
+			}
+		case GranularityCycle:
+			for unit.Cycles() < s.target && !unit.Halted() {
+				unit.Step()
+			}
+		}
+	}
+}
+
+// Halted reports whether all compute units have halted
+func (s *Scheduler) Halted() bool {
+	for _, unit := range s.units {
+		if !unit.Halted() {
+			return false
+		}
+	}
+	return true
+}
+
+// RunUntil runs rounds on the calling goroutine until done returns true,
+// all compute units have halted or maxRounds rounds have been run.
+// It reports whether done returned true.
+func (s *Scheduler) RunUntil(done func() bool, maxRounds uint64) bool {
+	for round := uint64(0); round < maxRounds; round++ {
+		if done() {
+			return true
+		}
+		if s.Halted() {
+			return false
+		}
+		s.Step()
+	}
+	return done()
+}
+
+// Run starts the compute units. It doesn't block, Done tells when all of
+// them have stopped.
+func (s *Scheduler) Run() {
+	if s.config.Mode == ModeFree {
+		for _, unit := range s.units {
+			unit.Run()
+		}
+		go func() {
+			for _, unit := range s.units {
+				unit.Wait()
+			}
+			close(s.done)
+		}()
+		return
+	}
+
+	Logger.Infof("Scheduler running %d compute units in lockstep", len(s.units))
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(s.done)
+		for atomic.LoadUint32(&s.shouldHalt) == 0 && !s.Halted() {
+			s.Step()
+		}
+	}()
+}
+
+// Done is closed when all compute units started by Run have stopped
+func (s *Scheduler) Done() <-chan struct{} {
+	return s.done
+}
+
+// Halt stops all compute units and waits until they have stopped
+func (s *Scheduler) Halt() {
+	atomic.StoreUint32(&s.shouldHalt, 1)
+	s.wg.Wait()
+	for _, unit := range s.units {
+		unit.Halt()
+	}
+}
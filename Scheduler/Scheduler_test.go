@@ -0,0 +1,109 @@
+package Scheduler
+
+import (
+	"bytes"
+	"emu6502/ComputeUnit"
+	"emu6502/Logger"
+	"emu6502/Machine"
+	"io"
+	"testing"
+	"time"
+)
+
+// run executes hello.rom on the given number of CPUs and returns the
+// interleaved output of all of them
+func run(t *testing.T, cpus int, config Config) string {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+
+	var output bytes.Buffer
+	bus, mappings, err := Machine.Boot("../hello.rom", &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	units := make([]*ComputeUnit.ComputeUnit, cpus)
+	for id := range units {
+		units[id] = ComputeUnit.NewComputeUnit(bus, mappings, uint8(id))
+		units[id].Reset()
+	}
+
+	scheduler, err := NewScheduler(units, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduler.RunUntil(func() bool { return false }, 20000)
+	return output.String()
+}
+
+func TestLockstepIsReproducible(t *testing.T) {
+	configs := map[string]Config{
+		"instruction": DefaultConfig(),
+		"cycle":       {Granularity: GranularityCycle, Quantum: 13},
+		"seed":        {Granularity: GranularityInstruction, Quantum: 3, Seed: 42},
+		"order":       {Order: []int{2, 0, 1}},
+	}
+	for name, config := range configs {
+		first := run(t, 3, config)
+		if first == "" {
+			t.Fatalf("%s: no output", name)
+		}
+		for i := 0; i < 3; i++ {
+			if output := run(t, 3, config); output != first {
+				t.Errorf("%s: run %d printed %q, first run printed %q", name, i, output, first)
+			}
+		}
+	}
+}
+
+func TestLockstepInterleavesInOrder(t *testing.T) {
+	output := run(t, 2, DefaultConfig())
+	if output[:4] != "HHee" {
+		t.Errorf("expected both CPUs to print in turns, got %q", output[:4])
+	}
+}
+
+func TestInvalidOrder(t *testing.T) {
+	for _, order := range [][]int{{0}, {0, 0}, {0, 2}} {
+		if _, err := NewScheduler(make([]*ComputeUnit.ComputeUnit, 2), Config{Order: order}); err == nil {
+			t.Errorf("order %v was accepted", order)
+		}
+	}
+}
+
+func TestDone(t *testing.T) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	for name, mode := range map[string]Mode{"lockstep": ModeLockstep, "free": ModeFree} {
+		bus, mappings, err := Machine.Boot("../hello.rom", io.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bus.EnableArbitration()
+
+		units := make([]*ComputeUnit.ComputeUnit, 2)
+		for id := range units {
+			units[id] = ComputeUnit.NewComputeUnit(bus, mappings, uint8(id))
+			units[id].Reset()
+		}
+		config := DefaultConfig()
+		config.Mode = mode
+		scheduler, err := NewScheduler(units, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scheduler.Run()
+
+		units[0].CPU().Stop()
+		select {
+		case <-scheduler.Done():
+			t.Fatalf("%s: done with a CPU still running", name)
+		case <-time.After(10 * time.Millisecond):
+		}
+		units[1].CPU().Stop()
+		select {
+		case <-scheduler.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: not done after all CPUs halted", name)
+		}
+		scheduler.Halt()
+	}
+}
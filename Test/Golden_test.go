@@ -0,0 +1,119 @@
+package Test
+
+import (
+	"bytes"
+	"emu6502/Assembler"
+	"emu6502/ComputeUnit"
+	"emu6502/Disassembler"
+	"emu6502/Logger"
+	"emu6502/Machine"
+	"emu6502/Scheduler"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Write the output of the programs to the golden files")
+
+// instructionBudget is the number of instructions a program runs for
+const instructionBudget = 1 << 22
+
+// haltLabel is the label of the endless loop of the halt macro. Reaching
+// it ends the run before the budget is used up.
+const haltLabel = "_halt"
+
+// TestGolden runs every program that has a golden file and compares what
+// it prints with the file. A new program needs an empty golden file
+// before it can be recorded with -update.
+func TestGolden(t *testing.T) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	goldenFiles, err := filepath.Glob("*.output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(goldenFiles) == 0 {
+		t.Fatal("no golden files found")
+	}
+
+	for _, goldenFile := range goldenFiles {
+		name := strings.TrimSuffix(goldenFile, ".output")
+		t.Run(name, func(t *testing.T) {
+			output := run(t, name+".oph")
+			if *update {
+				if err := os.WriteFile(goldenFile, output, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(output, expected) {
+				t.Errorf("output differs from %s, got\n%s", goldenFile, output)
+			}
+		})
+	}
+}
+
+// run assembles the program, boots the default machine with it and
+// returns what the program printed until it reached a halt loop or used
+// up the instruction budget
+func run(t *testing.T, source string) []byte {
+	t.Helper()
+	program, err := Assembler.Assemble(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program.Origin != Disassembler.DefaultOrigin {
+		t.Fatalf("%s starts at $%04X, the ROM is mapped at $%04X", source, program.Origin, Disassembler.DefaultOrigin)
+	}
+	halts := make(map[uint16]bool)
+	for _, label := range program.Labels {
+		if label.Name == haltLabel {
+			halts[label.Address] = true
+		}
+	}
+	rom := filepath.Join(t.TempDir(), "program.rom")
+	if err := os.WriteFile(rom, program.Data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	bus, mappings, err := Machine.Boot(rom, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cu := ComputeUnit.NewComputeUnit(bus, mappings, 0)
+	cu.Reset()
+	scheduler, err := Scheduler.NewScheduler([]*ComputeUnit.ComputeUnit{cu}, Scheduler.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := cu.CPU()
+	scheduler.RunUntil(func() bool { return halts[cpu.PC()] }, instructionBudget)
+	return output.Bytes()
+}
+
+func TestBudget(t *testing.T) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	dir := t.TempDir()
+	stdlib, err := os.ReadFile("stdlib.oph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "stdlib.oph"), stdlib, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Loops forever without invoking halt
+	source := filepath.Join(dir, "loop.oph")
+	program := ".org $4020\n.include \"stdlib.oph\"\nstart:\n    lda #65\n    .invoke printChar\nloop:\n    jmp loop\n.advance $FFFC\n.word start\n"
+	if err := os.WriteFile(source, []byte(program), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if output := run(t, source); string(output) != "A" {
+		t.Errorf("got %q, expected the output printed before the budget was used up", output)
+	}
+}
@@ -1,7 +1,6 @@
-#!/bin/zsh
+#!/usr/bin/env bash
 #set -xe
 
-OPTHIS_CMD="Ophis/bin/ophis"
 EMU6502_CMD="../emu6502"
 BUILD_DIR="build"
 SOURCE_FILES=(
@@ -13,7 +12,7 @@ SOURCE_FILES=(
 )
 
 function clean() {
-  rm -r $BUILD_DIR
+  rm -r "$BUILD_DIR"
 }
 
 function compile() {
@@ -21,12 +20,12 @@ function compile() {
   go build
   popd || exit 1
 
-  for file in $SOURCE_FILES; do
+  for file in "${SOURCE_FILES[@]}"; do
     name=${file%.*}
-    if ! $OPTHIS_CMD -l "$BUILD_DIR/$name.l" \
-                     -m "$BUILD_DIR/$name.m" \
-                     -o "$BUILD_DIR/$name.rom" \
-                     "$file"; then
+    if ! $EMU6502_CMD asm -l "$BUILD_DIR/$name.l" \
+                          -m "$BUILD_DIR/$name.m" \
+                          -o "$BUILD_DIR/$name.rom" \
+                          "$file"; then
       echo "Failed to build $file"
       exit 1
     fi
@@ -35,7 +34,7 @@ function compile() {
 
 function run() {
   compile
-  for file in $SOURCE_FILES; do
+  for file in "${SOURCE_FILES[@]}"; do
     name=${file%.*}
     if ! $EMU6502_CMD -loglevel info \
                       -runtime 1 \
@@ -64,7 +63,7 @@ function run_single() {
 
 function save_test() {
   compile
-  for file in $SOURCE_FILES; do
+  for file in "${SOURCE_FILES[@]}"; do
     name=${file%.*}
     if ! $EMU6502_CMD -loglevel info \
                       -runtime 1 \
@@ -79,7 +78,7 @@ function save_test() {
 
 function test() {
   compile
-  for file in $SOURCE_FILES; do
+  for file in "${SOURCE_FILES[@]}"; do
     name=${file%.*}
     if ! $EMU6502_CMD -loglevel info \
       -runtime 1 \
@@ -0,0 +1,212 @@
+package Tracer
+
+import (
+	"bufio"
+	"emu6502/ComputeUnit/CPU"
+	"emu6502/ComputeUnit/CPU/AddressMode"
+	"emu6502/Debugger"
+	"emu6502/Disassembler"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// binaryMagic starts a binary trace, the last byte is the version
+const binaryMagic = "6502TRC\x01"
+
+// RecordSize is the size of a record in a binary trace. All values are
+// little endian:
+//
+//	0-1    PC
+//	2-4    bytes of the instruction, unused ones are 0
+//	5-9    A, X, Y, P, SP
+//	10-15  cycle count, the lower 48 bits
+const RecordSize = 16
+
+// PeekFunc reads memory without side effects. ok is false if the value
+// can't be known, like for I/O devices.
+type PeekFunc func(address uint16) (data uint8, ok bool)
+
+// Record is the state of the CPU before an instruction
+type Record struct {
+	Registers CPU.Registers
+	// Bytes are the bytes of the instruction, including the opcode
+	Bytes  []uint8
+	Cycles uint64
+}
+
+// Capture records the state of the CPU before its next instruction
+func Capture(c *CPU.CPU) Record {
+	record := Record{Registers: c.Registers(), Cycles: c.Cycles()}
+	opcode, _ := c.StoredByteAt(record.Registers.PC)
+	record.Bytes = append(record.Bytes, opcode)
+	for i := uint16(1); i < uint16(length(opcode)); i++ {
+		data, _ := c.StoredByteAt(record.Registers.PC + i)
+		record.Bytes = append(record.Bytes, data)
+	}
+	return record
+}
+
+// length returns the number of bytes of the instruction, 1 for an
+// illegal opcode
+func length(opcode uint8) uint8 {
+	if instruction := &CPU.Instructions[opcode]; instruction.Valid() {
+		return instruction.Bytes
+	}
+	return 1
+}
+
+// line disassembles the instruction
+func (r Record) line() Disassembler.Line {
+	return Disassembler.Decode(func(address uint16) uint8 {
+		if offset := int(address - r.Registers.PC); offset < len(r.Bytes) {
+			return r.Bytes[offset]
+		}
+		return 0
+	}, r.Registers.PC)
+}
+
+// Text formats the record like Nintendulator, for example
+//
+//	4049  BD 6D 40  LDA $406D,X @ 406D = 48         A:00 X:00 Y:00 P:24 SP:FF CYC:9
+//
+// The operand address and value are resolved with peek, which may be nil
+// to leave them out. If symbols isn't nil, the label of the PC is added
+// as last column.
+func (r Record) Text(peek PeekFunc, symbols *Debugger.Symbols) string {
+	line := r.line()
+	hexBytes := make([]string, len(r.Bytes))
+	for i, b := range r.Bytes {
+		hexBytes[i] = fmt.Sprintf("%02X", b)
+	}
+	assembly := line.Assembly(nil)
+	if peek != nil && line.Instruction != nil {
+		assembly += resolve(line, r.Registers, peek)
+	}
+
+	registers := r.Registers
+	text := fmt.Sprintf("%04X  %-8s  %-31s A:%02X X:%02X Y:%02X P:%02X SP:%02X CYC:%d",
+		registers.PC, strings.Join(hexBytes, " "), assembly, registers.A, registers.X, registers.Y, registers.P, registers.SP, r.Cycles)
+	if label := symbols.Label(registers.PC); label != "" {
+		text += "  " + label
+	}
+	return text
+}
+
+// resolve formats the address and value the operand of the instruction
+// refers to, like " @ 406D = 48"
+func resolve(line Disassembler.Line, registers CPU.Registers, peek PeekFunc) string {
+	value := func(address uint16) string {
+		if data, ok := peek(address); ok {
+			return fmt.Sprintf("%02X", data)
+		}
+		return "??"
+	}
+	word := func(low uint16, high uint16) uint16 {
+		lowByte, _ := peek(low)
+		highByte, _ := peek(high)
+		return CPU.CombineLowHigh(lowByte, highByte)
+	}
+
+	operand := line.Operand
+	switch line.Instruction.Mode {
+	case AddressMode.ZeroPage:
+		return " = " + value(operand)
+	case AddressMode.ZeroPageX, AddressMode.ZeroPageY:
+		index := registers.X
+		if line.Instruction.Mode == AddressMode.ZeroPageY {
+			index = registers.Y
+		}
+		address := uint16(uint8(operand) + index)
+		return fmt.Sprintf(" @ %02X = %s", address, value(address))
+	case AddressMode.Absolut:
+		if line.Instruction.Mnemonic == "JMP" || line.Instruction.Mnemonic == "JSR" {
+			return ""
+		}
+		return " = " + value(operand)
+	case AddressMode.AbsolutX, AddressMode.AbsolutY:
+		index := registers.X
+		if line.Instruction.Mode == AddressMode.AbsolutY {
+			index = registers.Y
+		}
+		address := operand + uint16(index)
+		return fmt.Sprintf(" @ %04X = %s", address, value(address))
+	case AddressMode.Indirect:
+		// Like the CPU, without a carry into the high byte of the pointer
+		return fmt.Sprintf(" = %04X", word(operand, operand&0xFF00|uint16(uint8(operand)+1)))
+	case AddressMode.IndirectX:
+		pointer := uint8(operand) + registers.X
+		address := word(uint16(pointer), uint16(pointer+1))
+		return fmt.Sprintf(" @ %02X = %04X = %s", pointer, address, value(address))
+	case AddressMode.IndirectY:
+		base := word(operand, uint16(uint8(operand)+1))
+		address := base + uint16(registers.Y)
+		return fmt.Sprintf(" = %04X @ %04X = %s", base, address, value(address))
+	default:
+		return ""
+	}
+}
+
+// MarshalBinary encodes the record for a binary trace
+func (r Record) MarshalBinary() []byte {
+	data := make([]byte, RecordSize)
+	binary.LittleEndian.PutUint16(data[0:], r.Registers.PC)
+	copy(data[2:5], r.Bytes)
+	data[5] = r.Registers.A
+	data[6] = r.Registers.X
+	data[7] = r.Registers.Y
+	data[8] = r.Registers.P
+	data[9] = r.Registers.SP
+	var cycles [8]byte
+	binary.LittleEndian.PutUint64(cycles[:], r.Cycles)
+	copy(data[10:], cycles[:6])
+	return data
+}
+
+// UnmarshalRecord decodes a record of a binary trace
+func UnmarshalRecord(data []byte) (Record, error) {
+	if len(data) != RecordSize {
+		return Record{}, fmt.Errorf("invalid record size %d", len(data))
+	}
+	record := Record{Registers: CPU.Registers{
+		PC: binary.LittleEndian.Uint16(data[0:]),
+		A:  data[5],
+		X:  data[6],
+		Y:  data[7],
+		P:  data[8],
+		SP: data[9],
+	}}
+	record.Bytes = append([]uint8(nil), data[2:2+length(data[2])]...)
+	var cycles [8]byte
+	copy(cycles[:], data[10:])
+	record.Cycles = binary.LittleEndian.Uint64(cycles[:])
+	return record, nil
+}
+
+// Reader reads the records of a binary trace
+type Reader struct {
+	reader *bufio.Reader
+	data   []byte
+}
+
+// NewReader checks the header of the binary trace
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{reader: bufio.NewReader(r), data: make([]byte, RecordSize)}
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(reader.reader, magic); err != nil || string(magic) != binaryMagic {
+		return nil, errors.New("not a binary trace")
+	}
+	return reader, nil
+}
+
+// Next returns the next record, io.EOF at the end of the trace
+func (r *Reader) Next() (Record, error) {
+	if _, err := io.ReadFull(r.reader, r.data); err == io.ErrUnexpectedEOF {
+		return Record{}, errors.New("truncated trace")
+	} else if err != nil {
+		return Record{}, err
+	}
+	return UnmarshalRecord(r.data)
+}
@@ -0,0 +1,98 @@
+package Tracer
+
+import (
+	"bufio"
+	"emu6502/ComputeUnit/CPU"
+	"emu6502/Debugger"
+	"emu6502/Logger"
+	"io"
+	"os"
+	"sync"
+)
+
+// Format selects how the trace is written
+type Format int
+
+const (
+	// FormatText writes one line per instruction like Nintendulator
+	FormatText Format = iota
+	// FormatBinary writes a fixed size record per instruction, see Record
+	FormatBinary
+)
+
+// Tracer writes a line or record for every instruction a CPU executes.
+// The state is captured before the instruction, so the cycle count is the
+// number of cycles executed before it.
+type Tracer struct {
+	mutex  sync.Mutex
+	writer *bufio.Writer
+	closer io.Closer
+	format Format
+	// symbols adds the label of the PC as last column of the text format
+	symbols *Debugger.Symbols
+	// err is the first write error, the trace stops after it
+	err error
+}
+
+// New creates a tracer writing to w. symbols may be nil, a text trace then
+// has no symbol column.
+func New(w io.Writer, format Format, symbols *Debugger.Symbols) *Tracer {
+	t := &Tracer{writer: bufio.NewWriterSize(w, 64*1024), format: format, symbols: symbols}
+	if format == FormatBinary {
+		_, t.err = t.writer.WriteString(binaryMagic)
+	}
+	return t
+}
+
+// Create creates the file and a tracer writing to it
+func Create(path string, format Format, symbols *Debugger.Symbols) (*Tracer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	t := New(file, format, symbols)
+	t.closer = file
+	return t, nil
+}
+
+// Attach traces the instructions of the CPU. Hooks are called in the
+// order they were added, so a tracer attached after a debugger sees the
+// registers the debugger may have changed.
+func (t *Tracer) Attach(cpu *CPU.CPU) {
+	cpu.AddInstructionHook(t.trace)
+}
+
+// Close flushes the trace and closes the file opened by Create
+func (t *Tracer) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	err := t.writer.Flush()
+	if t.err == nil {
+		t.err = err
+	}
+	if t.closer != nil {
+		if err := t.closer.Close(); t.err == nil {
+			t.err = err
+		}
+	}
+	return t.err
+}
+
+// trace is the instruction hook
+func (t *Tracer) trace(c *CPU.CPU) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.err != nil {
+		return
+	}
+
+	record := Capture(c)
+	if t.format == FormatBinary {
+		_, t.err = t.writer.Write(record.MarshalBinary())
+	} else {
+		_, t.err = t.writer.WriteString(record.Text(c.StoredByteAt, t.symbols) + "\n")
+	}
+	if t.err != nil {
+		Logger.Errorf("Cannot write the trace: %s", t.err)
+	}
+}
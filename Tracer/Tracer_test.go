@@ -0,0 +1,119 @@
+package Tracer
+
+import (
+	"bytes"
+	"emu6502/ComputeUnit"
+	"emu6502/ComputeUnit/CPU"
+	"emu6502/Debugger"
+	"emu6502/Logger"
+	"emu6502/Machine"
+	"emu6502/Scheduler"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestText(t *testing.T) {
+	var memory [0x10000]uint8
+	memory[0x0010], memory[0x0011] = 0x00, 0x03
+	memory[0x0024], memory[0x0025] = 0x80, 0x02
+	memory[0x0280] = 0x5A
+	memory[0x0304] = 0x89
+	memory[0x02FF], memory[0x0200] = 0x7E, 0xDB
+	peek := func(address uint16) (uint8, bool) {
+		if address >= 0x4000 && address < 0x4020 {
+			return 0, false
+		}
+		return memory[address], true
+	}
+	registers := CPU.Registers{A: 0x01, X: 0x04, Y: 0x04, SP: 0xFD, PC: 0xC000, P: 0x24}
+
+	tests := []struct {
+		bytes    []uint8
+		expected string
+	}{
+		{[]uint8{0x18}, "C000  18        CLC                             A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0x4A}, "C000  4A        LSR A                           A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0xA9, 0x10}, "C000  A9 10     LDA #$10                        A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0xA5, 0x10}, "C000  A5 10     LDA $10 = 00                    A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0xB5, 0xFE}, "C000  B5 FE     LDA $FE,X @ 02 = 00             A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0xAD, 0x80, 0x02}, "C000  AD 80 02  LDA $0280 = 5A                  A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0x8D, 0x00, 0x40}, "C000  8D 00 40  STA $4000 = ??                  A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0x20, 0x00, 0x03}, "C000  20 00 03  JSR $0300                       A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0xBD, 0x00, 0x03}, "C000  BD 00 03  LDA $0300,X @ 0304 = 89         A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0x6C, 0xFF, 0x02}, "C000  6C FF 02  JMP ($02FF) = DB7E              A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0xA1, 0x20}, "C000  A1 20     LDA ($20,X) @ 24 = 0280 = 5A    A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0xB1, 0x10}, "C000  B1 10     LDA ($10),Y = 0300 @ 0304 = 89  A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+		{[]uint8{0xD0, 0xFE}, "C000  D0 FE     BNE $C000                       A:01 X:04 Y:04 P:24 SP:FD CYC:7"},
+	}
+	for _, test := range tests {
+		record := Record{Registers: registers, Bytes: test.bytes, Cycles: 7}
+		if text := record.Text(peek, nil); text != test.expected {
+			t.Errorf("got\n%s\nexpected\n%s", text, test.expected)
+		}
+	}
+
+	symbols := Debugger.NewSymbols(map[string]uint16{"reset": 0xBFF0})
+	record := Record{Registers: registers, Bytes: []uint8{0x18}}
+	if text := record.Text(nil, symbols); !strings.HasSuffix(text, "CYC:0  reset+16") {
+		t.Errorf("symbol column: got %q", text)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	Logger.ActiveLogLevel = Logger.LogLevelError
+	bus, mappings, err := Machine.Boot("../hello.rom", io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cu := ComputeUnit.NewComputeUnit(bus, mappings, 0)
+	cu.Reset()
+	scheduler, err := Scheduler.NewScheduler([]*ComputeUnit.ComputeUnit{cu}, Scheduler.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var text, compact bytes.Buffer
+	textTracer := New(&text, FormatText, nil)
+	binaryTracer := New(&compact, FormatBinary, nil)
+	textTracer.Attach(cu.CPU())
+	binaryTracer.Attach(cu.CPU())
+	for i := 0; i < 3; i++ {
+		scheduler.Step()
+	}
+	if err := textTracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := binaryTracer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "4047  A2 00     LDX #$00                        A:00 X:00 Y:00 P:20 SP:FF CYC:0\n" +
+		"4049  BD 6D 40  LDA $406D,X @ 406D = 48         A:00 X:00 Y:00 P:22 SP:FF CYC:2\n" +
+		"404C  F0 06     BEQ $4054                       A:48 X:00 Y:00 P:20 SP:FF CYC:6\n"
+	if text.String() != expected {
+		t.Errorf("text trace: got\n%s", text.String())
+	}
+
+	// The binary trace has the same records, without the operand values
+	if compact.Len() != len(binaryMagic)+3*RecordSize {
+		t.Fatalf("binary trace: got %d bytes", compact.Len())
+	}
+	reader, err := NewReader(&compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(expected, "\n")
+	for i := 0; ; i++ {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if text := record.Text(nil, nil); text != strings.Replace(lines[i], " @ 406D = 48", "            ", 1) {
+			t.Errorf("binary record %d: got %q", i, text)
+		}
+	}
+}
@@ -2,7 +2,7 @@
 
 # Build hello.rom
 cd Test || exit
-if ! ./Ophis/bin/ophis -l helloWorld.l -m helloWorld.m helloWorld.oph; then
+if ! go run .. asm -l helloWorld.l -m helloWorld.m helloWorld.oph; then
     echo "Failed to build helloWorld.oph"
     cd ..
     exit 1
@@ -1,24 +1,64 @@
 package main
 
 import (
-	"emu6502/BusUnit"
 	"emu6502/ComputeUnit"
+	"emu6502/ComputeUnit/CPU"
+	"emu6502/ComputeUnit/MMU"
+	"emu6502/Debugger"
+	"emu6502/Debugger/GDB"
 	"emu6502/Logger"
+	"emu6502/Machine"
+	"emu6502/Scheduler"
+	"emu6502/Tracer"
 	"flag"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
 var romFilename string
+var machineFilename string
 var runtimeLimit int64
+var brkDebug bool
+var startMonitor bool
+var gdbAddress string
+var recordSize int
+var traceFilename string
+var traceFormat Tracer.Format
+var traceSymbols bool
+var clockSpeed uint64
+var cpuVariant CPU.Variant
+var faultPolicy MMU.FaultPolicy
+var cpuCount int
+var schedulerConfig = Scheduler.DefaultConfig()
 
 func init() {
 	loglevel := flag.String("loglevel", "debug", "Debug mode")
 	romFilenamePtr := flag.String("rom", "hello.rom", "Path to the ROM `file`")
+	machineFilenamePtr := flag.String("machine", "", "Path to the machine description `file`, the default machine is used if empty")
 	runtimeLimitPtr := flag.Int64("runtime", 10000, "Limit the runtime to the given number of `seconds`")
+	mhzPtr := flag.Float64("mhz", 1, "Emulated clock speed in `MHz`")
+	turboPtr := flag.Bool("turbo", false, "Run unthrottled, as fast as possible")
+	variantPtr := flag.String("cpu", "nmos", "Emulated CPU `variant`: nmos or 2a03")
+	faultPolicyPtr := flag.String("mmufault", "log", "What to do on MMU access faults: log, irq, nmi or halt")
+	cpuCountPtr := flag.Int("cpus", 1, "Number of `CPUs` sharing the bus, each can read its id from the MMU")
+	schedPtr := flag.String("sched", "lockstep", "How the CPUs are executed: lockstep interleaves them deterministically, free runs each in its own goroutine")
+	granularityPtr := flag.String("granularity", "instruction", "What the lockstep quantum is measured in: instruction or cycle")
+	quantumPtr := flag.Uint64("quantum", 1, "Number of instructions or cycles a CPU runs per turn")
+	orderPtr := flag.String("order", "", "Comma separated `ids` of the CPUs in the order they take their turns")
+	seedPtr := flag.Int64("seed", 0, "Shuffle the order of the CPUs every round using the `seed`, 0 keeps the order fixed")
+	brkDebugPtr := flag.Bool("brkdebug", false, "BRK enters the monitor instead of raising an interrupt")
+	monitorPtr := flag.Bool("monitor", false, "Start in the monitor, stopped before the first instruction")
+	gdbPtr := flag.String("gdb", "", "Wait for a GDB remote connection on the `address`, like :2345, stopped before the first instruction")
+	recordPtr := flag.Int("record", 0, "Record the last `n` instructions so the monitor or GDB can run backwards")
+	tracePtr := flag.String("trace", "", "Write a trace of the instructions of the first CPU to the `file`")
+	traceFormatPtr := flag.String("traceformat", "text", "Format of the trace: text like Nintendulator, or a compact binary one")
+	traceSymbolsPtr := flag.Bool("tracesymbols", false, "Add the labels of the mapping file as last column of a text trace")
 	Logger.DebugListingFile = flag.String("listing", "", "Path to the listing `file`")
 	Logger.DebugMappingFile = flag.String("mapping", "", "Path to the mapping `file`")
 
+	flag.Usage = usage
 	flag.Parse()
 
 	switch strings.ToLower(*loglevel) {
@@ -31,28 +71,207 @@ func init() {
 	}
 
 	romFilename = *romFilenamePtr
+	machineFilename = *machineFilenamePtr
 	runtimeLimit = *runtimeLimitPtr
+	brkDebug = *brkDebugPtr
+	startMonitor = *monitorPtr
+	gdbAddress = *gdbPtr
+	recordSize = *recordPtr
+	traceFilename = *tracePtr
+	traceSymbols = *traceSymbolsPtr
+	switch strings.ToLower(*traceFormatPtr) {
+	case "text":
+		traceFormat = Tracer.FormatText
+	case "binary":
+		traceFormat = Tracer.FormatBinary
+	default:
+		Logger.Fatalf("Unknown trace format: %s", *traceFormatPtr)
+	}
+	if gdbAddress != "" && (brkDebug || startMonitor) {
+		Logger.Fatalf("The GDB server can't be combined with the monitor")
+	}
+	cpuCount = *cpuCountPtr
+	if cpuCount < 1 || cpuCount > 256 {
+		Logger.Fatalf("Number of CPUs must be between 1 and 256")
+	}
+
+	switch strings.ToLower(*variantPtr) {
+	case "nmos":
+		cpuVariant = CPU.VariantNMOS
+	case "2a03":
+		cpuVariant = CPU.Variant2A03
+	default:
+		Logger.Fatalf("Unknown CPU variant: %s", *variantPtr)
+	}
+
+	switch strings.ToLower(*schedPtr) {
+	case "lockstep":
+		schedulerConfig.Mode = Scheduler.ModeLockstep
+	case "free":
+		schedulerConfig.Mode = Scheduler.ModeFree
+	default:
+		Logger.Fatalf("Unknown scheduler: %s", *schedPtr)
+	}
+
+	switch strings.ToLower(*granularityPtr) {
+	case "instruction":
+		schedulerConfig.Granularity = Scheduler.GranularityInstruction
+	case "cycle":
+		schedulerConfig.Granularity = Scheduler.GranularityCycle
+	default:
+		Logger.Fatalf("Unknown granularity: %s", *granularityPtr)
+	}
+	schedulerConfig.Quantum = *quantumPtr
+	schedulerConfig.Seed = *seedPtr
+
+	if *orderPtr != "" {
+		for _, id := range strings.Split(*orderPtr, ",") {
+			index, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				Logger.Fatalf("Invalid CPU id in order: %s", id)
+			}
+			schedulerConfig.Order = append(schedulerConfig.Order, index)
+		}
+	}
+
+	switch strings.ToLower(*faultPolicyPtr) {
+	case "log":
+		faultPolicy = MMU.FaultLog
+	case "irq":
+		faultPolicy = MMU.FaultTrapIRQ
+	case "nmi":
+		faultPolicy = MMU.FaultTrapNMI
+	case "halt":
+		faultPolicy = MMU.FaultHalt
+	default:
+		Logger.Fatalf("Unknown MMU fault policy: %s", *faultPolicyPtr)
+	}
+
+	if *turboPtr {
+		clockSpeed = 0
+	} else if *mhzPtr > 0 {
+		clockSpeed = uint64(*mhzPtr * 1000000)
+	} else {
+		Logger.Fatalf("Clock speed must be positive, use -turbo to run unthrottled")
+	}
 }
 
 func main() {
-	busUnit := BusUnit.NewBusUnit()
+	if flag.NArg() > 0 {
+		command, ok := commands[flag.Arg(0)]
+		if !ok {
+			Logger.Fatalf("Unknown command: %s", flag.Arg(0))
+		}
+		command.run(flag.Args()[1:])
+		return
+	}
 
-	cu1 := ComputeUnit.NewComputeUnit(busUnit)
-	time.Now()
+	machine := Machine.Default()
+	if machineFilename != "" {
+		var err error
+		machine, err = Machine.Load(machineFilename)
+		if err != nil {
+			Logger.Fatalf("Cannot load machine description: %s", err)
+		}
+	}
+
+	busUnit, mappings, err := machine.Build(romFilename)
+	if err != nil {
+		Logger.Fatalf("Invalid machine description: %s", err)
+	}
+
+	if cpuCount > 1 {
+		busUnit.EnableArbitration()
+	}
+
+	computeUnits := make([]*ComputeUnit.ComputeUnit, cpuCount)
+	for id := range computeUnits {
+		cu := ComputeUnit.NewComputeUnit(busUnit, mappings, uint8(id))
+		cu.SetClockSpeed(clockSpeed)
+		cu.SetVariant(cpuVariant)
+		cu.SetFaultPolicy(faultPolicy)
+		computeUnits[id] = cu
+	}
+	var debugger *Debugger.Debugger
+	quit := make(<-chan struct{})
+	if brkDebug || startMonitor {
+		// The monitor reads from the console, so only the first CPU gets one
+		debugger = Debugger.Attach(computeUnits[0].CPU(), startMonitor)
+		if brkDebug {
+			debugger.TrapBRK()
+		}
+		if *Logger.DebugMappingFile != "" {
+			debugger.Symbols = Debugger.NewSymbols(Logger.LoadSymbols(*Logger.DebugMappingFile))
+		}
+		monitor := Debugger.NewMonitor(debugger, os.Stdin, os.Stdout)
+		if *Logger.DebugListingFile != "" {
+			listing, err := Debugger.LoadListing(*Logger.DebugListingFile)
+			if err != nil {
+				Logger.Fatalf("Cannot load the listing: %s", err)
+			}
+			monitor.Listing = listing
+		}
+		quit = monitor.Quit()
+		go monitor.Run()
+	} else if gdbAddress != "" {
+		debugger = Debugger.Attach(computeUnits[0].CPU(), true)
+		server, err := GDB.Listen(gdbAddress, debugger)
+		if err != nil {
+			Logger.Fatalf("Cannot start the GDB server: %s", err)
+		}
+		quit = server.Quit()
+		go server.Serve()
+	}
+	if debugger != nil {
+		debugger.EnableRecording(recordSize)
+	}
+	var tracer *Tracer.Tracer
+	if traceFilename != "" {
+		var symbols *Debugger.Symbols
+		if traceSymbols && *Logger.DebugMappingFile != "" {
+			symbols = Debugger.NewSymbols(Logger.LoadSymbols(*Logger.DebugMappingFile))
+		}
+		var err error
+		if tracer, err = Tracer.Create(traceFilename, traceFormat, symbols); err != nil {
+			Logger.Fatalf("Cannot create the trace: %s", err)
+		}
+		// Attached after the debugger, so changes made in the monitor are traced
+		tracer.Attach(computeUnits[0].CPU())
+	}
 
-	busUnit.Reset(romFilename)
+	busUnit.Reset()
 	busUnit.Run()
 
-	cu1.Reset()
-	cu1.Run()
+	scheduler, err := Scheduler.NewScheduler(computeUnits, schedulerConfig)
+	if err != nil {
+		Logger.Fatalf("Invalid scheduler configuration: %s", err)
+	}
+
+	for _, cu := range computeUnits {
+		cu.Reset()
+	}
+	scheduler.Run()
 
-	time.Sleep(time.Second * time.Duration(runtimeLimit))
-	Logger.Infof("System exceeded runtime limit")
+	select {
+	case <-time.After(time.Second * time.Duration(runtimeLimit)):
+		Logger.Infof("System exceeded runtime limit")
+	case <-quit:
+	case <-scheduler.Done():
+		Logger.Infof("All CPUs halted")
+	}
+	if debugger != nil {
+		debugger.Detach()
+	}
 
 	Logger.Infof("Shutting down")
 
-	cu1.Halt()
+	scheduler.Halt()
 	busUnit.Halt()
+	if tracer != nil {
+		if err := tracer.Close(); err != nil {
+			Logger.Errorf("Cannot write the trace: %s", err)
+		}
+	}
 
 	Logger.Infof("Shutdown complete")
 }